@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"html/template"
+	"log"
+	"log/slog"
+	"net/http"
+
+	"github.com/iamskyy666/simple-api/errs"
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// server-rendered admin ui for when there's no separate frontend.
+// it goes through the same Storage + validation as the json api.
+
+//go:embed templates/admin/*.html
+var adminFS embed.FS
+
+// each page is parsed together with the layout, since they all define "content"
+var adminPages = map[string]*template.Template{
+	"login": parseAdminPage("login.html"),
+	"users": parseAdminPage("users.html"),
+	"form":  parseAdminPage("form.html"),
+	"stats": parseAdminPage("stats.html"),
+}
+
+func parseAdminPage(name string) *template.Template {
+	return template.Must(template.New(name).Funcs(adminFuncs).ParseFS(adminFS, "templates/admin/layout.html", "templates/admin/"+name))
+}
+
+var adminFuncs = template.FuncMap{
+	"percent": func(f float64) float64 { return f * 100 },
+	"ms":      func(seconds float64) float64 { return seconds * 1000 },
+}
+
+type adminPage struct {
+	Title    string
+	LoggedIn bool
+	Error    string
+
+	Users  []models.User
+	User   models.User
+	Fields map[string]string
+	Action string
+
+	Stats *statsReport
+}
+
+// requireSession bounces anyone without a live session cookie to the login page.
+func (s *Server) requireSession(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(sessionCookie)
+		if err != nil || !s.sessions.valid(c.Value) {
+			http.Redirect(w, r, "/admin/ui/login", http.StatusSeeOther)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) adminLoginForm(w http.ResponseWriter, r *http.Request) {
+	renderAdmin(w, http.StatusOK, "login", adminPage{Title: "Log in"})
+}
+
+func (s *Server) adminLogin(w http.ResponseWriter, r *http.Request) {
+	user := []byte(r.PostFormValue("username"))
+	pass := []byte(r.PostFormValue("password"))
+
+	// compare both, always - bailing out early would leak which one was wrong
+	okUser := subtle.ConstantTimeCompare(user, []byte(s.cfg.AdminUser))
+	okPass := subtle.ConstantTimeCompare(pass, []byte(s.cfg.AdminPassword))
+	if okUser&okPass != 1 {
+		renderAdmin(w, http.StatusUnauthorized, "login", adminPage{Title: "Log in", Error: "invalid username or password"})
+		return
+	}
+
+	token, exp := s.sessions.create()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/admin", // ui + /admin/requests
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   s.cfg.TLSCert != "",
+		SameSite: http.SameSiteStrictMode, // also our csrf protection for the forms
+	})
+	http.Redirect(w, r, "/admin/ui/", http.StatusSeeOther)
+}
+
+func (s *Server) adminLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.sessions.destroy(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/admin", MaxAge: -1})
+	http.Redirect(w, r, "/admin/ui/login", http.StatusSeeOther)
+}
+
+func (s *Server) adminListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.store.ListUsers(r.Context(), store.Filter{})
+	if err != nil {
+		s.adminError(w, err)
+		return
+	}
+	renderAdmin(w, http.StatusOK, "users", adminPage{Title: "Users", LoggedIn: true, Users: users})
+}
+
+func (s *Server) adminNewUser(w http.ResponseWriter, r *http.Request) {
+	renderAdmin(w, http.StatusOK, "form", adminPage{Title: "New user", LoggedIn: true, Action: "/admin/ui/users"})
+}
+
+func (s *Server) adminCreateUser(w http.ResponseWriter, r *http.Request) {
+	u := models.User{Name: r.PostFormValue("name"), Email: r.PostFormValue("email"), Role: r.PostFormValue("role")}
+	page := adminPage{Title: "New user", LoggedIn: true, Action: "/admin/ui/users"}
+	if !s.adminSave(w, r, u, page, s.store.CreateUser) {
+		return
+	}
+	http.Redirect(w, r, "/admin/ui/", http.StatusSeeOther)
+}
+
+func (s *Server) adminEditUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !ids.Valid(id) {
+		http.NotFound(w, r)
+		return
+	}
+	u, err := s.store.GetUser(r.Context(), id)
+	if err != nil {
+		s.adminError(w, err)
+		return
+	}
+	renderAdmin(w, http.StatusOK, "form", adminPage{
+		Title: "Edit user", LoggedIn: true, User: u,
+		Action: "/admin/ui/users/" + id,
+	})
+}
+
+func (s *Server) adminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !ids.Valid(id) {
+		http.NotFound(w, r)
+		return
+	}
+	u := models.User{ID: id, Name: r.PostFormValue("name"), Email: r.PostFormValue("email"), Role: r.PostFormValue("role")}
+	page := adminPage{Title: "Edit user", LoggedIn: true, Action: "/admin/ui/users/" + id}
+	if !s.adminSave(w, r, u, page, s.store.UpdateUser) {
+		return
+	}
+	http.Redirect(w, r, "/admin/ui/", http.StatusSeeOther)
+}
+
+func (s *Server) adminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !ids.Valid(id) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := s.store.DeleteUser(r.Context(), id); err != nil {
+		s.adminError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/admin/ui/", http.StatusSeeOther)
+}
+
+// adminSave validates u and hands it to save, re-rendering the form on failure.
+func (s *Server) adminSave(w http.ResponseWriter, r *http.Request, u models.User, page adminPage,
+	save func(ctx context.Context, u models.User) (models.User, error)) bool {
+	u.Normalize()
+	page.User = u
+	if err := u.Validate(); err != nil {
+		var fe models.FieldErrors
+		if errors.As(err, &fe) {
+			page.Fields = fe
+		} else {
+			page.Error = err.Error()
+		}
+		renderAdmin(w, http.StatusUnprocessableEntity, "form", page)
+		return false
+	}
+	saved, err := save(r.Context(), u)
+	if err != nil {
+		var dup *store.DuplicateError
+		if errors.As(err, &dup) {
+			page.Fields = map[string]string{dup.Field: "is already in use"}
+			renderAdmin(w, http.StatusConflict, "form", page)
+			return false
+		}
+		s.adminError(w, err)
+		return false
+	}
+	slog.Info("admin: user saved", "user", saved)
+	return true
+}
+
+func (s *Server) adminError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errs.NotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Println("⚠️ ERR: admin:", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func renderAdmin(w http.ResponseWriter, status int, page string, data adminPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := adminPages[page].ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("⚠️ ERR: rendering admin page:", err)
+	}
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/metrics"
+	"github.com/iamskyy666/simple-api/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// anomaly alerts, for noticing a regression without an apm: every
+// cfg.AnomalyWindow each route's 5xx rate and p95 latency for the window are
+// compared with the route's baseline, a moving average of its normal windows
+// before. a window past cfg.AnomalyFactor times the baseline fires an alert -
+// logged, and POSTed as json to cfg.AnomalyWebhook if set (signed with
+// cfg.AnomalyWebhookSecret, see package webhook) - and the first
+// normal window after that resolves it. anomalous windows stay out of the
+// baseline, so a regression that lasts doesn't quietly become the norm.
+//
+// a route isn't judged until it has anomalyWarmup windows of history, nor in
+// windows with fewer than cfg.AnomalyMinRequests requests (too noisy). like
+// /usage it's per replica: one bad pod alerts on its own (with leader
+// election, in its logs and metrics - only the leader posts the webhook).
+
+const (
+	anomalyWarmup  = 5
+	baselineWeight = 0.2 // of each new normal window in the moving average
+
+	// below these nothing is anomalous, whatever the baseline: 1ms -> 4ms is
+	// 4x but nobody's problem, and 1 error in a quiet window isn't an outage
+	minAnomalousErrorRate = 0.05
+	minAnomalousLatency   = 50 * time.Millisecond
+)
+
+// latency histogram bucket bounds; p95 is read off them, so it's an upper
+// bound rather than exact - plenty to tell 20ms from 2s.
+var latencyBounds = [...]time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// long polls take as long as nothing happens, so their latency says nothing
+var latencyUnjudged = map[string]bool{"GET /users/changes": true}
+
+var anomaliesFiring = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "anomalies_firing",
+	Help: "1 while a route's error rate or latency is anomalous (see ANOMALY_WINDOW).",
+}, []string{"route", "kind"})
+
+func init() { metrics.Registry.MustRegister(anomaliesFiring) }
+
+// anomalyAlert is what's logged and sent to the webhook.
+type anomalyAlert struct {
+	Route    string    `json:"route"` // the mux pattern, "GET /users/{id}"
+	Kind     string    `json:"kind"`  // error_rate or latency_p95
+	State    string    `json:"state"` // firing or resolved
+	Value    float64   `json:"value"` // a rate, or seconds
+	Baseline float64   `json:"baseline"`
+	Requests int       `json:"requests"` // in the window
+	Window   string    `json:"window"`
+	At       time.Time `json:"at"`
+}
+
+type anomalies struct {
+	window      time.Duration
+	factor      float64
+	minRequests int
+	webhook     string
+	secret      []byte // signs deliveries; nil: they go unsigned
+	client      *http.Client
+	leader      interface{ IsLeader() bool } // nil: no election, every replica delivers
+
+	mu     sync.Mutex
+	routes map[string]*routeStats
+}
+
+// FollowLeader makes only the elected replica deliver webhooks (see package
+// leader); the others still log their alerts and set anomalies_firing. call
+// it before the jobs start.
+func (s *Server) FollowLeader(e interface{ IsLeader() bool }) {
+	if s.anomalies != nil {
+		s.anomalies.leader = e
+	}
+}
+
+type routeStats struct {
+	cur     routeWindow
+	windows int     // judged so far
+	errRate float64 // baselines
+	p95     float64 // seconds
+	firing  map[string]bool
+}
+
+type routeWindow struct {
+	requests, errors int
+	buckets          [len(latencyBounds) + 1]int // the last is past every bound
+}
+
+func newAnomalies(window time.Duration, factor, minRequests int, hook, secret string) *anomalies {
+	a := &anomalies{
+		window:      window,
+		factor:      float64(factor),
+		minRequests: minRequests,
+		webhook:     hook,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		routes:      map[string]*routeStats{},
+	}
+	if secret != "" {
+		a.secret = []byte(secret)
+	}
+	return a
+}
+
+func (a *anomalies) record(route string, status int, d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rs := a.routes[route]
+	if rs == nil {
+		rs = &routeStats{firing: map[string]bool{}}
+		a.routes[route] = rs
+	}
+	rs.cur.add(status, d)
+}
+
+func (w *routeWindow) add(status int, d time.Duration) {
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	w.requests++
+	if status >= 500 {
+		w.errors++
+	}
+	w.buckets[i]++
+}
+
+func (w *routeWindow) merge(o routeWindow) {
+	w.requests += o.requests
+	w.errors += o.errors
+	for i, n := range o.buckets {
+		w.buckets[i] += n
+	}
+}
+
+// percentile is the upper bound of the bucket the pth percentile of the
+// latencies falls in (the last bound for anything slower), 0 without any.
+func (w *routeWindow) percentile(p int) time.Duration {
+	total := 0
+	for _, n := range w.buckets {
+		total += n
+	}
+	rank := (total*p + 99) / 100
+	if rank == 0 {
+		return 0
+	}
+	seen := 0
+	for i, n := range w.buckets {
+		if seen += n; seen >= rank && i < len(latencyBounds) {
+			return latencyBounds[i]
+		}
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// roll closes the current window of every route (a job, every a.window) and
+// sends whatever changed state.
+func (a *anomalies) roll(ctx context.Context) error {
+	now := time.Now().UTC()
+	var alerts []anomalyAlert
+	a.mu.Lock()
+	for route, rs := range a.routes {
+		w := rs.cur
+		rs.cur = routeWindow{}
+		if w.requests < a.minRequests {
+			continue
+		}
+		errRate := float64(w.errors) / float64(w.requests)
+		p95 := w.percentile(95).Seconds()
+		alert := func(kind string, firing bool, value, baseline float64) {
+			if firing == rs.firing[kind] {
+				return
+			}
+			rs.firing[kind] = firing
+			state, gauge := "resolved", 0.0
+			if firing {
+				state, gauge = "firing", 1
+			}
+			anomaliesFiring.WithLabelValues(route, kind).Set(gauge)
+			alerts = append(alerts, anomalyAlert{
+				Route: route, Kind: kind, State: state, Value: value, Baseline: baseline,
+				Requests: w.requests, Window: a.window.String(), At: now,
+			})
+		}
+
+		normal := true
+		if rs.windows >= anomalyWarmup {
+			badErrors := errRate >= minAnomalousErrorRate && errRate > a.factor*rs.errRate
+			badLatency := !latencyUnjudged[route] && p95 >= minAnomalousLatency.Seconds() && p95 > a.factor*rs.p95
+			alert("error_rate", badErrors, errRate, rs.errRate)
+			alert("latency_p95", badLatency, p95, rs.p95)
+			normal = !badErrors && !badLatency
+		}
+		if !normal {
+			continue
+		}
+		// a plain average until the baseline has enough history to move
+		weight := baselineWeight
+		if rs.windows < anomalyWarmup {
+			weight = 1 / float64(rs.windows+1)
+		}
+		rs.errRate += (errRate - rs.errRate) * weight
+		rs.p95 += (p95 - rs.p95) * weight
+		rs.windows++
+	}
+	a.mu.Unlock()
+
+	for _, al := range alerts {
+		slog.Warn("anomaly", "route", al.Route, "kind", al.Kind, "state", al.State,
+			"value", al.Value, "baseline", al.Baseline, "requests", al.Requests)
+		if a.webhook != "" && (a.leader == nil || a.leader.IsLeader()) {
+			a.send(ctx, al)
+		}
+	}
+	return nil
+}
+
+// send posts one alert; a webhook that's down costs a log line, not the job.
+func (a *anomalies) send(ctx context.Context, al anomalyAlert) {
+	body, _ := json.Marshal(al)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.webhook, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("anomaly: webhook", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.secret != nil {
+		req.Header.Set(webhook.Header, webhook.Sign(body, a.secret, time.Now()))
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		slog.Error("anomaly: webhook", "err", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		slog.Error("anomaly: webhook", "status", res.StatusCode)
+	}
+}
+
+// observe records every request's status and latency, for the anomaly
+// alerts and /admin/stats. it wraps the mux directly: the mux fills in
+// r.Pattern on the request it's handed, and only this one sees that request
+// afterwards.
+func (s *Server) observe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		now := time.Now()
+		if s.stats != nil {
+			s.stats.record(r.Pattern, status, now.Sub(start), now)
+		}
+		// unrouted requests are 404s for whatever scanners try
+		if s.anomalies != nil && r.Pattern != "" {
+			s.anomalies.record(r.Pattern, status, now.Sub(start))
+		}
+	})
+}
+
+// statusWriter notes the status on its way out.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the real writer (flush, deadlines).
+func (sw *statusWriter) Unwrap() http.ResponseWriter { return sw.ResponseWriter }
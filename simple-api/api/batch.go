@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// POST /batch runs several api calls in one round trip (mobile clients mostly).
+// every sub-request goes through the normal mux, so it gets the exact same
+// routing, validation and responses as if it had been sent on its own.
+
+type batchRequest struct {
+	// Concurrent runs the items in parallel (bounded by cfg.BatchConcurrency);
+	// by default they run one after another, in order.
+	Concurrent bool        `json:"concurrent"`
+	Requests   []batchItem `json:"requests"`
+}
+
+type batchItem struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type batchResult struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+type batchResponse struct {
+	Responses []batchResult `json:"responses"`
+}
+
+// headers copied from the outer request onto every sub-request.
+// Accept isn't one of them: a batch is json in, json out (and it keeps the spa fallback out of the way)
+var batchForwardHeaders = []string{"Authorization", "X-Api-Key", "Accept-Language", "Cookie"}
+
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	var in batchRequest
+	if err := bindJSON(w, r, &in); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(in.Requests) == 0 {
+		writeError(w, r, http.StatusBadRequest, "requests must not be empty")
+		return
+	}
+	if len(in.Requests) > s.cfg.BatchMaxItems {
+		writeErrorf(w, r, http.StatusBadRequest, "at most %d requests per batch", s.cfg.BatchMaxItems)
+		return
+	}
+	for i, it := range in.Requests {
+		if err := it.check(); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("requests[%d]: %v", i, err))
+			return
+		}
+	}
+
+	results := make([]batchResult, len(in.Requests))
+	if !in.Concurrent {
+		for i, it := range in.Requests {
+			results[i] = s.runBatchItem(r, it)
+		}
+	} else {
+		sem := make(chan struct{}, max(s.cfg.BatchConcurrency, 1))
+		var wg sync.WaitGroup
+		for i, it := range in.Requests {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = s.runBatchItem(r, it)
+			}()
+		}
+		wg.Wait()
+	}
+
+	writeJSON(w, http.StatusOK, batchResponse{Responses: results})
+}
+
+func (it batchItem) check() error {
+	switch it.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return fmt.Errorf("unsupported method %q", it.Method)
+	}
+	if !strings.HasPrefix(it.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	// no batches inside batches, and nothing that parks the request (long-poll)
+	if strings.HasPrefix(it.Path, "/batch") || strings.HasPrefix(it.Path, "/users/changes") {
+		return fmt.Errorf("path %q is not allowed in a batch", it.Path)
+	}
+	return nil
+}
+
+func (s *Server) runBatchItem(parent *http.Request, it batchItem) batchResult {
+	req, err := http.NewRequestWithContext(parent.Context(), it.Method, it.Path, bytes.NewReader(it.Body))
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest, Body: errorJSON(err.Error())}
+	}
+	for _, h := range batchForwardHeaders {
+		if v := parent.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(it.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Host = parent.Host
+	req.TLS = parent.TLS
+	req.RemoteAddr = parent.RemoteAddr
+
+	rec := newRecorder()
+	s.ServeHTTP(rec, req)
+	return rec.result()
+}
+
+// recorder is a minimal in-memory ResponseWriter for sub-requests.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecorder() *recorder { return &recorder{header: http.Header{}} }
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) result() batchResult {
+	res := batchResult{Status: rec.status, Headers: map[string]string{}}
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	for k := range rec.header {
+		res.Headers[k] = rec.header.Get(k)
+	}
+
+	body := bytes.TrimSpace(rec.body.Bytes())
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		res.Body = body
+	default:
+		// non-json bodies (eg http.Error text) are wrapped as a json string
+		res.Body, _ = json.Marshal(string(body))
+	}
+	return res
+}
+
+func errorJSON(msg string) json.RawMessage {
+	b, _ := json.Marshal(errorBody{Error: msg})
+	return b
+}
@@ -0,0 +1,140 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/iamskyy666/simple-api/api"
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// TestCBOR runs a user through the api in cbor and checks every response
+// against its json representation.
+func TestCBOR(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.ServeUI = false
+	srv, err := api.New(cfg, store.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	do := func(method, path, contentType string, body []byte, accept string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Accept", accept)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		raw, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, raw
+	}
+	in, err := cbor.Marshal(map[string]string{"name": "Sensor 7", "email": "sensor7@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, created := do(http.MethodPost, "/users", "application/cbor", in, "application/cbor")
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", res.StatusCode, created)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/cbor" {
+		t.Fatalf("create: content-type %q", ct)
+	}
+	if !slices.Contains(res.Header.Values("Vary"), "Accept") {
+		t.Errorf("create: Vary %q doesn't name Accept", res.Header.Values("Vary"))
+	}
+	var user struct {
+		ID string `json:"id"`
+	}
+	if err := cbor.Unmarshal(created, &user); err != nil || user.ID == "" {
+		t.Fatalf("create: %v, body %x", err, created)
+	}
+
+	// the same resource, one response per format
+	for _, c := range []struct {
+		name, method, path, contentType string
+		body                            []byte
+		status                          int
+	}{
+		{"get", http.MethodGet, "/users/" + user.ID, "", nil, http.StatusOK},
+		{"list", http.MethodGet, "/users", "", nil, http.StatusOK},
+		{"not found", http.MethodGet, "/users/01ARZ3NDEKTSV4RRFFQ69G5FAV", "", nil, http.StatusNotFound},
+		{"invalid", http.MethodPost, "/users?dry_run=true", "application/cbor", mustCBOR(t, map[string]string{"name": "", "email": "nope"}), http.StatusUnprocessableEntity},
+		{"duplicate", http.MethodPost, "/users?dry_run=true", "application/cbor", in, http.StatusConflict},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			jsonRes, jsonBody := do(c.method, c.path, c.contentType, c.body, "application/json")
+			cborRes, cborBody := do(c.method, c.path, c.contentType, c.body, "application/cbor")
+			if jsonRes.StatusCode != c.status || cborRes.StatusCode != c.status {
+				t.Fatalf("status: json %d, cbor %d, want %d", jsonRes.StatusCode, cborRes.StatusCode, c.status)
+			}
+			if ct := cborRes.Header.Get("Content-Type"); ct != "application/cbor" {
+				t.Fatalf("content-type %q", ct)
+			}
+			if got, want := cborAsJSON(t, cborBody), jsonTree(t, jsonBody); !reflect.DeepEqual(got, want) {
+				t.Errorf("cbor says %v\njson says %v", got, want)
+			}
+		})
+	}
+
+	// a body that isn't the cbor it says it is
+	res, raw := do(http.MethodPost, "/users", "application/cbor", []byte(`{"name":"json"}`), "application/json")
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("json sent as cbor: status %d: %s", res.StatusCode, raw)
+	}
+}
+
+func mustCBOR(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := cbor.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// cborAsJSON decodes a cbor body into the tree json.Unmarshal would build,
+// going through json so numbers come out as float64 on both sides.
+func cborAsJSON(t *testing.T, b []byte) any {
+	t.Helper()
+	dec, _ := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+	var v any
+	if err := dec.Unmarshal(b, &v); err != nil {
+		t.Fatalf("not cbor: %v: %x", err, b)
+	}
+	js, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonTree(t, js)
+}
+
+func jsonTree(t *testing.T, b []byte) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatalf("not json: %v: %s", err, b)
+	}
+	return v
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// long-polling change notifications, for clients that can't do SSE/websockets:
+//
+//	GET /users/changes?since=<token>&timeout=25s
+//
+// blocks until something changed after <token> (or the timeout hits) and
+// always answers with the token to send on the next call.
+
+type changesResponse struct {
+	Changes []store.Change `json:"changes"`
+	Next    string         `json:"next"`
+	// Reset means the token was too old (or unknown) - re-fetch /users, then keep polling from Next
+	Reset bool `json:"reset,omitempty"`
+}
+
+func (s *Server) userChanges(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	// no token = "from now on": hand one out right away
+	if q.Get("since") == "" {
+		writeBody(w, r, http.StatusOK, changesResponse{Changes: []store.Change{}, Next: strconv.FormatUint(s.changes.Head(), 10)})
+		return
+	}
+	since, err := strconv.ParseUint(q.Get("since"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid since token")
+		return
+	}
+
+	timeout := s.cfg.LongPollTimeout
+	if v := q.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid timeout")
+			return
+		}
+		timeout = min(d, s.cfg.LongPollTimeout)
+	}
+
+	// a draining server answers parked polls right away instead of holding up shutdown
+	ctx, cancel := s.untilDraining(r.Context())
+	defer cancel()
+	changes, next, reset, err := s.changes.Wait(ctx, since, timeout)
+	if err != nil && clientGone(r) {
+		disconnected(r, "since", since)
+		w.WriteHeader(statusClientClosed)
+		return
+	}
+	if changes == nil {
+		changes = []store.Change{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeBody(w, r, http.StatusOK, changesResponse{Changes: changes, Next: strconv.FormatUint(next, 10), Reset: reset})
+}
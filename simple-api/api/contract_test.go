@@ -0,0 +1,399 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/api"
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// contract tests: every operation in openapi.json is replayed against a real
+// server, and each response has to use a documented status code and match
+// the documented schema. an operation without a case fails the suite.
+
+type contractCase struct {
+	op     string // "METHOD /path/{template}" as written in the spec
+	name   string
+	method string
+	path   string // concrete path + query; "{id}" / "{email}" are filled from the fixture
+	body   string
+	header map[string]string
+	want   int
+}
+
+var ndjson = map[string]string{"Content-Type": "application/x-ndjson"}
+
+var contractCases = []contractCase{
+	{op: "GET /users", name: "list", path: "/users", want: 200},
+	{op: "GET /users", name: "filtered", path: "/users?filter=email:suffix:@example.com", want: 200},
+	{op: "GET /users", name: "bad filter", path: "/users?filter=nope", want: 400},
+	{op: "GET /users", name: "sorted", path: "/users?sort=-name,created_at", want: 200},
+	{op: "GET /users", name: "bad sort", path: "/users?sort=age", want: 400},
+	{op: "GET /users", name: "collated", path: "/users?sort=name&collation=de", want: 200},
+	{op: "GET /users", name: "bad collation", path: "/users?sort=name&collation=x-nope", want: 400},
+	{op: "GET /users", name: "range", path: "/users", header: map[string]string{"Range": "items=0-0"}, want: 206},
+	{op: "GET /users", name: "open range", path: "/users", header: map[string]string{"Range": "items=0-"}, want: 206},
+	{op: "GET /users", name: "unsatisfiable range", path: "/users", header: map[string]string{"Range": "items=1000-"}, want: 416},
+	{op: "GET /users", name: "bad range", path: "/users", header: map[string]string{"Range": "items=5-2"}, want: 400},
+
+	{op: "POST /users", name: "create", body: `{"name":"New","email":"new@example.com"}`, want: 201},
+	{op: "POST /users", name: "unknown field", body: `{"name":"New","email":"x@example.com","nope":1}`, want: 400},
+	{op: "POST /users", name: "duplicate", body: `{"name":"Dup","email":"fixture@example.com"}`, want: 409},
+	{op: "POST /users", name: "invalid", body: `{"name":"","email":"nope"}`, want: 422},
+	{op: "POST /users", name: "dry run", path: "/users?dry_run=true", body: `{"name":"Dry","email":"dry@example.com"}`, want: 200},
+	{op: "POST /users", name: "dry run duplicate", path: "/users?dry_run=true", body: `{"name":"Dup","email":"fixture@example.com"}`, want: 409},
+	{op: "POST /users", name: "bad dry run", path: "/users?dry_run=maybe", body: `{"name":"Dry","email":"dry@example.com"}`, want: 400},
+	{op: "POST /users", name: "minimal", body: `{"name":"Min","email":"min@example.com"}`, header: map[string]string{"Prefer": "return=minimal"}, want: 201},
+
+	{op: "DELETE /users", name: "dry run", path: "/users?filter=email:eq:fixture@example.com&dry_run=true", want: 200},
+	{op: "DELETE /users", name: "no filter", path: "/users", want: 400},
+
+	{op: "GET /users/changes", name: "head", path: "/users/changes", want: 200},
+	{op: "GET /users/changes", name: "since", path: "/users/changes?since=0&timeout=10ms", want: 200},
+	{op: "GET /users/changes", name: "bad token", path: "/users/changes?since=abc", want: 400},
+
+	{op: "GET /users/export", name: "all", path: "/users/export", want: 200},
+	{op: "GET /users/export", name: "filtered", path: "/users/export?filter=name:contains:fix", want: 200},
+	{op: "GET /users/export", name: "bad filter", path: "/users/export?filter=nope", want: 400},
+
+	{op: "POST /users/import", name: "import", header: ndjson, want: 200,
+		body: "{\"name\":\"Imported\",\"email\":\"imported@example.com\"}\n\n{\"name\":\"\",\"email\":\"nope\"}\n{\"name\":\"Dup\",\"email\":\"fixture@example.com\"}\n{"},
+	{op: "POST /users/import", name: "not ndjson", body: `{"name":"a","email":"a@example.com"}`, want: 415},
+
+	{op: "GET /users/search", name: "typo", path: "/users/search?q=fixtrue", want: 200},
+	{op: "GET /users/search", name: "prefix", path: "/users/search?q=fix&limit=5", want: 200},
+	{op: "GET /users/search", name: "no query", path: "/users/search", want: 400},
+	{op: "GET /users/search", name: "bad limit", path: "/users/search?q=a&limit=1000", want: 400},
+
+	{op: "GET /users/by-email/{email}", name: "found", path: "/users/by-email/{email}", want: 200},
+	{op: "GET /users/by-email/{email}", name: "not modified", path: "/users/by-email/{email}", header: map[string]string{"If-None-Match": "*"}, want: 304},
+	{op: "GET /users/by-email/{email}", name: "missing", path: "/users/by-email/nobody@example.com", want: 404},
+
+	{op: "GET /users/{id}", name: "found", path: "/users/{id}", want: 200},
+	{op: "GET /users/{id}", name: "not modified", path: "/users/{id}", header: map[string]string{"If-None-Match": "*"}, want: 304},
+	{op: "GET /users/{id}", name: "bad id", path: "/users/not-an-id", want: 400},
+	{op: "GET /users/{id}", name: "missing", path: "/users/01ARZ3NDEKTSV4RRFFQ69G5FAV", want: 404},
+
+	{op: "PUT /users/{id}", name: "update", path: "/users/{id}", body: `{"name":"Renamed","email":"fixture@example.com","role":"admin"}`, want: 200},
+	{op: "GET /users/{id}/revisions", name: "history", path: "/users/{id}/revisions", want: 200},
+	{op: "GET /users/{id}/revisions", name: "missing", path: "/users/01ARZ3NDEKTSV4RRFFQ69G5FAV/revisions", want: 404},
+	{op: "GET /users/{id}/revisions/{range}", name: "diff", path: "/users/{id}/revisions/1..2", want: 200},
+	{op: "GET /users/{id}/revisions/{range}", name: "bad range", path: "/users/{id}/revisions/1-2", want: 400},
+	{op: "GET /users/{id}/revisions/{range}", name: "no such revision", path: "/users/{id}/revisions/1..99", want: 404},
+	{op: "PUT /users/{id}", name: "bad json", path: "/users/{id}", body: `{`, want: 400},
+	{op: "PUT /users/{id}", name: "missing", path: "/users/01ARZ3NDEKTSV4RRFFQ69G5FAV", body: `{"name":"a","email":"a@example.com"}`, want: 404},
+	{op: "PUT /users/{id}", name: "conflict", path: "/users/{id}", body: `{"name":"a","email":"other@example.com"}`, want: 409},
+	{op: "PUT /users/{id}", name: "invalid", path: "/users/{id}", body: `{"name":"a","email":"a","role":"boss"}`, want: 422},
+	{op: "PUT /users/{id}", name: "dry run", path: "/users/{id}?dry_run=true", body: `{"name":"Dry","email":"fixture@example.com"}`, want: 200},
+	{op: "PUT /users/{id}", name: "dry run conflict", path: "/users/{id}?dry_run=true", body: `{"name":"a","email":"other@example.com"}`, want: 409},
+	{op: "PUT /users/{id}", name: "dry run missing", path: "/users/01ARZ3NDEKTSV4RRFFQ69G5FAV?dry_run=true", body: `{"name":"a","email":"a@example.com"}`, want: 404},
+	{op: "PUT /users/{id}", name: "minimal", path: "/users/{id}", body: `{"name":"Renamed","email":"fixture@example.com"}`, header: map[string]string{"Prefer": "return=minimal"}, want: 204},
+
+	{op: "DELETE /users/{id}", name: "bad id", path: "/users/-1", want: 400},
+	{op: "DELETE /users/{id}", name: "missing", path: "/users/01ARZ3NDEKTSV4RRFFQ69G5FAV", want: 404},
+	{op: "DELETE /users/{id}", name: "delete", path: "/users/{id}", want: 204}, // last: removes the fixture
+
+	{op: "POST /batch", name: "batch", body: `{"requests":[{"method":"GET","path":"/users"},{"method":"GET","path":"/users/01ARZ3NDEKTSV4RRFFQ69G5FAV"}]}`, want: 200},
+	{op: "POST /batch", name: "empty", body: `{"requests":[]}`, want: 400},
+
+	{op: "GET /healthz", name: "alive", want: 200},
+	{op: "GET /readyz", name: "ready", want: 200},
+	{op: "GET /status", name: "status", want: 200},
+	{op: "GET /version", name: "version", want: 200},
+	{op: "GET /version", name: "not modified", header: map[string]string{"If-None-Match": "*"}, want: 304},
+	{op: "GET /usage", name: "usage", want: 200},
+	{op: "POST /undo/{token}", name: "unknown token", path: "/undo/nope", want: 404},
+}
+
+func TestContract(t *testing.T) {
+	cfg := config.FromEnv()
+	cfg.ServeUI = false
+	cfg.LongPollTimeout = 50 * time.Millisecond
+	srv, err := api.New(cfg, store.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	spec := loadSpec(t, ts.URL)
+
+	// fixtures: the user most cases point at, plus one to collide with
+	fixture := mustCreate(t, ts.URL, `{"name":"Fixture","email":"fixture@example.com"}`)
+	mustCreate(t, ts.URL, `{"name":"Other","email":"other@example.com"}`)
+
+	covered := map[string]bool{}
+	for _, c := range contractCases {
+		t.Run(c.op+" "+c.name, func(t *testing.T) {
+			method, tmpl, _ := strings.Cut(c.op, " ")
+			op := spec.operation(method, tmpl)
+			if op == nil {
+				t.Fatalf("%s is not in openapi.json", c.op)
+			}
+			covered[c.op] = true
+
+			path := c.path
+			if path == "" {
+				path = tmpl
+			}
+			path = strings.NewReplacer("{id}", fixture["id"].(string), "{email}", url.PathEscape(fixture["email"].(string))).Replace(path)
+
+			var body io.Reader
+			if c.body != "" {
+				body = strings.NewReader(c.body)
+			}
+			req, err := http.NewRequest(method, ts.URL+path, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", "application/json")
+			if c.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for k, v := range c.header {
+				req.Header.Set(k, v)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			raw, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != c.want {
+				t.Fatalf("status %d, want %d: %s", res.StatusCode, c.want, raw)
+			}
+			resp := spec.response(op, res.StatusCode)
+			if resp == nil {
+				t.Fatalf("status %d is not documented for %s", res.StatusCode, c.op)
+			}
+			if schema := spec.mediaSchema(resp, "application/x-ndjson"); schema != nil {
+				if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/x-ndjson") {
+					t.Fatalf("content-type %q, want application/x-ndjson", ct)
+				}
+				// every line is one document of the schema
+				for i, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+					var v any
+					if err := json.Unmarshal([]byte(line), &v); err != nil {
+						t.Fatalf("line %d is not json: %v: %s", i, err, line)
+					}
+					if err := spec.validate(schema, v, fmt.Sprintf("$[line %d]", i)); err != nil {
+						t.Fatalf("schema mismatch: %v\nline: %s", err, line)
+					}
+				}
+				return
+			}
+			schema := spec.responseSchema(resp)
+			if res.Header.Get("Preference-Applied") == "return=minimal" {
+				schema = nil // asked for no body
+			}
+			if schema == nil {
+				if len(raw) > 0 {
+					t.Fatalf("documented without a body, got %q", raw)
+				}
+				return
+			}
+			if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Fatalf("content-type %q, want application/json", ct)
+			}
+			var v any
+			if err := json.Unmarshal(raw, &v); err != nil {
+				t.Fatalf("body is not json: %v: %s", err, raw)
+			}
+			if err := spec.validate(schema, v, "$"); err != nil {
+				t.Fatalf("schema mismatch: %v\nbody: %s", err, raw)
+			}
+		})
+	}
+
+	for _, op := range spec.operations() {
+		if !covered[op] {
+			t.Errorf("%s is documented but has no contract case", op)
+		}
+	}
+}
+
+func mustCreate(t *testing.T, base, body string) map[string]any {
+	t.Helper()
+	res, err := http.Post(base+"/users", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("creating fixture: status %d", res.StatusCode)
+	}
+	var u map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// a tiny openapi 3 reader - just enough json schema for our own spec
+// (type, required, properties, additionalProperties, items, enum, format, $ref).
+
+type openAPI struct {
+	doc map[string]any
+}
+
+func loadSpec(t *testing.T, base string) openAPI {
+	t.Helper()
+	res, err := http.Get(base + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var doc map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return openAPI{doc: doc}
+}
+
+var specMethods = []string{"get", "post", "put", "patch", "delete"}
+
+func (s openAPI) operations() []string {
+	var out []string
+	for path, item := range s.doc["paths"].(map[string]any) {
+		for _, m := range specMethods {
+			if _, ok := item.(map[string]any)[m]; ok {
+				out = append(out, strings.ToUpper(m)+" "+path)
+			}
+		}
+	}
+	return out
+}
+
+func (s openAPI) operation(method, path string) map[string]any {
+	item, _ := s.doc["paths"].(map[string]any)[path].(map[string]any)
+	op, _ := item[strings.ToLower(method)].(map[string]any)
+	return op
+}
+
+func (s openAPI) response(op map[string]any, status int) map[string]any {
+	r, _ := op["responses"].(map[string]any)[strconv.Itoa(status)].(map[string]any)
+	if r == nil {
+		return nil
+	}
+	return s.deref(r)
+}
+
+func (s openAPI) responseSchema(resp map[string]any) map[string]any {
+	return s.mediaSchema(resp, "application/json")
+}
+
+func (s openAPI) mediaSchema(resp map[string]any, mediaType string) map[string]any {
+	content, _ := resp["content"].(map[string]any)
+	media, _ := content[mediaType].(map[string]any)
+	schema, _ := media["schema"].(map[string]any)
+	return schema
+}
+
+func (s openAPI) deref(node map[string]any) map[string]any {
+	ref, ok := node["$ref"].(string)
+	if !ok {
+		return node
+	}
+	var cur any = s.doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		cur = cur.(map[string]any)[part]
+	}
+	return s.deref(cur.(map[string]any))
+}
+
+func (s openAPI) validate(schema map[string]any, v any, at string) error {
+	schema = s.deref(schema)
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if e == v {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v not in enum %v", at, v, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case nil:
+		return nil // {} - anything goes
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: want string, got %T", at, v)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, str)
+			}
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: want integer, got %v", at, v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: want number, got %T", at, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: want boolean, got %T", at, v)
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want array, got %T", at, v)
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, el := range arr {
+			if err := s.validate(items, el, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want object, got %T", at, v)
+		}
+		req, _ := schema["required"].([]any)
+		for _, k := range req {
+			if _, ok := obj[k.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %q", at, k)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for k, val := range obj {
+			if p, ok := props[k].(map[string]any); ok {
+				if err := s.validate(p, val, at+"."+k); err != nil {
+					return err
+				}
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Errorf("%s: unexpected property %q", at, k)
+				}
+			case map[string]any:
+				if err := s.validate(extra, val, at+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
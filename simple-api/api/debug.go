@@ -0,0 +1,259 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/redact"
+)
+
+// opt-in request/response recording for reproducing client reports.
+// cfg.DebugRecord lists path prefixes to capture ("*" = everything); the last
+// cfg.DebugRecordSize exchanges are kept in memory and shown at /admin/requests.
+// headers and bodies are sanitized before they're stored, not when shown.
+
+const debugBodyLimit = 4 << 10 // bytes kept per body
+
+// header values and json/form keys that never make it into the buffer
+var (
+	sensitiveHeaders = map[string]bool{
+		"Authorization": true, "Cookie": true, "Set-Cookie": true,
+		"X-Api-Key": true, "Proxy-Authorization": true,
+	}
+	sensitiveKeys = map[string]bool{
+		"password": true, "token": true, "secret": true, "email": true,
+		"api_key": true, "authorization": true,
+	}
+)
+
+type exchange struct {
+	At       time.Time         `json:"at"`
+	Duration string            `json:"duration"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Query    string            `json:"query,omitempty"`
+	Status   int               `json:"status"`
+	ReqHead  map[string]string `json:"request_headers"`
+	ReqBody  string            `json:"request_body,omitempty"`
+	RespHead map[string]string `json:"response_headers"`
+	RespBody string            `json:"response_body,omitempty"`
+}
+
+// exchangeLog is a fixed-size ring buffer of recorded exchanges.
+type exchangeLog struct {
+	mu   sync.Mutex
+	buf  []exchange
+	next int
+	full bool
+}
+
+func newExchangeLog(size int) *exchangeLog {
+	return &exchangeLog{buf: make([]exchange, max(size, 1))}
+}
+
+func (l *exchangeLog) add(e exchange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf[l.next] = e
+	l.next = (l.next + 1) % len(l.buf)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// newestFirst copies the buffer out, most recent exchange first.
+func (l *exchangeLog) newestFirst() []exchange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.buf)
+	}
+	out := make([]exchange, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.buf[(l.next-i+len(l.buf))%len(l.buf)])
+	}
+	return out
+}
+
+func (s *Server) shouldRecord(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		return false // never record the admin area (and the viewer itself)
+	}
+	for _, p := range s.cfg.DebugRecord {
+		if p == "*" || strings.HasPrefix(r.URL.Path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordExchanges is the recording middleware - a no-op for routes not opted in.
+func (s *Server) recordExchanges(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.shouldRecord(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// tee the body as the handler reads it, so nothing is consumed twice
+		reqBody := &capped{limit: debugBodyLimit}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, reqBody), r.Body}
+
+		cw := &captureWriter{ResponseWriter: w, body: capped{limit: debugBodyLimit}}
+		start := time.Now()
+		next.ServeHTTP(cw, r)
+
+		status := cw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.exchanges.add(exchange{
+			At:       start.UTC(),
+			Duration: time.Since(start).String(),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Query:    sanitizeQuery(r.URL.Query()),
+			Status:   status,
+			ReqHead:  sanitizeHeaders(r.Header),
+			ReqBody:  sanitizeBody(r.Header.Get("Content-Type"), reqBody),
+			RespHead: sanitizeHeaders(cw.Header()),
+			RespBody: sanitizeBody(cw.Header().Get("Content-Type"), &cw.body),
+		})
+	})
+}
+
+func (s *Server) listExchanges(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.exchanges.newestFirst())
+}
+
+// captureWriter copies the status and the start of the body on their way out.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   capped
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the real writer (flush, deadlines).
+func (cw *captureWriter) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
+
+// capped is a buffer that silently stops growing at limit.
+type capped struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (c *capped) Write(b []byte) (int, error) {
+	if room := c.limit - c.buf.Len(); room < len(b) {
+		c.truncated = true
+		c.buf.Write(b[:max(room, 0)])
+	} else {
+		c.buf.Write(b)
+	}
+	return len(b), nil
+}
+
+func sanitizeHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = redact.Mask
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+func sanitizeQuery(q url.Values) string {
+	for k := range q {
+		if sensitiveKeys[strings.ToLower(k)] {
+			q[k] = []string{redact.Mask}
+		}
+	}
+	return q.Encode()
+}
+
+func sanitizeBody(contentType string, c *capped) string {
+	if c.buf.Len() == 0 {
+		return ""
+	}
+	raw := c.buf.Bytes()
+	suffix := ""
+	if c.truncated {
+		suffix = "…(truncated)"
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "application/json") && !c.truncated:
+		var v any
+		if err := json.Unmarshal(raw, &v); err == nil {
+			b, _ := json.Marshal(maskJSON(v))
+			return string(b)
+		}
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if q, err := url.ParseQuery(string(raw)); err == nil && plainKeys(q) {
+			return sanitizeQuery(q) + suffix
+		}
+	}
+	// can't parse it, so can't prove it's clean
+	return fmt.Sprintf("(%s body omitted, %d bytes)", contentType, c.buf.Len())
+}
+
+// plainKeys rejects "forms" whose keys are really data (eg json posted as a form).
+func plainKeys(q url.Values) bool {
+	for k := range q {
+		for _, r := range k {
+			if !(r == '_' || r == '-' || r == '[' || r == ']' || r == '.' ||
+				'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func maskJSON(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if sensitiveKeys[strings.ToLower(k)] {
+				t[k] = redact.Mask
+			} else {
+				t[k] = maskJSON(val)
+			}
+		}
+	case []any:
+		for i := range t {
+			t[i] = maskJSON(t[i])
+		}
+	}
+	return v
+}
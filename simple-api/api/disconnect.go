@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/iamskyy666/simple-api/metrics"
+	"github.com/iamskyy666/simple-api/reqctx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// a client hanging up mid-request - an export download cancelled, a long poll
+// abandoned - is nobody's failure: it's counted and logged as its own outcome,
+// client_disconnected, rather than as an error (or a success). requests that
+// hadn't answered yet get nginx's 499, so /admin/stats and the anomaly alerts
+// see neither a 5xx nor a 200.
+
+const statusClientClosed = 499
+
+var clientDisconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_client_disconnects_total",
+	Help: "Requests whose client hung up before the response was done, by route.",
+}, []string{"route"})
+
+func init() { metrics.Registry.MustRegister(clientDisconnects) }
+
+// clientGone reports whether r's client hung up: net/http cancels the
+// request's context then. a deadline is bounded's timeout instead, a 503.
+func clientGone(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.Canceled)
+}
+
+// disconnected records r as client_disconnected; attrs say how far it got.
+func disconnected(r *http.Request, attrs ...any) {
+	clientDisconnects.WithLabelValues(r.Pattern).Inc()
+	reqctx.Logger(r.Context()).Info("client disconnected",
+		append([]any{"outcome", "client_disconnected", "route", r.Pattern}, attrs...)...)
+}
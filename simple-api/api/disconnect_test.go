@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// hangUp is a client that goes away after its first write.
+type hangUp struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+	writes int
+}
+
+func (h *hangUp) Write(b []byte) (int, error) {
+	h.writes++
+	h.cancel()
+	return h.ResponseRecorder.Write(b)
+}
+
+// TestClientDisconnects: an export stops reading the store once its client
+// hangs up, and a dropped long poll ends as a 499; both are counted.
+func TestClientDisconnects(t *testing.T) {
+	s := newRouteServer(t, nil)
+	for i := range 3 * exportFlushEvery {
+		u := models.User{Name: fmt.Sprint("user ", i), Email: fmt.Sprintf("user%d@example.com", i)}
+		if _, err := s.store.CreateUser(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(route string) float64 { return testutil.ToFloat64(clientDisconnects.WithLabelValues(route)) }
+
+	before := count("GET /users/export")
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &hangUp{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	s.ServeHTTP(w, httptest.NewRequestWithContext(ctx, http.MethodGet, "/users/export", nil))
+	if w.writes > 1 {
+		t.Errorf("export went on for %d writes after the client left", w.writes)
+	}
+	if got := count("GET /users/export"); got != before+1 {
+		t.Errorf("export: %v disconnects counted, want %v", got, before+1)
+	}
+
+	before = count("GET /users/changes")
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/users/changes?since=%d&timeout=10s", s.changes.Head()), nil))
+	if rec.Code != statusClientClosed {
+		t.Errorf("long poll: status %d", rec.Code)
+	}
+	if got := count("GET /users/changes"); got != before+1 {
+		t.Errorf("long poll: %v disconnects counted, want %v", got, before+1)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/serializer"
+)
+
+// precomputed responses: things that hardly ever change are encoded once and
+// served as bytes, with an etag so clients that have them get a 304 -
+//
+//   - /version and /openapi.json, fixed for the life of the process
+//   - single users (GET /users/{id}, /users/by-email/{email}), re-encoded
+//     only when the stored user differs from the one the bytes came from
+//
+// the bytes are json. a client that negotiated another format gets the
+// value encoded on the spot, as any other response.
+type encoded struct {
+	body []byte
+	etag []string // as the header value, built once
+}
+
+// encode marshals v the way the json codec does (trailing newline included),
+// so both paths send identical bytes.
+func encode(v any) encoded {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic("api: precomputing response: " + err.Error()) // our own types; a bug, not input
+	}
+	body = append(body, '\n')
+	return encoded{body: body, etag: []string{etag(body)}}
+}
+
+// writeEncoded sends e, or a 304 when the client's If-None-Match has it.
+func writeEncoded(w http.ResponseWriter, r *http.Request, e encoded) {
+	h := w.Header()
+	h["Etag"] = e.etag // canonical spelling, as Set would have it
+	if noneMatch(r.Header.Get("If-None-Match"), e.etag[0]) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h["Content-Type"] = serializer.JSON.ContentType
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+}
+
+// noneMatch reports whether an If-None-Match value matches tag (weak
+// comparison, as rfc 9110 has it for GET).
+func noneMatch(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// maxEncodedUsers bounds the user cache; past it, an arbitrary entry makes
+// room (map order is random enough for that).
+const maxEncodedUsers = 10_000
+
+// userBodies caches encoded users by view: id plus, with hypermedia on, the
+// link base, since the bytes carry absolute urls.
+type userBodies struct {
+	mu sync.Mutex
+	m  map[string]userBody
+
+	hits, misses atomic.Int64 // for /admin/stats
+}
+
+type userBody struct {
+	user models.User // what the bytes say; any change to the stored user re-encodes
+	encoded
+}
+
+func newUserBodies() *userBodies { return &userBodies{m: map[string]userBody{}} }
+
+func (c *userBodies) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.m)
+}
+
+func (c *userBodies) get(key string, u models.User, render func() any) encoded {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.m[key]; ok && b.user == u {
+		c.hits.Add(1)
+		return b.encoded
+	}
+	c.misses.Add(1)
+	if len(c.m) >= maxEncodedUsers {
+		for k := range c.m {
+			delete(c.m, k)
+			break
+		}
+	}
+	b := userBody{user: u, encoded: encode(render())}
+	c.m[key] = b
+	return b.encoded
+}
+
+// aUser stands in for the user in writeUser's negotiation, which only needs
+// its type: boxing the user itself costs an alloc per request.
+var aUser any = models.User{}
+
+// writeUser is writeBody(w, r, 200, s.userView(r, u)), from the cache for json.
+func (s *Server) writeUser(w http.ResponseWriter, r *http.Request, u models.User) {
+	if f := format(w, r, aUser); f != serializer.JSON {
+		writeAs(w, http.StatusOK, f, s.userView(r, u))
+		return
+	}
+	key := u.ID
+	if s.cfg.Hypermedia {
+		key += " " + s.linksFor(r).base
+	}
+	writeEncoded(w, r, s.userBodies.get(key, u, func() any { return s.userView(r, u) }))
+}
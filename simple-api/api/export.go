@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// GET /users/export streams every (matching) user as newline-delimited json,
+// straight from the store's iterator - memory stays flat however big the table.
+// once the first row is out the status is committed, so a failure halfway
+// just ends the stream early (and is logged). a client hanging up cancels
+// the request's context, which stops the iterator - and the query under it -
+// at the next row.
+
+const exportFlushEvery = 100
+
+func (s *Server) exportUsers(w http.ResponseWriter, r *http.Request) {
+	f, err := listFilter(w, r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	it, err := s.store.ListUsersIter(r.Context(), f)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	defer it.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="users.ndjson"`)
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w) // Encode adds the newline
+	n := 0
+	for it.Next() {
+		if err := enc.Encode(it.Value()); err != nil {
+			disconnected(r, "rows", n, "err", err) // a failed write is the client gone too
+			return
+		}
+		if n++; n%exportFlushEvery == 0 {
+			rc.Flush()
+		}
+	}
+	switch err := it.Err(); {
+	case err == nil:
+	case clientGone(r):
+		disconnected(r, "rows", n)
+	default:
+		slog.Error("export: stream cut short", "rows", n, "err", err)
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// go test ./api -run '^$' -fuzz FuzzCreateUser -fuzztime 30s
+
+// adversarial seeds shared by every target
+var fuzzSeeds = []string{
+	`{"name":"Skyy","email":"skyy@email.com"}`,
+	`{"name":"Skyy","email":"skyy@email.com","role":"admin"}`,
+	``,
+	`null`,
+	`[]`,
+	`"just a string"`,
+	`{"name":`,
+	`{"name":"a","email":"a@b.co"}}`,
+	`{"name":"a","email":"a@b.co"} {"name":"b"}`,
+	`{"name":"a","email":"a@b.co","id":"01HZZZZZZZZZZZZZZZZZZZZZZZ"}`,
+	`{"name":1e999999,"email":123456789012345678901234567890}`,
+	"{\"name\":\"\xff\xfe\",\"email\":\"a@b.co\"}", // raw invalid bytes, not an escape
+	`{"name":"\ud800","email":"a@b.co"}`,
+	`{"name":"a\u0000b","email":"a@b.co"}`,
+	strings.Repeat(`{"name":`, 10000) + `"x"` + strings.Repeat(`}`, 10000),
+	strings.Repeat(`[`, 100000),
+	`{"name":"` + strings.Repeat("a", maxBodyBytes) + `","email":"a@b.co"}`,
+}
+
+func newFuzzServer(f *testing.F) *Server {
+	f.Helper()
+	cfg := config.FromEnv()
+	cfg.ServeUI = false
+	s, err := New(cfg, store.NewMemory())
+	if err != nil {
+		f.Fatal(err)
+	}
+	return s
+}
+
+// FuzzBindJSON checks the binder itself: whatever it accepts has to be a
+// single, valid, utf-8 json document.
+func FuzzBindJSON(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		r := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+		var in userInput
+		if err := bindJSON(httptest.NewRecorder(), r, &in); err != nil {
+			return
+		}
+		if !utf8.Valid(body) {
+			t.Fatalf("accepted invalid utf-8: %q", body)
+		}
+		if !json.Valid(body) {
+			t.Fatalf("accepted invalid json: %q", body)
+		}
+	})
+}
+
+// FuzzCreateUser drives POST /users end to end: malformed input must be a
+// 4xx, never a 5xx or a panic, and anything that got created must be valid.
+func FuzzCreateUser(f *testing.F) {
+	s := newFuzzServer(f)
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		s.ServeHTTP(rec, req)
+
+		switch {
+		case rec.Code == http.StatusCreated:
+			var u models.User
+			if err := json.Unmarshal(rec.Body.Bytes(), &u); err != nil {
+				t.Fatalf("201 with undecodable body: %v", err)
+			}
+			if err := u.Validate(); err != nil {
+				t.Fatalf("created an invalid user from %q: %v", body, err)
+			}
+		case rec.Code >= 400 && rec.Code < 500:
+			var e errorBody
+			if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil || e.Error == "" {
+				t.Fatalf("%d without a json error body: %q", rec.Code, rec.Body)
+			}
+		default:
+			t.Fatalf("unexpected status %d for %q: %s", rec.Code, body, rec.Body)
+		}
+	})
+}
+
+// FuzzBatch feeds arbitrary batch envelopes through POST /batch.
+func FuzzBatch(f *testing.F) {
+	s := newFuzzServer(f)
+	f.Add([]byte(`{"requests":[{"method":"GET","path":"/users"}]}`))
+	f.Add([]byte(`{"concurrent":true,"requests":[{"method":"POST","path":"/users","body":{"name":"a","email":"a@b.co"}}]}`))
+	f.Add([]byte(`{"requests":[{"method":"POST","path":"/batch","body":{"requests":[]}}]}`))
+	f.Add([]byte(`{"requests":[{"method":"GET","path":"/users/%zz"}]}`))
+	f.Add([]byte(`{"requests":[{"method":"GET","path":"/\u0000"}]}`))
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(body))
+		s.ServeHTTP(rec, req)
+		if rec.Code >= 500 {
+			t.Fatalf("status %d for %q: %s", rec.Code, body, rec.Body)
+		}
+		if rec.Code != http.StatusOK {
+			return
+		}
+		var out batchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("200 with undecodable body: %v", err)
+		}
+		for i, res := range out.Responses {
+			if res.Status >= 500 {
+				t.Fatalf("sub-request %d: status %d: %s", i, res.Status, res.Body)
+			}
+		}
+	})
+}
+
+// FuzzValidate checks Normalize/Validate never panic and Normalize is idempotent.
+func FuzzValidate(f *testing.F) {
+	f.Add("Skyy", "skyy@email.com", "member")
+	f.Add("", "", "")
+	f.Add(" \t", "NOT-AN-EMAIL", "ADMIN ")
+	f.Add("\xff", "a@\xff.co", "\x00")
+	f.Fuzz(func(t *testing.T, name, email, role string) {
+		u := models.User{Name: name, Email: email, Role: role}
+		u.Normalize()
+		once := u
+		u.Normalize()
+		if u != once {
+			t.Fatalf("Normalize not idempotent: %+v vs %+v", once, u)
+		}
+		_ = u.Validate()
+	})
+}
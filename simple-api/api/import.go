@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/iamskyy666/simple-api/i18n"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/serializer"
+	"github.com/iamskyy666/simple-api/store"
+	"golang.org/x/text/language"
+)
+
+// POST /users/import is /users/export the other way round: newline-delimited
+// json, one UserInput per line, each created as POST /users would. rows stand
+// alone - a bad or duplicate one is reported by line and the rest go in - so
+// the answer is a summary, 200 unless the body itself couldn't be read.
+//
+// cfg.ImportConcurrency workers decode, validate and store the rows, so they
+// are created in no particular order (of two lines with one email, either
+// may win). a million rows mustn't cost a million of everything: lines are
+// read into pooled chunks, one buffer for importChunkRows of them, and each
+// worker reuses its decode target. see BenchmarkImport in package bench.
+
+const (
+	importMaxBytes  = 256 << 20 // a million rows, with room to spare
+	importMaxLine   = 64 << 10  // the read buffer; a user is a fraction of it
+	importChunkRows = 256
+	maxImportErrors = 100 // reported; past it they're only counted
+)
+
+type importResponse struct {
+	Imported int           `json:"imported"`
+	Failed   int           `json:"failed"`
+	Errors   []importError `json:"errors,omitempty"` // the first maxImportErrors, by line
+	// Error is why the import stopped early, if it did; the rows before
+	// that point are in
+	Error string `json:"error,omitempty"`
+}
+
+type importError struct {
+	Line   int               `json:"line"` // 1-based
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// importChunk holds consecutive lines back to back in one buffer.
+type importChunk struct {
+	first int // line number of the first
+	buf   []byte
+	ends  []int // where each line ends in buf
+	long  []int // lines past importMaxLine, by number, not in buf
+}
+
+var importChunks = sync.Pool{New: func() any {
+	return &importChunk{buf: make([]byte, 0, 32<<10), ends: make([]int, 0, importChunkRows)}
+}}
+
+func (c *importChunk) reset(first int) {
+	c.first, c.buf, c.ends, c.long = first, c.buf[:0], c.ends[:0], c.long[:0]
+}
+
+// importTally is one worker's share of the response.
+type importTally struct {
+	imported, failed int
+	errors           []importError
+}
+
+func (t *importTally) fail(e importError) {
+	t.failed++
+	if len(t.errors) < maxImportErrors {
+		t.errors = append(t.errors, e)
+	}
+}
+
+func (s *Server) importUsers(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mt, _, _ := mime.ParseMediaType(ct); mt != "application/x-ndjson" && mt != "application/jsonl" {
+			writeError(w, r, http.StatusUnsupportedMediaType, "body must be application/x-ndjson")
+			return
+		}
+	}
+	// cancelled with the error that isn't any row's fault (the store's down)
+	ctx, cancel := context.WithCancelCause(r.Context())
+	defer cancel(nil)
+	tag := lang(w, r)
+
+	workers := max(s.cfg.ImportConcurrency, 1)
+	chunks := make(chan *importChunk, workers)
+	tallies := make([]importTally, workers)
+	var wg sync.WaitGroup
+	for i := range tallies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.importWorker(ctx, cancel, tag, chunks, &tallies[i])
+		}()
+	}
+	readErr := readImport(ctx, r.Body, chunks)
+	close(chunks)
+	wg.Wait()
+
+	var res importResponse
+	// each worker's errors are in line order (chunks go out in order), so the
+	// first maxImportErrors overall are among the workers' first
+	for _, t := range tallies {
+		res.Imported += t.imported
+		res.Failed += t.failed
+		res.Errors = append(res.Errors, t.errors...)
+	}
+	slices.SortFunc(res.Errors, func(a, b importError) int { return a.Line - b.Line })
+	res.Errors = res.Errors[:min(len(res.Errors), maxImportErrors)]
+
+	status := http.StatusOK
+	switch cause := context.Cause(ctx); {
+	case clientGone(r):
+		disconnected(r, "imported", res.Imported)
+		w.WriteHeader(statusClientClosed)
+		return
+	case errors.Is(cause, context.DeadlineExceeded):
+		status, res.Error = http.StatusServiceUnavailable, i18n.T(tag, "request timed out")
+	case cause != nil:
+		log.Println("⚠️ ERR: import:", cause)
+		status, res.Error = http.StatusInternalServerError, i18n.T(tag, "internal error")
+	case readErr != nil:
+		var maxErr *http.MaxBytesError
+		if errors.As(readErr, &maxErr) {
+			status, res.Error = http.StatusRequestEntityTooLarge, i18n.Sprintf(tag, "body must not be larger than %d bytes", maxErr.Limit)
+		} else {
+			status, res.Error = http.StatusBadRequest, fmt.Sprintf("reading body: %v", readErr)
+		}
+	}
+	writeBody(w, r, status, res)
+}
+
+// readImport cuts body into chunks of lines for the workers, until it ends,
+// fails or ctx is done.
+func readImport(ctx context.Context, body io.Reader, chunks chan<- *importChunk) error {
+	br := bufio.NewReaderSize(body, importMaxLine)
+	c := importChunks.Get().(*importChunk)
+	c.reset(1)
+	send := func(next int) bool {
+		select {
+		case chunks <- c:
+		case <-ctx.Done():
+			importChunks.Put(c)
+			return false
+		}
+		c = importChunks.Get().(*importChunk)
+		c.reset(next)
+		return true
+	}
+	for line := 1; ; line++ {
+		b, err := br.ReadSlice('\n')
+		long := errors.Is(err, bufio.ErrBufferFull)
+		if long {
+			// no user is that long: skip to its end, an empty line standing in
+			c.long = append(c.long, line)
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = br.ReadSlice('\n')
+			}
+			b = nil
+		}
+		// a last line may lack its newline
+		if err == nil || long || len(b) > 0 {
+			c.buf = append(c.buf, b...)
+			c.ends = append(c.ends, len(c.buf))
+		}
+		if err != nil {
+			if len(c.ends) > 0 && !send(line+1) {
+				return ctx.Err()
+			}
+			importChunks.Put(c)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if len(c.ends) == importChunkRows && !send(line+1) {
+			return ctx.Err()
+		}
+	}
+}
+
+// importWorker stores every row of the chunks it gets, tallying into t.
+func (s *Server) importWorker(ctx context.Context, stop context.CancelCauseFunc, tag language.Tag, chunks <-chan *importChunk, t *importTally) {
+	var in userInput
+	for c := range chunks {
+		start := 0
+		for i, end := range c.ends {
+			line := c.first + i
+			b := bytes.TrimSpace(c.buf[start:end])
+			start = end
+			switch {
+			case ctx.Err() != nil:
+				// drained, not stored: the reader may be blocked on us
+			case slices.Contains(c.long, line):
+				t.fail(importError{Line: line, Error: i18n.Sprintf(tag, "line must not be longer than %d bytes", importMaxLine)})
+			case len(b) == 0:
+			default:
+				in = userInput{}
+				if err := serializer.JSON.Decode(b, &in); err != nil {
+					t.fail(importError{Line: line, Error: err.Error()})
+					continue
+				}
+				if err := s.importRow(ctx, tag, line, in, t); err != nil {
+					stop(err)
+				}
+			}
+		}
+		importChunks.Put(c)
+	}
+}
+
+// importRow stores one row; the error is for failures that aren't the row's.
+func (s *Server) importRow(ctx context.Context, tag language.Tag, line int, in userInput, t *importTally) error {
+	u := models.User{Name: in.Name, Email: in.Email, Role: in.Role}
+	u.Normalize()
+	err := u.Validate()
+	if err == nil {
+		_, err = s.store.CreateUser(ctx, u)
+	}
+	var (
+		dup *store.DuplicateError
+		fe  models.FieldErrors
+	)
+	switch {
+	case err == nil:
+		t.imported++
+	case errors.As(err, &dup):
+		t.fail(importError{Line: line, Error: i18n.Sprintf(tag, "%s already in use", dup.Field)})
+	case errors.As(err, &fe):
+		fields := make(map[string]string, len(fe))
+		for k, msg := range fe {
+			fields[k] = i18n.T(tag, msg)
+		}
+		t.fail(importError{Line: line, Error: i18n.T(tag, "validation failed"), Fields: fields})
+	case ctx.Err() == nil:
+		return err
+	}
+	return nil
+}
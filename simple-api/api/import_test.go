@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iamskyy666/simple-api/config"
+)
+
+func serveImport(t *testing.T, s *Server, body string) importResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/users/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var res importResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// TestImport runs rows across several chunks and workers and checks every
+// bad one is reported at its line.
+func TestImport(t *testing.T) {
+	s := newRouteServer(t, func(cfg *config.Config) { cfg.ImportConcurrency = 4 })
+	var lines []string
+	bad := map[int]string{}
+	for i := 1; i <= 3*importChunkRows+10; i++ {
+		line := fmt.Sprintf(`{"name":"User %d","email":"user%d@example.com"}`, i, i)
+		switch i {
+		case 7:
+			line, bad[i] = `{"name":"","email":"user7@example.com"}`, "validation failed"
+		case importChunkRows:
+			line, bad[i] = `{"name":"a","email":"a@example.com","nope":1}`, "invalid json"
+		case importChunkRows + 1:
+			line = "" // skipped, but it's still a line
+		case 2 * importChunkRows:
+			// in the same chunk as the first, so it's the one that loses
+			line, bad[i] = fmt.Sprintf(`{"name":"Again","email":"user%d@example.com"}`, importChunkRows+2), "email already in use"
+		case 2*importChunkRows + 5:
+			line, bad[i] = `{"name":"`+strings.Repeat("x", importMaxLine)+`"}`, "line must not be longer"
+		}
+		lines = append(lines, line)
+	}
+	res := serveImport(t, s, strings.Join(lines, "\r\n")) // no newline after the last
+
+	if want := len(lines) - len(bad) - 1; res.Imported != want || res.Failed != len(bad) {
+		t.Errorf("imported %d, failed %d; want %d, %d", res.Imported, res.Failed, want, len(bad))
+	}
+	prev := 0
+	for _, e := range res.Errors {
+		if e.Line <= prev {
+			t.Errorf("line %d reported after %d", e.Line, prev)
+		}
+		prev = e.Line
+		if want, ok := bad[e.Line]; !ok || !strings.Contains(e.Error, want) {
+			t.Errorf("line %d: %q, want %q", e.Line, e.Error, want)
+		}
+	}
+	if len(res.Errors) != len(bad) {
+		t.Errorf("%d errors reported: %+v", len(res.Errors), res.Errors)
+	}
+}
+
+func TestImportErrorsCapped(t *testing.T) {
+	s := newRouteServer(t, func(cfg *config.Config) { cfg.ImportConcurrency = 3 })
+	res := serveImport(t, s, strings.Repeat("{}\n", 3*maxImportErrors))
+	if res.Failed != 3*maxImportErrors || len(res.Errors) != maxImportErrors {
+		t.Fatalf("failed %d, reported %d", res.Failed, len(res.Errors))
+	}
+	for i, e := range res.Errors {
+		if e.Line != i+1 {
+			t.Fatalf("error %d is for line %d", i, e.Line)
+		}
+	}
+}
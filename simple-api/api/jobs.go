@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/iamskyy666/simple-api/jobs"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// Jobs is the background work this server wants run; main hands it to a
+// jobs.Scheduler next to the http listener.
+//
+// the ones marked Local tidy or watch what this process holds - sessions,
+// usage counts, nonces, the trash, its /status board and anomaly windows -
+// so every replica has to run them; skipping them on all but one would leave
+// the rest growing. work on shared state - revisions a backend keeps - goes
+// through the locker.
+func (s *Server) Jobs() []jobs.Job {
+	js := []jobs.Job{
+		{Name: "admin-sessions-purge", Every: time.Minute, Run: s.sessions.purge, Local: true},
+		{Name: "usage-purge", Every: time.Hour, Run: s.usage.purge, Local: true},
+		{Name: "signature-nonces-purge", Every: time.Minute, Run: s.nonces.purge, Local: true},
+	}
+	if s.trash != nil {
+		js = append(js, jobs.Job{Name: "trash-purge", Every: time.Minute, Run: s.trash.purge, Local: true})
+	}
+	if s.cfg.StatusCheckInterval > 0 {
+		timeout := min(s.cfg.StatusCheckInterval, 5*time.Second)
+		js = append(js, jobs.Job{Name: "status-checks", Every: s.cfg.StatusCheckInterval, Local: true,
+			Run: func(ctx context.Context) error { return s.status.checkDependencies(ctx, timeout) }})
+	}
+	if s.cfg.RevisionsMaxAge > 0 {
+		_, inMemory := s.revisions.(*store.Revisions)
+		js = append(js, jobs.Job{Name: "revisions-prune", Every: time.Hour, Run: s.pruneRevisions, Local: inMemory})
+	}
+	if s.anomalies != nil {
+		js = append(js, jobs.Job{Name: "anomaly-check", Every: s.cfg.AnomalyWindow, Run: s.anomalies.roll, Local: true})
+	}
+	return js
+}
+
+func (s *Server) pruneRevisions(ctx context.Context) error {
+	n, err := s.revisions.PruneRevisions(ctx, time.Now().Add(-s.cfg.RevisionsMaxAge))
+	if n > 0 {
+		slog.Info("revisions: pruned", "count", n)
+	}
+	return err
+}
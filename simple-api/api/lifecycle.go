@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lifecycle backs the k8s probes and graceful shutdown:
+//
+//	GET  /healthz       liveness - 200 as long as the process serves http
+//	GET  /readyz        readiness - 503 once draining, so the LB stops sending traffic
+//	POST /quitquitquit  asks main to start the shutdown sequence (preStop hook),
+//	                    needs the X-Lifecycle-Token header to match LIFECYCLE_TOKEN
+//
+// shutdown order (driven by main): StartDraining -> wait cfg.DrainDelay ->
+// http.Server.Shutdown. parked long-polls are released when draining starts.
+type lifecycle struct {
+	draining atomic.Bool
+	drainCh  chan struct{} // closed by StartDraining
+	quitCh   chan struct{} // closed by /quitquitquit
+	drainMu  sync.Once
+	quitMu   sync.Once
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{drainCh: make(chan struct{}), quitCh: make(chan struct{})}
+}
+
+// StartDraining flips readiness to false and wakes up anything parked on a
+// long-poll. safe to call more than once.
+func (s *Server) StartDraining() {
+	s.life.drainMu.Do(func() {
+		s.life.draining.Store(true)
+		close(s.life.drainCh)
+	})
+}
+
+// QuitRequested is closed when someone calls POST /quitquitquit.
+func (s *Server) QuitRequested() <-chan struct{} { return s.life.quitCh }
+
+// untilDraining derives a context that is also cancelled when draining starts.
+func (s *Server) untilDraining(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.life.drainCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+type probeBody struct {
+	Status      string                `json:"status"`
+	Pools       map[string]poolReport `json:"pools,omitempty"`       // readyz, sql backends only
+	Maintenance *maintenanceState     `json:"maintenance,omitempty"` // readyz, while on
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, probeBody{Status: "ok"})
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if s.life.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, probeBody{Status: "draining"})
+		return
+	}
+	body := probeBody{Status: "ready"}
+	if st := s.maintenance.get(); st.Enabled {
+		body.Status, body.Maintenance = "maintenance", &st // still ready: reads are served
+	}
+	if s.pools != nil {
+		var ok bool
+		if body.Pools, ok = s.pools.check(time.Now()); !ok {
+			body.Status = "db pool exhausted"
+			writeJSON(w, http.StatusServiceUnavailable, body)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// requireToken lets in requests carrying the lifecycle token - and nobody at
+// all while there's no token configured.
+func (s *Server) requireToken(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Lifecycle-Token")
+		if s.cfg.LifecycleToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.LifecycleToken)) != 1 {
+			writeError(w, r, http.StatusForbidden, "invalid lifecycle token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) quitquitquit(w http.ResponseWriter, r *http.Request) {
+	s.StartDraining()
+	s.life.quitMu.Do(func() { close(s.life.quitCh) })
+	writeJSON(w, http.StatusAccepted, probeBody{Status: "draining"})
+}
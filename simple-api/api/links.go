@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// hypermedia (HATEOAS) support - when cfg.Hypermedia is on, resources carry
+// a "_links" object so clients can follow urls instead of building them.
+
+type Link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"`
+}
+
+type Links map[string]Link
+
+// userResource is a user as rendered with links - the embedded struct keeps
+// the user's fields at the top level, so plain clients can ignore "_links".
+type userResource struct {
+	models.User
+	Links Links `json:"_links"`
+}
+
+type userResources []userResource
+
+// links builds absolute urls for the host the request came in on.
+type links struct {
+	base string // eg "https://api.example.com", no trailing slash
+}
+
+func (s *Server) linksFor(r *http.Request) links {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	// behind a load balancer the original scheme/host only survive in these headers,
+	// so only trust them when we've been told there is a proxy in front
+	if s.cfg.TrustProxy {
+		if p := firstHeaderValue(r, "X-Forwarded-Proto"); p != "" {
+			scheme = p
+		}
+		if h := firstHeaderValue(r, "X-Forwarded-Host"); h != "" {
+			host = h
+		}
+	}
+	return links{base: scheme + "://" + host}
+}
+
+func (l links) users() string { return l.base + "/users" }
+
+func (l links) user(id string) Links {
+	self := l.users() + "/" + id
+	return Links{
+		"self":       {Href: self, Method: http.MethodGet},
+		"update":     {Href: self, Method: http.MethodPut},
+		"delete":     {Href: self, Method: http.MethodDelete},
+		"collection": {Href: l.users(), Method: http.MethodGet},
+	}
+}
+
+// userView is what handlers hand to writeJSON for a single user.
+func (s *Server) userView(r *http.Request, u models.User) any {
+	if !s.cfg.Hypermedia {
+		return u
+	}
+	return userResource{User: u, Links: s.linksFor(r).user(u.ID)}
+}
+
+func (s *Server) usersView(r *http.Request, users []models.User) any {
+	if !s.cfg.Hypermedia {
+		return users
+	}
+	l := s.linksFor(r)
+	out := make(userResources, len(users))
+	for i, u := range users {
+		out[i] = userResource{User: u, Links: l.user(u.ID)}
+	}
+	return out
+}
+
+// firstHeaderValue handles "a, b" style headers appended by proxy chains.
+func firstHeaderValue(r *http.Request, key string) string {
+	v, _, _ := strings.Cut(r.Header.Get(key), ",")
+	return strings.TrimSpace(v)
+}
+
+// lastHeaderValue is the value the last proxy appended, across repeated
+// header lines too.
+func lastHeaderValue(r *http.Request, key string) string {
+	vs := r.Header.Values(key)
+	if len(vs) == 0 {
+		return ""
+	}
+	v := vs[len(vs)-1]
+	if i := strings.LastIndexByte(v, ','); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
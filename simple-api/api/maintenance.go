@@ -0,0 +1,117 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maintenance mode, for migrations and the like: reads keep working, writes
+// get 503 with Retry-After. toggled at runtime with
+//
+//	GET /admin/maintenance
+//	PUT /admin/maintenance  {"enabled": true, "retry_after": 300, "reason": "..."}
+//
+// (admin session or X-Lifecycle-Token, so a migration job can flip it), or
+// on from the start with MAINTENANCE=true. /readyz stays 200 but says so -
+// the instance is still fit for the reads.
+type maintenanceState struct {
+	Enabled    bool       `json:"enabled"`
+	Since      *time.Time `json:"since,omitempty"`
+	RetryAfter int        `json:"retry_after,omitempty"` // seconds
+	Reason     string     `json:"reason,omitempty"`
+}
+
+const defaultMaintenanceRetry = 300
+
+type maintenance struct {
+	state atomic.Pointer[maintenanceState]
+}
+
+func newMaintenance(on bool) *maintenance {
+	m := &maintenance{}
+	st := maintenanceState{}
+	if on {
+		now := time.Now().UTC()
+		st = maintenanceState{Enabled: true, Since: &now, RetryAfter: defaultMaintenanceRetry}
+	}
+	m.state.Store(&st)
+	return m
+}
+
+func (m *maintenance) get() maintenanceState { return *m.state.Load() }
+
+// mutation is what maintenance mode blocks: writes to users, over the api
+// (undo included) or the admin ui - dry runs aside, on the routes that take
+// them (the route table's dryRun). batch sub-requests come through here one
+// by one.
+func (s *Server) mutation(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if isDryRun(r) {
+		if rt, ok := s.routeFor(r); ok && rt.dryRun {
+			return false
+		}
+	}
+	return metered(r) || strings.HasPrefix(r.URL.Path, "/undo/") || strings.HasPrefix(r.URL.Path, "/admin/ui/users")
+}
+
+func (s *Server) maintenanceGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if st := s.maintenance.get(); st.Enabled && s.mutation(r) {
+			w.Header().Set("Retry-After", strconv.Itoa(st.RetryAfter))
+			writeError(w, r, http.StatusServiceUnavailable, "down for maintenance, try again later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin lets in an admin session or the lifecycle token - scripts
+// have the latter, people the former.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.Handler {
+	token, session := s.requireToken(next), s.requireSession(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Lifecycle-Token") != "" || s.cfg.AdminPassword == "" {
+			token.ServeHTTP(w, r)
+			return
+		}
+		session.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, s.maintenance.get())
+}
+
+func (s *Server) putMaintenance(w http.ResponseWriter, r *http.Request) {
+	var in maintenanceState
+	if err := bindJSON(w, r, &in); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if in.RetryAfter < 0 {
+		writeError(w, r, http.StatusBadRequest, "invalid retry_after")
+		return
+	}
+	st := maintenanceState{}
+	if in.Enabled {
+		now := time.Now().UTC()
+		st = maintenanceState{Enabled: true, Since: &now, RetryAfter: in.RetryAfter, Reason: in.Reason}
+		if st.RetryAfter == 0 {
+			st.RetryAfter = defaultMaintenanceRetry
+		}
+		if old := s.maintenance.get(); old.Enabled {
+			st.Since = old.Since // still the same maintenance window
+		}
+	}
+	s.maintenance.state.Store(&st)
+	slog.Warn("maintenance mode", "enabled", st.Enabled, "reason", st.Reason, "remote", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, st)
+}
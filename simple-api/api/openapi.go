@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// the spec is hand-written next to the handlers, all but the list of
+// operations: paths are built from the route table, openapi.json has each
+// operation's parameters, bodies and responses. contract_test.go replays
+// every operation served, so neither can quietly drift from the code.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// buildSpec is openapi.json with its operations named, summarised and
+// filtered by the route table - one that's off with this config isn't
+// served, so it isn't documented either. a documented route openapi.json
+// has no details for, or details no route claims, is a bug: it panics.
+func buildSpec(table []route) encoded {
+	var spec map[string]any
+	dec := json.NewDecoder(bytes.NewReader(openAPISpec))
+	dec.UseNumber()
+	if err := dec.Decode(&spec); err != nil {
+		panic("api: openapi.json: " + err.Error())
+	}
+	details := spec["paths"].(map[string]any)
+	paths := map[string]any{}
+	for _, rt := range table {
+		if rt.doc == nil {
+			continue
+		}
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		if rt.doc.path != "" {
+			path = rt.doc.path
+		}
+		method = strings.ToLower(method)
+		item, _ := details[path].(map[string]any)
+		op, ok := item[method].(map[string]any)
+		if !ok {
+			panic(fmt.Sprintf("api: route %s is documented, but openapi.json has no %s %s", rt.pattern, method, path))
+		}
+		delete(item, method)
+		if rt.off {
+			continue
+		}
+		op["operationId"], op["summary"] = rt.doc.id, rt.doc.summary
+		if rt.role != roleAnyone {
+			op["x-required-role"] = rt.role.String()
+		}
+		if rt.limit.n > 0 {
+			op["x-rate-limit"] = map[string]any{"requests": rt.limit.n, "window": rt.limit.per.String()}
+			op["responses"].(map[string]any)["429"] = map[string]any{"$ref": "#/components/responses/TooManyRequests"}
+		}
+		out, _ := paths[path].(map[string]any)
+		if out == nil {
+			out = map[string]any{}
+			if params, ok := item["parameters"]; ok {
+				out["parameters"] = params
+			}
+			paths[path] = out
+		}
+		out[method] = op
+	}
+	for path, item := range details {
+		for method := range item.(map[string]any) {
+			if method != "parameters" {
+				panic(fmt.Sprintf("api: openapi.json documents %s %s, which no route serves", strings.ToUpper(method), path))
+			}
+		}
+	}
+	spec["paths"] = paths
+	body, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		panic("api: openapi.json: " + err.Error())
+	}
+	return encoded{body: body, etag: []string{etag(body)}}
+}
+
+func (s *Server) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeEncoded(w, r, s.spec)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// poolWatch backs the pool part of /readyz. a pool counts as exhausted when
+// every connection is in use and callers are still queueing for one (WaitCount
+// went up since the last probe); readiness fails once that has lasted
+// cfg.DBPoolExhaustedFor, so the LB shifts traffic to replicas that can serve it.
+type poolWatch struct {
+	dbs   map[string]*sql.DB
+	limit time.Duration
+
+	mu    sync.Mutex
+	waits map[string]int64     // WaitCount at the previous check
+	since map[string]time.Time // when each pool was first seen exhausted
+}
+
+type poolReport struct {
+	Open      int    `json:"open"`
+	InUse     int    `json:"in_use"`
+	Idle      int    `json:"idle"`
+	MaxOpen   int    `json:"max_open"`
+	WaitCount int64  `json:"wait_count"`
+	WaitTime  string `json:"wait_time"`
+	Exhausted string `json:"exhausted_for,omitempty"`
+}
+
+func newPoolWatch(dbs map[string]*sql.DB, limit time.Duration) *poolWatch {
+	return &poolWatch{dbs: dbs, limit: limit, waits: map[string]int64{}, since: map[string]time.Time{}}
+}
+
+// check reports every pool and whether all of them are fit to serve.
+func (p *poolWatch) check(now time.Time) (map[string]poolReport, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make(map[string]poolReport, len(p.dbs))
+	ok := true
+	for name, db := range p.dbs {
+		st := db.Stats()
+		rep := reportPool(st)
+		exhausted := st.MaxOpenConnections > 0 && st.InUse >= st.MaxOpenConnections && st.WaitCount > p.waits[name]
+		p.waits[name] = st.WaitCount
+		if !exhausted {
+			delete(p.since, name)
+		} else {
+			if _, seen := p.since[name]; !seen {
+				p.since[name] = now
+			}
+			d := now.Sub(p.since[name])
+			rep.Exhausted = d.Round(time.Second).String()
+			if d >= p.limit {
+				ok = false
+			}
+		}
+		out[name] = rep
+	}
+	return out, ok
+}
+
+// report is check without the side effects, for /admin/stats: it leaves
+// readiness's view of the pools alone.
+func (p *poolWatch) report(now time.Time) map[string]poolReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]poolReport, len(p.dbs))
+	for name, db := range p.dbs {
+		rep := reportPool(db.Stats())
+		if since, ok := p.since[name]; ok {
+			rep.Exhausted = now.Sub(since).Round(time.Second).String()
+		}
+		out[name] = rep
+	}
+	return out
+}
+
+func reportPool(st sql.DBStats) poolReport {
+	return poolReport{
+		Open:      st.OpenConnections,
+		InUse:     st.InUse,
+		Idle:      st.Idle,
+		MaxOpen:   st.MaxOpenConnections,
+		WaitCount: st.WaitCount,
+		WaitTime:  st.WaitDuration.String(),
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/errs"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// what a write sends back, and whether it writes at all:
+//
+//   - ?dry_run=true on POST /users and PUT /users/{id} runs everything a
+//     write would - validation, the email and existence checks - and answers
+//     200 with the user as it would be stored, without storing it (form
+//     validation as you type). a preview of a create has no id yet.
+//   - Prefer: return=minimal skips the body of a successful write (201 with
+//     Location, or 204), for clients that don't read it.
+//
+// the uniqueness check is a read, so a dry run that passes can still lose the
+// email to someone else's write before the real one.
+
+// dryRunParam reads ?dry_run; ok is false (and a 400 written) if it isn't a bool.
+func dryRunParam(w http.ResponseWriter, r *http.Request) (dry, ok bool) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, true
+	}
+	dry, err := strconv.ParseBool(v)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid dry_run")
+		return false, false
+	}
+	return dry, true
+}
+
+// isDryRun is dryRunParam for the middleware: dry runs don't change
+// anything, so maintenance mode lets them through where they're taken.
+func isDryRun(r *http.Request) bool {
+	dry, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	return dry
+}
+
+// previewCreate is what CreateUser would store for u, minus the id.
+func (s *Server) previewCreate(ctx context.Context, u models.User) (models.User, error) {
+	if err := s.emailFree(ctx, u.Email, ""); err != nil {
+		return models.User{}, err
+	}
+	u.PrepareCreate(time.Now())
+	return u, nil
+}
+
+// previewUpdate is what UpdateUser would store for u.
+func (s *Server) previewUpdate(ctx context.Context, u models.User) (models.User, error) {
+	old, err := s.store.GetUser(ctx, u.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := s.emailFree(ctx, u.Email, old.ID); err != nil {
+		return models.User{}, err
+	}
+	u.ID, u.LegacyID = old.ID, old.LegacyID // u.ID may have been a legacy one
+	u.PrepareUpdate(old, time.Now())
+	return u, nil
+}
+
+// emailFree returns the DuplicateError the write would get if someone other
+// than user id has email.
+func (s *Server) emailFree(ctx context.Context, email, id string) error {
+	owner, err := s.store.GetUserByEmail(ctx, email)
+	switch {
+	case errors.Is(err, errs.NotFound):
+		return nil
+	case err != nil:
+		return err
+	case owner.ID != id:
+		return &store.DuplicateError{Field: "email", ExistingID: owner.ID}
+	}
+	return nil
+}
+
+// returnMinimal reports whether the client sent Prefer: return=minimal, and
+// if so says it was honoured (rfc 7240).
+func returnMinimal(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Prefer")
+	for _, v := range r.Header.Values("Prefer") {
+		for _, p := range strings.Split(v, ",") {
+			p, _, _ = strings.Cut(p, ";") // parameters don't matter to us
+			name, val, _ := strings.Cut(p, "=")
+			if strings.EqualFold(strings.TrimSpace(name), "return") && strings.EqualFold(strings.Trim(strings.TrimSpace(val), `"`), "minimal") {
+				w.Header().Set("Preference-Applied", "return=minimal")
+				return true
+			}
+		}
+	}
+	return false
+}
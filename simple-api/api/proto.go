@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/iamskyy666/simple-api/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// protobuf forms of the api's own response types (see package pb); users
+// themselves are converted there.
+
+func (u userResource) Proto() proto.Message {
+	m := pb.FromUser(u.User)
+	m.Links = make(map[string]*pb.Link, len(u.Links))
+	for rel, l := range u.Links {
+		m.Links[rel] = &pb.Link{Href: l.Href, Method: l.Method}
+	}
+	return m
+}
+
+func (us userResources) Proto() proto.Message {
+	list := &pb.UserList{Users: make([]*pb.User, len(us))}
+	for i, u := range us {
+		list.Users[i] = u.Proto().(*pb.User)
+	}
+	return list
+}
+
+func (e errorBody) Proto() proto.Message {
+	return &pb.Error{Error: e.Error, Fields: e.Fields}
+}
+
+func (e conflictBody) Proto() proto.Message {
+	return &pb.Error{Error: e.Error, Field: e.Field, Existing: e.Existing}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// range requests on collections, for clients built around them (dojo-style
+// grids and friends):
+//
+//	Range: items=0-49   ->  206, Content-Range: items 0-49/1234
+//	Range: items=50-    ->  everything from item 50 on
+//
+// item numbers are positions in the listing as filtered and sorted. a range
+// that starts past the end is a 416 with Content-Range: items */<total>;
+// other units are ignored, as http says they should be.
+
+const rangeUnit = "items"
+
+type itemRange struct {
+	first, last int // last is -1 for "to the end"
+}
+
+var errBadRange = errors.New("invalid Range header, want items=<first>-[<last>]")
+
+// parseItemRange reads a Range header; ok is false when there's none (or
+// it's in a unit we don't serve).
+func parseItemRange(h string) (rng itemRange, ok bool, err error) {
+	spec, found := strings.CutPrefix(h, rangeUnit+"=")
+	if !found {
+		return itemRange{}, false, nil
+	}
+	firstS, lastS, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found || strings.Contains(lastS, ",") { // multiple ranges: not for json arrays
+		return itemRange{}, true, errBadRange
+	}
+	first, err := strconv.Atoi(firstS)
+	if err != nil || first < 0 {
+		return itemRange{}, true, errBadRange
+	}
+	rng = itemRange{first: first, last: -1}
+	if lastS != "" {
+		if rng.last, err = strconv.Atoi(lastS); err != nil || rng.last < first {
+			return itemRange{}, true, errBadRange
+		}
+	}
+	return rng, true, nil
+}
+
+// sliceRange cuts items down to the Range the client asked for and sets the
+// headers to match. it returns the status to send, or 0 after it has
+// written an error.
+func sliceRange[T any](w http.ResponseWriter, r *http.Request, items []T) ([]T, int) {
+	w.Header().Set("Accept-Ranges", rangeUnit)
+	rng, ok, err := parseItemRange(r.Header.Get("Range"))
+	if !ok {
+		return items, http.StatusOK
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return nil, 0
+	}
+	total := len(items)
+	if total == 0 {
+		w.Header().Set("Content-Range", rangeUnit+" */0")
+		return items, http.StatusOK // nothing to take a part of
+	}
+	if rng.first >= total {
+		w.Header().Set("Content-Range", fmt.Sprintf("%s */%d", rangeUnit, total))
+		writeError(w, r, http.StatusRequestedRangeNotSatisfiable, "range not satisfiable")
+		return nil, 0
+	}
+	last := rng.last
+	if last < 0 || last >= total {
+		last = total - 1
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("%s %d-%d/%d", rangeUnit, rng.first, last, total))
+	return items[rng.first : last+1], http.StatusPartialContent
+}
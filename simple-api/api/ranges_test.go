@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// TestItemRanges: Range: items=a-b gets those items of the listing with a
+// matching Content-Range, and a range past the end gets 416.
+func TestItemRanges(t *testing.T) {
+	s := newRouteServer(t, nil)
+	names := []string{"a", "b", "c", "d", "e"}
+	for _, n := range names {
+		if _, err := s.store.CreateUser(context.Background(), models.User{Name: n, Email: n + "@example.com", Role: "user"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		rng          string
+		status       int
+		contentRange string
+		names        []string
+	}{
+		{"", http.StatusOK, "", names},
+		{"items=1-2", http.StatusPartialContent, "items 1-2/5", names[1:3]},
+		{"items=3-", http.StatusPartialContent, "items 3-4/5", names[3:]},
+		{"items=0-0", http.StatusPartialContent, "items 0-0/5", names[:1]},
+		{"items=4-99", http.StatusPartialContent, "items 4-4/5", names[4:]},
+		{"items=5-9", http.StatusRequestedRangeNotSatisfiable, "items */5", nil},
+		{"items=2-1", http.StatusBadRequest, "", nil},
+		{"items=0-1,3-4", http.StatusBadRequest, "", nil},
+		{"bytes=0-10", http.StatusOK, "", names}, // not our unit: ignored
+	} {
+		req := httptest.NewRequest("GET", "/users?sort=name", nil)
+		if c.rng != "" {
+			req.Header.Set("Range", c.rng)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != c.status || rec.Header().Get("Content-Range") != c.contentRange {
+			t.Errorf("%q: status %d, Content-Range %q; want %d, %q", c.rng, rec.Code, rec.Header().Get("Content-Range"), c.status, c.contentRange)
+			continue
+		}
+		if c.names == nil {
+			continue
+		}
+		var got []struct{ Name string }
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%q: %v: %s", c.rng, err, rec.Body)
+		}
+		gotNames := make([]string, len(got))
+		for i, u := range got {
+			gotNames[i] = u.Name
+		}
+		if !slices.Equal(gotNames, c.names) {
+			t.Errorf("%q: got %v, want %v", c.rng, gotNames, c.names)
+		}
+	}
+}
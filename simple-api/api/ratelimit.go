@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/reqctx"
+)
+
+// per-route rate limits (see route.limit), per replica. unlike the quota
+// they don't count by api key: a client with several keys, or guessing at
+// them, would get a fresh allowance with each. see limitKey.
+
+// limiter counts one route's requests per caller in fixed windows aligned
+// to the clock: every caller's window starts at once, so the old counts can
+// all be dropped together and the map never holds more than one window's
+// callers.
+type limiter struct {
+	rate
+	mu     sync.Mutex
+	window time.Time
+	counts map[callerKey]int
+}
+
+func newLimiter(r rate) *limiter {
+	return &limiter{rate: r, counts: map[callerKey]int{}}
+}
+
+// take counts a request, returning the caller's count in this window, when
+// the window ends, and whether the request is within the limit.
+func (l *limiter) take(c callerKey, now time.Time) (n int, reset time.Time, ok bool) {
+	start := now.Truncate(l.per)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !start.Equal(l.window) {
+		l.window = start
+		clear(l.counts)
+	}
+	l.counts[c]++
+	n = l.counts[c]
+	return n, start.Add(l.per), n <= l.n
+}
+
+// rateLimit turns away callers over rt, telling all of them where they stand
+// in X-RateLimit-* headers (the quota's are X-Quota-*).
+func (s *Server) rateLimit(rt rate, next http.Handler) http.Handler {
+	l := newLimiter(rt)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		n, reset, ok := l.take(s.limitKey(r), now)
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(l.n))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(max(l.n-n, 0)))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if !ok {
+			h.Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			writeError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitKey is who a request counts against for rate limits: who it's
+// verified to be from (a client cert or a signature), else its ip - with or
+// without an X-Api-Key.
+func (s *Server) limitKey(r *http.Request) callerKey {
+	if id, ok := reqctx.Claims(r.Context()); ok {
+		return callerKey{id.Kind, id.Name}
+	}
+	if id, ok := signedBy(r.Context()); ok {
+		return callerKey{"hmac", id}
+	}
+	return callerKey{"ip", s.clientIP(r)}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/config"
+)
+
+// TestRateLimitKeys: a new X-Api-Key, configured or made up, doesn't reset
+// a route's limit - guessing at the admin password with one per try still
+// runs into it - while a verified caller has an allowance of its own.
+func TestRateLimitKeys(t *testing.T) {
+	s := newRouteServer(t, func(cfg *config.Config) {
+		cfg.APIKeys = []string{"ci:k3y", "cd:k4y"}
+		cfg.SigningKeys = []string{"ci:secret"}
+	})
+	login := func(key string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/admin/ui/login", strings.NewReader(url.Values{"password": {"guess"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Api-Key", key)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	keys := []string{"k3y", "k4y", "made-up"}
+	for i := range 10 {
+		if code := login(keys[i%len(keys)]); code == http.StatusTooManyRequests {
+			t.Fatalf("try %d: limited early", i+1)
+		}
+	}
+	for _, key := range append(keys, "another", "") {
+		if code := login(key); code != http.StatusTooManyRequests {
+			t.Errorf("11th try with key %q: %d, want 429", key, code)
+		}
+	}
+
+	req := signedRequest(http.MethodPost, "/admin/ui/login", "", "ci", "secret", "n1", time.Now())
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	// a 401 from the login form, for the missing password, is past the limit
+	if rec.Code == http.StatusTooManyRequests || strings.Contains(rec.Body.String(), "signature") {
+		t.Errorf("signed caller: %d %s, want it past the ip's limit", rec.Code, rec.Body)
+	}
+}
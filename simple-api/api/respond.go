@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/iamskyy666/simple-api/errs"
+	"github.com/iamskyy666/simple-api/i18n"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/reqctx"
+	"github.com/iamskyy666/simple-api/serializer"
+	"github.com/iamskyy666/simple-api/store"
+	"golang.org/x/text/language"
+)
+
+const maxBodyBytes = 1 << 20 // 1MB is plenty for a user payload; routes can take more (route.maxBody)
+
+type errorBody struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// writeJSON is for responses that are json whatever the client asks for
+// (probes, batches, admin); api resources go through writeBody.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	writeAs(w, status, serializer.JSON, v)
+}
+
+// writeBody encodes v in the format the client's Accept picks (see package
+// serializer).
+func writeBody(w http.ResponseWriter, r *http.Request, status int, v any) {
+	writeAs(w, status, format(w, r, v), v)
+}
+
+func writeAs(w http.ResponseWriter, status int, f *serializer.Format, v any) {
+	w.Header()["Content-Type"] = f.ContentType
+	w.WriteHeader(status)
+	if err := f.Encode(w, v); err != nil {
+		// headers are gone already, all we can do is log it
+		log.Println("⚠️ ERR: encoding response:", err)
+	}
+}
+
+// format negotiates the format to send v in, saying so in Vary once there's
+// more than one to choose from. an Accept that rules everything out still
+// gets json, as before there was a choice.
+func format(w http.ResponseWriter, r *http.Request, v any) *serializer.Format {
+	if !serializer.Plural() {
+		return serializer.JSON
+	}
+	if h := w.Header(); h["Vary"] == nil {
+		h["Vary"] = varyAccept
+	} else {
+		h.Add("Vary", "Accept")
+	}
+	f, _ := serializer.Negotiate(r.Header.Get("Accept"), v)
+	return f
+}
+
+// varyAccept is shared like serializer.Format.ContentType, for the same reason.
+var varyAccept = []string{"Accept"}
+
+// writeError sends msg in the client's language (see package i18n) - msg is
+// the english text, which is also the catalog key.
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	tag := lang(w, r)
+	writeBody(w, r, status, errorBody{Error: i18n.T(tag, msg)})
+}
+
+// writeErrorf is writeError for messages with arguments; format is the key.
+func writeErrorf(w http.ResponseWriter, r *http.Request, status int, format string, args ...any) {
+	tag := lang(w, r)
+	writeBody(w, r, status, errorBody{Error: i18n.Sprintf(tag, format, args...)})
+}
+
+// lang negotiates the response language from Accept-Language and says so in
+// Content-Language (and Vary, for caches).
+func lang(w http.ResponseWriter, r *http.Request) language.Tag {
+	tag := i18n.Match(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", tag.String())
+	w.Header().Add("Vary", "Accept-Language")
+	return tag
+}
+
+// conflictBody points the client at the resource that already has the value.
+type conflictBody struct {
+	Error    string `json:"error"`
+	Field    string `json:"field"`
+	Existing string `json:"existing"`
+}
+
+// statusOf is the one place errs kinds become http statuses.
+func statusOf(kind error) int {
+	switch kind {
+	case errs.NotFound:
+		return http.StatusNotFound
+	case errs.Conflict:
+		return http.StatusConflict
+	case errs.Invalid:
+		return http.StatusUnprocessableEntity
+	case errs.Unauthorized:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// fail answers with what err says went wrong, in the client's language:
+// the status from its kind, the detail from the concrete error where there
+// is one. errors outside package errs are logged and a plain 500.
+func fail(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		dup *store.DuplicateError
+		fe  models.FieldErrors
+		e   *errs.Error
+	)
+	switch {
+	case clientGone(r):
+		// whatever went wrong, there's nobody to tell
+		disconnected(r, "err", err)
+		w.WriteHeader(statusClientClosed)
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, r, http.StatusServiceUnavailable, "request timed out")
+	case errors.As(err, &dup):
+		existing := "/users/" + dup.ExistingID
+		w.Header().Set("Location", existing)
+		msg := i18n.Sprintf(lang(w, r), "%s already in use", dup.Field)
+		writeBody(w, r, http.StatusConflict, conflictBody{Error: msg, Field: dup.Field, Existing: existing})
+	case errors.As(err, &fe):
+		tag := lang(w, r)
+		fields := make(map[string]string, len(fe))
+		for k, msg := range fe {
+			fields[k] = i18n.T(tag, msg)
+		}
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody{Error: i18n.T(tag, "validation failed"), Fields: fields})
+	case errors.As(err, &e):
+		if e.Err != nil {
+			reqctx.Logger(r.Context()).Warn("request failed", "err", err, "path", r.URL.Path)
+		}
+		writeErrorf(w, r, statusOf(e.Kind), e.Format, e.Args...)
+	default:
+		log.Println("⚠️ ERR:", err)
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// failMessage is fail's message for err, for where a failure is one entry
+// of a response rather than all of it (undo's per-user results). what isn't
+// a client's business is logged and said to be an internal error.
+func failMessage(r *http.Request, tag language.Tag, err error) string {
+	var (
+		dup *store.DuplicateError
+		fe  models.FieldErrors
+		e   *errs.Error
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return i18n.T(tag, "request timed out")
+	case errors.As(err, &dup):
+		return i18n.Sprintf(tag, "%s already in use", dup.Field)
+	case errors.As(err, &fe):
+		return i18n.T(tag, "validation failed")
+	case errors.As(err, &e):
+		if e.Err != nil {
+			reqctx.Logger(r.Context()).Warn("request failed", "err", err, "path", r.URL.Path)
+		}
+		return i18n.Sprintf(tag, e.Format, e.Args...)
+	}
+	log.Println("⚠️ ERR:", err)
+	return i18n.T(tag, "internal error")
+}
+
+// bind decodes the body into dst with the codec its Content-Type names,
+// json for a type that isn't registered (or none).
+func bind(w http.ResponseWriter, r *http.Request, dst any) error {
+	f, ok := serializer.Lookup(r.Header.Get("Content-Type"))
+	if !ok {
+		f = serializer.JSON
+	}
+	return bindAs(w, r, f, dst)
+}
+
+// bindJSON is bind for bodies that are json whatever they say they are.
+func bindJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	return bindAs(w, r, serializer.JSON, dst)
+}
+
+// bindAs decodes exactly one value from the body into dst; the codecs are
+// strict (see serializer.Codec), so typos and mangled payloads don't get
+// silently "fixed" on the way in.
+func bindAs(w http.ResponseWriter, r *http.Request, f *serializer.Format, dst any) error {
+	// the route caps the body (see bounded), so reading it whole is cheap -
+	// and lets the codec check the encoding first
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return fmt.Errorf("body must not be larger than %d bytes", maxErr.Limit)
+		}
+		return fmt.Errorf("reading body: %w", err)
+	}
+	return f.Decode(body, dst)
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// resource history:
+//
+//	GET /users/{id}/revisions         every revision still kept, oldest first
+//	GET /users/{id}/revisions/{a}..{b} what changed from revision a to b
+//
+// revisions come from store.WithRevisions and live in the backend next to the
+// users (in memory for STORAGE=memory): cfg.RevisionsKept per user, none
+// older than cfg.RevisionsMaxAge bar the newest. a deleted user keeps only
+// what it was when it went.
+
+type revisionMeta struct {
+	Rev int       `json:"rev"`
+	Op  string    `json:"op"`
+	At  time.Time `json:"at"`
+}
+
+type fieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type revisionDiff struct {
+	ID      string        `json:"id"`
+	From    revisionMeta  `json:"from"`
+	To      revisionMeta  `json:"to"`
+	Changes []fieldChange `json:"changes"`
+}
+
+func meta(rev store.Revision) revisionMeta {
+	return revisionMeta{Rev: rev.Rev, Op: rev.Op, At: rev.At}
+}
+
+// userSubresource is GET /users/{id}/{sub}. the mux can't take
+// /users/{id}/revisions next to /users/by-email/{email} (both would match
+// /users/by-email/revisions), so the last segment is matched here.
+func (s *Server) userSubresource(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("sub") {
+	case "revisions":
+		s.listRevisions(w, r)
+	default:
+		writeError(w, r, http.StatusNotFound, "not found")
+	}
+}
+
+// history resolves the path id (legacy ids only while the user exists) and
+// returns its revisions. it writes the error itself.
+func (s *Server) history(w http.ResponseWriter, r *http.Request) (string, []store.Revision, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return "", nil, false
+	}
+	if _, legacy := ids.Legacy(id); legacy {
+		u, err := s.store.GetUser(r.Context(), id)
+		if err != nil {
+			fail(w, r, err)
+			return "", nil, false
+		}
+		id = u.ID
+	} else {
+		id = ids.Canonical(id)
+	}
+	revs, err := s.revisions.Revisions(r.Context(), id)
+	if err != nil {
+		fail(w, r, err)
+		return "", nil, false
+	}
+	if len(revs) == 0 {
+		// nothing recorded: a user from before revisions were kept has no
+		// history yet, one that never existed is a 404
+		if _, err := s.store.GetUser(r.Context(), id); err != nil {
+			fail(w, r, err)
+			return "", nil, false
+		}
+	}
+	return id, revs, true
+}
+
+func (s *Server) listRevisions(w http.ResponseWriter, r *http.Request) {
+	_, revs, ok := s.history(w, r)
+	if !ok {
+		return
+	}
+	if revs == nil {
+		revs = []store.Revision{}
+	}
+	writeBody(w, r, http.StatusOK, revs)
+}
+
+func (s *Server) diffRevisions(w http.ResponseWriter, r *http.Request) {
+	a, b, ok := parseRevRange(r.PathValue("range"))
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "revision range must be a..b")
+		return
+	}
+	id, revs, ok := s.history(w, r)
+	if !ok {
+		return
+	}
+	find := func(n int) (store.Revision, bool) {
+		i := slices.IndexFunc(revs, func(rev store.Revision) bool { return rev.Rev == n })
+		if i < 0 {
+			return store.Revision{}, false
+		}
+		return revs[i], true
+	}
+	from, ok1 := find(a)
+	to, ok2 := find(b)
+	if !ok1 || !ok2 {
+		writeError(w, r, http.StatusNotFound, "revision not found")
+		return
+	}
+	writeBody(w, r, http.StatusOK, revisionDiff{ID: id, From: meta(from), To: meta(to), Changes: diffUsers(from.User, to.User)})
+}
+
+// parseRevRange reads "a..b"; a may be after b, the diff just goes backwards.
+func parseRevRange(raw string) (int, int, bool) {
+	as, bs, ok := strings.Cut(raw, "..")
+	if !ok {
+		return 0, 0, false
+	}
+	a, err1 := strconv.Atoi(as)
+	b, err2 := strconv.Atoi(bs)
+	if err1 != nil || err2 != nil || a < 1 || b < 1 {
+		return 0, 0, false
+	}
+	return a, b, true
+}
+
+// diffUsers compares the json representations, field by field, so the diff
+// speaks the same names and formats as the rest of the api.
+func diffUsers(a, b models.User) []fieldChange {
+	am, bm := asMap(a), asMap(b)
+	fields := make([]string, 0, len(am)+len(bm))
+	for k := range am {
+		fields = append(fields, k)
+	}
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	slices.Sort(fields)
+
+	changes := []fieldChange{}
+	for _, f := range fields {
+		if !reflect.DeepEqual(am[f], bm[f]) {
+			changes = append(changes, fieldChange{Field: f, From: am[f], To: bm[f]})
+		}
+	}
+	return changes
+}
+
+func asMap(u models.User) map[string]any {
+	raw, _ := json.Marshal(u) // a plain struct, can't fail
+	var m map[string]any
+	json.Unmarshal(raw, &m)
+	return m
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// TestRevisionsPersist: a backend that keeps its own revisions has them
+// after a restart and numbers on from there; only the newest few are kept,
+// pruning spares a live user's newest, and a delete leaves just the last
+// state until that is pruned too.
+func TestRevisionsPersist(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.db")
+	open := func() (*Server, *store.Bolt) {
+		t.Helper()
+		b, err := store.OpenBolt(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := config.FromEnv()
+		cfg.RevisionsKept = 2
+		s, err := New(cfg, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s, b
+	}
+	history := func(s *Server, id string) []int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/"+id+"/revisions", nil))
+		if rec.Code == http.StatusNotFound {
+			return nil
+		}
+		var revs []store.Revision
+		if err := json.Unmarshal(rec.Body.Bytes(), &revs); err != nil {
+			t.Fatalf("%d %s", rec.Code, rec.Body)
+		}
+		var nums []int
+		for _, rev := range revs {
+			nums = append(nums, rev.Rev)
+		}
+		return nums
+	}
+	rename := func(s *Server, u models.User, name string) {
+		t.Helper()
+		u.Name = name
+		if _, err := s.store.UpdateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, b := open()
+	u, err := s.store.CreateUser(ctx, models.User{Name: "Ada", Email: "ada@example.com", Role: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rename(s, u, "Ada L")
+	rename(s, u, "Ada Lovelace")
+	if got := history(s, u.ID); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("with REVISIONS_KEPT=2: revisions %v, want [2 3]", got)
+	}
+	b.Close()
+
+	s, b = open()
+	defer b.Close()
+	if got := history(s, u.ID); len(got) != 2 || got[1] != 3 {
+		t.Fatalf("after reopening: revisions %v, want [2 3]", got)
+	}
+	rename(s, u, "Countess")
+	if got := history(s, u.ID); len(got) != 2 || got[1] != 4 {
+		t.Fatalf("after reopening and updating: revisions %v, want [3 4]", got)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if n, err := s.revisions.PruneRevisions(ctx, later); err != nil || n != 1 {
+		t.Fatalf("prune: %d, %v; want the one older revision", n, err)
+	}
+	if got := history(s, u.ID); len(got) != 1 || got[0] != 4 {
+		t.Fatalf("after pruning: revisions %v, want [4]", got)
+	}
+
+	if err := s.store.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := history(s, u.ID); len(got) != 1 || got[0] != 5 {
+		t.Fatalf("after the delete: revisions %v, want [5]", got)
+	}
+	if n, err := s.revisions.PruneRevisions(ctx, later); err != nil || n != 1 {
+		t.Fatalf("prune after the delete: %d, %v", n, err)
+	}
+	if got := history(s, u.ID); got != nil {
+		t.Errorf("a deleted user's pruned history: %v, want a 404", got)
+	}
+}
+
+// TestUserSubresourceNotFound: an unknown /users/{id}/{sub} is the api's
+// json 404, not the mux's plain text one.
+func TestUserSubresourceNotFound(t *testing.T) {
+	s := newRouteServer(t, nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/01ARZ3NDEKTSV4RRFFQ69G5FAV/friends", nil))
+	var body errorBody
+	if rec.Code != http.StatusNotFound || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Error != "not found" {
+		t.Errorf("status %d, %s %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/iamskyy666/simple-api/metrics"
+	"github.com/iamskyy666/simple-api/web"
+)
+
+// the route table is the one list of what the server serves: each route's
+// handler, who may call it, how often, and what the docs call it. the mux is
+// built from it (routes), and so are the paths of the served openapi spec
+// (buildSpec) - openapi.json only has the parameters, bodies and responses
+// of each operation, and one without a route here is a bug.
+
+// role is who may call a route.
+type role int
+
+const (
+	roleAnyone    role = iota
+	roleLifecycle      // the lifecycle token: the orchestrator, scripts
+	roleAdmin          // the lifecycle token or an admin ui session
+	roleSession        // an admin ui session; pages, so others are sent to log in
+)
+
+func (r role) String() string {
+	return [...]string{"anyone", "lifecycle", "admin", "session"}[r]
+}
+
+// rate is n requests per caller (see limitKey) every per. the zero rate is no
+// limit.
+type rate struct {
+	n   int
+	per time.Duration
+}
+
+type route struct {
+	pattern string // as the mux takes it, "GET /users/{id}"
+	handler http.HandlerFunc
+	role    role
+	limit   rate
+	doc     *doc // nil: not in the spec (the uis, admin, metrics)
+	off     bool // not served with this config
+	dryRun  bool // takes ?dry_run, which maintenance mode lets through
+
+	// overrides of the server-wide settings, zero for those
+	maxBody  int64         // request body cap, maxBodyBytes
+	timeout  time.Duration // cfg.RequestTimeout; noTimeout for none
+	unsigned bool          // served without a signature even with REQUIRE_SIGNATURE
+}
+
+const noTimeout time.Duration = -1
+
+// doc is what the spec says about a route beside openapi.json's details.
+type doc struct {
+	id      string // operationId
+	summary string
+	path    string // the spec's path, when it isn't the pattern's
+}
+
+// routeTable is every route, in the order the spec lists them. limits are
+// for what's expensive or guessable; everything else has the monthly quota.
+func (s *Server) routeTable() []route {
+	cfg := s.cfg
+	return []route{
+		{pattern: "GET /users", handler: s.listUsers, doc: &doc{id: "listUsers", summary: "List users"}},
+		{pattern: "POST /users", handler: s.createUser, dryRun: true, doc: &doc{id: "createUser", summary: "Create a user"}},
+		{pattern: "DELETE /users", handler: s.deleteUsers, limit: rate{10, time.Minute}, dryRun: true,
+			doc: &doc{id: "deleteUsers", summary: "Delete the users matching a filter"}},
+		{pattern: "GET /users/changes", handler: s.userChanges, timeout: noTimeout, // LONG_POLL_TIMEOUT bounds it
+			doc: &doc{id: "userChanges", summary: "Follow changes to users"}},
+		{pattern: "GET /users/export", handler: s.exportUsers, limit: rate{6, time.Minute}, timeout: 10 * time.Minute,
+			doc: &doc{id: "exportUsers", summary: "Export users as ndjson"}},
+		{pattern: "POST /users/import", handler: s.importUsers, limit: rate{6, time.Minute}, maxBody: importMaxBytes, timeout: 10 * time.Minute,
+			doc: &doc{id: "importUsers", summary: "Import users from ndjson"}},
+		{pattern: "GET /users/search", handler: s.searchUsers, off: s.search == nil,
+			doc: &doc{id: "searchUsers", summary: "Search users by name and email"}},
+		{pattern: "GET /users/by-email/{email}", handler: s.getUserByEmail, doc: &doc{id: "getUserByEmail", summary: "Get a user by email"}},
+		{pattern: "GET /users/{id}", handler: s.getUser, doc: &doc{id: "getUser", summary: "Get a user"}},
+		{pattern: "PUT /users/{id}", handler: s.updateUser, dryRun: true, doc: &doc{id: "updateUser", summary: "Update a user"}},
+		{pattern: "DELETE /users/{id}", handler: s.deleteUser, doc: &doc{id: "deleteUser", summary: "Delete a user"}},
+		// /users/{id}/revisions would clash with /users/by-email/{email}
+		{pattern: "GET /users/{id}/{sub}", handler: s.userSubresource,
+			doc: &doc{id: "listRevisions", summary: "List a user's revisions", path: "/users/{id}/revisions"}},
+		{pattern: "GET /users/{id}/revisions/{range}", handler: s.diffRevisions,
+			doc: &doc{id: "diffRevisions", summary: "Diff two revisions of a user"}},
+		{pattern: "POST /undo/{token}", handler: s.undo, off: s.trash == nil, doc: &doc{id: "undo", summary: "Undo a delete"}},
+
+		{pattern: "GET /usage", handler: s.getUsage, doc: &doc{id: "getUsage", summary: "The caller's usage this month"}},
+		{pattern: "POST /batch", handler: s.batch, limit: rate{60, time.Minute},
+			doc: &doc{id: "batch", summary: "Run several requests in one"}},
+		{pattern: "GET /openapi.json", handler: s.openAPI, unsigned: true},
+		{pattern: "GET /version", handler: s.version, unsigned: true, doc: &doc{id: "version", summary: "Build and api version"}},
+		{pattern: "GET /metrics", handler: metrics.Handler().ServeHTTP, unsigned: true},
+		{pattern: "GET /healthz", handler: s.healthz, unsigned: true, doc: &doc{id: "healthz", summary: "Liveness probe"}},
+		{pattern: "GET /readyz", handler: s.readyz, unsigned: true, doc: &doc{id: "readyz", summary: "Readiness probe"}},
+		{pattern: "GET /status", handler: s.getStatus, unsigned: true, doc: &doc{id: "getStatus", summary: "Service status, dependency history and incidents"}},
+		{pattern: "POST /quitquitquit", handler: s.quitquitquit, role: roleLifecycle, unsigned: true, off: cfg.LifecycleToken == ""},
+		{pattern: "GET /admin/maintenance", handler: s.getMaintenance, role: roleAdmin, unsigned: true, off: cfg.LifecycleToken == "" && cfg.AdminPassword == ""},
+		{pattern: "PUT /admin/maintenance", handler: s.putMaintenance, role: roleAdmin, unsigned: true, off: cfg.LifecycleToken == "" && cfg.AdminPassword == ""},
+		{pattern: "GET /admin/stats", handler: s.getStats, role: roleAdmin, unsigned: true, off: s.stats == nil},
+		{pattern: "POST /admin/incidents", handler: s.openIncident, role: roleAdmin, unsigned: true, off: cfg.LifecycleToken == "" && cfg.AdminPassword == ""},
+		{pattern: "PUT /admin/incidents/{id}", handler: s.updateIncident, role: roleAdmin, unsigned: true, off: cfg.LifecycleToken == "" && cfg.AdminPassword == ""},
+		{pattern: "DELETE /admin/incidents/{id}", handler: s.resolveIncident, role: roleAdmin, unsigned: true, off: cfg.LifecycleToken == "" && cfg.AdminPassword == ""},
+
+		// no password configured -> no admin ui, rather than an unprotected one
+		{pattern: "GET /admin/ui/login", handler: s.adminLoginForm, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "POST /admin/ui/login", handler: s.adminLogin, limit: rate{10, time.Minute}, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "POST /admin/ui/logout", handler: s.adminLogout, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "GET /admin/ui/{$}", handler: s.adminListUsers, role: roleSession, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "GET /admin/ui/users/new", handler: s.adminNewUser, role: roleSession, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "POST /admin/ui/users", handler: s.adminCreateUser, role: roleSession, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "GET /admin/ui/users/{id}/edit", handler: s.adminEditUser, role: roleSession, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "POST /admin/ui/users/{id}", handler: s.adminUpdateUser, role: roleSession, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "POST /admin/ui/users/{id}/delete", handler: s.adminDeleteUser, role: roleSession, unsigned: true, off: cfg.AdminPassword == ""},
+		{pattern: "GET /admin/requests", handler: s.listExchanges, role: roleSession, unsigned: true, off: cfg.AdminPassword == "" || len(cfg.DebugRecord) == 0},
+
+		// "/" is the least specific pattern, so the api routes always win
+		{pattern: "/", handler: SPA(web.Dist).ServeHTTP, unsigned: true, off: !cfg.ServeUI},
+	}
+}
+
+func (s *Server) routes() {
+	s.table = s.routeTable()
+	s.byPattern = make(map[string]route, len(s.table))
+	for _, rt := range s.table {
+		if !rt.off {
+			s.mux.Handle(rt.pattern, s.guard(rt))
+			s.byPattern[rt.pattern] = rt
+		}
+	}
+}
+
+// routeFor is the route the mux would send r to, for the middleware that
+// runs before it; false if none would take it.
+func (s *Server) routeFor(r *http.Request) (route, bool) {
+	_, pattern := s.mux.Handler(r)
+	rt, ok := s.byPattern[pattern]
+	return rt, ok
+}
+
+// guard wraps a route's handler in what its table entry asks for. the limit
+// goes before the role, so guessing at a token or password counts too.
+func (s *Server) guard(rt route) http.Handler {
+	var h http.Handler = rt.handler
+	switch rt.role {
+	case roleLifecycle:
+		h = s.requireToken(rt.handler)
+	case roleAdmin:
+		h = s.requireAdmin(rt.handler)
+	case roleSession:
+		h = s.requireSession(rt.handler)
+	}
+	if rt.limit.n > 0 {
+		h = s.rateLimit(rt.limit, h)
+	}
+	if s.cfg.RequireSignature && !rt.unsigned {
+		h = requireSigned(h)
+	}
+	timeout := cmp.Or(rt.timeout, s.cfg.RequestTimeout)
+	return bounded(h, cmp.Or(rt.maxBody, maxBodyBytes), timeout)
+}
+
+// bounded caps the request body at maxBody bytes, and the request's context
+// at timeout if that's positive.
+func bounded(next http.Handler, maxBody int64, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
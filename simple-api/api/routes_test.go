@@ -0,0 +1,139 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// TestRouteTable holds every served route to what its table entry says:
+// callers without the role are turned away, and limits hold.
+func TestRouteTable(t *testing.T) {
+	s := newRouteServer(t, nil)
+	for _, rt := range s.table {
+		if rt.off {
+			t.Errorf("%s is off with everything configured", rt.pattern)
+			continue
+		}
+		t.Run(rt.pattern, func(t *testing.T) {
+			serve := routeClient(s, rt)
+			if rt.role != roleAnyone {
+				if code := serve().Code; code != http.StatusForbidden && code != http.StatusSeeOther {
+					t.Errorf("without credentials: status %d", code)
+				}
+			}
+			if rt.limit.n > 0 {
+				// a window can end mid-loop, so allow for a second one
+				for range 2*rt.limit.n + 1 {
+					if rec := serve(); rec.Code == http.StatusTooManyRequests {
+						if rec.Header().Get("Retry-After") == "" {
+							t.Error("429 without Retry-After")
+						}
+						return
+					}
+				}
+				t.Errorf("never limited, at %d/%s", rt.limit.n, rt.limit.per)
+			}
+		})
+	}
+}
+
+// TestRouteSignatures: with REQUIRE_SIGNATURE, exactly the routes that
+// aren't marked unsigned want one.
+func TestRouteSignatures(t *testing.T) {
+	s := newRouteServer(t, func(cfg *config.Config) {
+		cfg.RequireSignature = true
+		cfg.SigningKeys = []string{"ci:secret"}
+	})
+	for _, rt := range s.table {
+		rec := routeClient(s, rt)()
+		wanted := rec.Code == http.StatusUnauthorized && strings.Contains(rec.Body.String(), "signature required")
+		if rt.unsigned == wanted {
+			t.Errorf("%s: unsigned %t, status %d: %s", rt.pattern, rt.unsigned, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestBounded(t *testing.T) {
+	var (
+		readErr  error
+		deadline bool
+	)
+	read := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+		_, deadline = r.Context().Deadline()
+	})
+	h := bounded(read, 4, time.Minute)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	var maxErr *http.MaxBytesError
+	if !errors.As(readErr, &maxErr) || !deadline {
+		t.Errorf("read %v, deadline %t", readErr, deadline)
+	}
+	h = bounded(read, 4, noTimeout)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1234")))
+	if readErr != nil || deadline {
+		t.Errorf("within bounds: read %v, deadline %t", readErr, deadline)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(rate{3, time.Minute})
+	now := time.Date(2026, 1, 1, 12, 0, 30, 0, time.UTC)
+	a, b := callerKey{"ip", "a"}, callerKey{"ip", "b"}
+	for i := 1; i <= 3; i++ {
+		if n, _, ok := l.take(a, now); !ok || n != i {
+			t.Fatalf("request %d: n %d, ok %t", i, n, ok)
+		}
+	}
+	if _, reset, ok := l.take(a, now); ok || !reset.Equal(now.Truncate(time.Minute).Add(time.Minute)) {
+		t.Errorf("4th request: ok %t, reset %v", ok, reset)
+	}
+	if _, _, ok := l.take(b, now); !ok {
+		t.Error("another caller is limited too")
+	}
+	if n, _, ok := l.take(a, now.Add(30*time.Second)); !ok || n != 1 {
+		t.Errorf("next window: n %d, ok %t", n, ok)
+	}
+}
+
+// newRouteServer has every route of the table on.
+func newRouteServer(t *testing.T, configure func(*config.Config)) *Server {
+	t.Helper()
+	cfg := config.FromEnv()
+	cfg.AdminPassword = "secret"
+	cfg.LifecycleToken = "token"
+	cfg.DebugRecord = []string{"/users"}
+	if configure != nil {
+		configure(&cfg)
+	}
+	s, err := New(cfg, store.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+var wildcard = regexp.MustCompile(`\{[^}]*\}`)
+
+// routeClient serves a bodyless request for rt's pattern, wildcards filled
+// with "x".
+func routeClient(s *Server, rt route) func() *httptest.ResponseRecorder {
+	method, path, ok := strings.Cut(rt.pattern, " ")
+	if !ok {
+		method, path = http.MethodGet, rt.pattern // "/" is any method
+	}
+	path = wildcard.ReplaceAllString(strings.ReplaceAll(path, "{$}", ""), "x")
+	return func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/errs"
+	"github.com/iamskyy666/simple-api/search"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// GET /users/search?q=...&limit=20 - relevance ranked, typo tolerant. the
+// index only knows ids; users are loaded from the store, so results are never
+// staler than the store itself (a hit deleted since it was indexed is dropped).
+
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+)
+
+type searchHit struct {
+	Score float64 `json:"score"`
+	User  any     `json:"user"` // userView
+}
+
+type searchResponse struct {
+	Query string      `json:"query"`
+	Hits  []searchHit `json:"hits"`
+}
+
+func (s *Server) searchUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, r, http.StatusBadRequest, "q is required")
+		return
+	}
+	limit := searchDefaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > searchMaxLimit {
+			writeErrorf(w, r, http.StatusBadRequest, "limit must be 1..%d", searchMaxLimit)
+			return
+		}
+		limit = n
+	}
+
+	hits, err := s.search.Search(r.Context(), q, limit)
+	if err != nil {
+		slog.Error("search failed", "err", err)
+		writeError(w, r, http.StatusBadGateway, "search is unavailable")
+		return
+	}
+	out := searchResponse{Query: q, Hits: make([]searchHit, 0, len(hits))}
+	for _, h := range hits {
+		u, err := s.store.GetUser(r.Context(), h.ID)
+		if errors.Is(err, errs.NotFound) {
+			continue
+		}
+		if err != nil {
+			fail(w, r, err)
+			return
+		}
+		out.Hits = append(out.Hits, searchHit{Score: h.Score, User: s.userView(r, u)})
+	}
+	writeBody(w, r, http.StatusOK, out)
+}
+
+// openSearch opens the configured index and fills it from st.
+func openSearch(cfg config.Config, st store.Storage) (search.Index, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var (
+		idx search.Index
+		err error
+	)
+	switch cfg.Search {
+	case "bleve":
+		idx, err = search.OpenBleve(cfg.SearchPath)
+	case "elasticsearch":
+		idx, err = search.OpenElastic(ctx, cfg.ElasticURL, cfg.ElasticIndex)
+	default:
+		return nil, fmt.Errorf("unknown SEARCH %q (want bleve, elasticsearch or off)", cfg.Search)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+
+	start := time.Now()
+	n, err := search.Rebuild(ctx, st, idx)
+	if err != nil {
+		idx.Close()
+		return nil, fmt.Errorf("search: rebuilding index: %w", err)
+	}
+	slog.Info("search: index ready", "backend", cfg.Search, "users", n, "took", time.Since(start))
+	return idx, nil
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/iamskyy666/simple-api/chaos"
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/search"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// Server wires config, storage and routes together. it's a plain http.Handler,
+// so main can hand it to http.Server (and http2) as-is.
+type Server struct {
+	cfg         config.Config
+	store       store.Storage
+	mux         *http.ServeMux
+	table       []route // see routes.go
+	byPattern   map[string]route
+	spec        encoded // openapi.json, paths from the table
+	sessions    *sessions
+	changes     *store.ChangeFeed
+	life        *lifecycle
+	pools       *poolWatch   // sql backends only, see /readyz
+	search      search.Index // nil with SEARCH=off
+	usage       *usage
+	maintenance *maintenance
+	trash       *trash // nil with UNDO_WINDOW=0
+	revisions   store.RevisionLog
+	userBodies  *userBodies // encoded users, see writeUser
+
+	signingKeys map[string][]byte            // key id -> secret, see verifySignature
+	apiKeys     map[[sha256.Size]byte]string // sha256 of an X-Api-Key -> its name, see caller
+	nonces      *nonces
+	certRules   []certRule // client cert -> identity, see clientIdentity
+
+	anomalies *anomalies   // nil with ANOMALY_WINDOW=0
+	stats     *liveStats   // for /admin/stats, nil without an admin
+	status    *statusBoard // GET /status
+	exchanges *exchangeLog // debug recording, nil unless cfg.DebugRecord is set
+	handler   http.Handler // mux + middleware
+}
+
+// CheckConfig runs the parts of New that can reject cfg - the signing and
+// api keys and the client cert map - without building a server (main's
+// --check).
+func CheckConfig(cfg config.Config) error {
+	_, keysErr := parseSigningKeys(cfg.SigningKeys)
+	_, apiKeysErr := parseAPIKeys(cfg.APIKeys)
+	_, certErr := parseCertMap(cfg.ClientCertMap)
+	return errors.Join(keysErr, apiKeysErr, certErr)
+}
+
+// New builds the server. it fails only on config it can't make sense of.
+func New(cfg config.Config, st store.Storage) (*Server, error) {
+	// every write goes through the feed wrapper, whichever transport it came from
+	backend := store.Instrument(st, cfg.SlowQuery)
+	// memory and bolt answer a read faster than singleflight can set one up
+	// (see bench: HotPathGetUser), so only the networked backends coalesce
+	if cfg.CoalesceReads && (cfg.Storage == "postgres" || cfg.Storage == "mongo") {
+		backend = store.Coalesce(backend, cfg.CoalesceTimeout)
+	}
+	var idx search.Index
+	if cfg.Search != "off" {
+		var err error
+		if idx, err = openSearch(cfg, backend); err != nil {
+			return nil, err
+		}
+		backend = search.WithIndex(backend, idx)
+	}
+	revs, ok := st.(store.RevisionLog)
+	if !ok {
+		revs = store.NewRevisions()
+	}
+	backend = store.WithRevisions(backend, revs, cfg.RevisionsKept)
+	feed := store.NewChangeFeed(cfg.ChangeFeedSize)
+	s := &Server{
+		cfg:         cfg,
+		store:       store.WithChangeFeed(backend, feed),
+		revisions:   revs,
+		search:      idx,
+		mux:         http.NewServeMux(),
+		sessions:    newSessions(cfg.SessionTTL),
+		changes:     feed,
+		life:        newLifecycle(),
+		usage:       newUsage(cfg.MonthlyQuota),
+		maintenance: newMaintenance(cfg.Maintenance),
+		userBodies:  newUserBodies(),
+	}
+	keys, err := parseSigningKeys(cfg.SigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RequireSignature && len(keys) == 0 {
+		return nil, errors.New("REQUIRE_SIGNATURE is set but SIGNING_KEYS is empty - nobody could call the api")
+	}
+	s.signingKeys, s.nonces = keys, newNonces()
+	if s.apiKeys, err = parseAPIKeys(cfg.APIKeys); err != nil {
+		return nil, err
+	}
+	if s.certRules, err = parseCertMap(cfg.ClientCertMap); err != nil {
+		return nil, err
+	}
+	if cfg.UndoWindow > 0 {
+		s.trash = newTrash(cfg.UndoWindow)
+	}
+	if p, ok := st.(store.Pools); ok {
+		s.pools = newPoolWatch(p.Pools(), cfg.DBPoolExhaustedFor)
+	}
+	s.status = newStatusBoard(cfg.StatusHistory)
+	s.addStatusChecks(st)
+	if cfg.LifecycleToken != "" || cfg.AdminPassword != "" {
+		s.stats = &liveStats{} // only admins can see it
+	}
+	if cfg.AnomalyWindow > 0 {
+		s.anomalies = newAnomalies(cfg.AnomalyWindow, cfg.AnomalyFactor, cfg.AnomalyMinRequests, cfg.AnomalyWebhook, cfg.AnomalyWebhookSecret)
+	}
+	s.routes()
+	s.spec = buildSpec(s.table)
+
+	// middleware, innermost first
+	s.handler = s.mux
+	if s.anomalies != nil || s.stats != nil {
+		s.handler = s.observe(s.handler) // needs the mux's own request, see there
+	}
+	s.handler = s.maintenanceGate(s.meter(s.handler)) // turned away writes aren't metered
+	if len(s.signingKeys) > 0 {
+		s.handler = s.verifySignature(s.handler) // outside meter: signed callers are metered by key
+	}
+	if cfg.ClientAuth != "off" {
+		s.handler = s.clientIdentity(s.handler)
+	}
+	if cfg.DatabaseReadURL != "" && cfg.ReadYourWrites > 0 {
+		s.handler = s.readYourWrites(s.handler)
+	}
+	if cfg.Chaos != "" {
+		if cfg.IsProd() {
+			return nil, errors.New("CHAOS is set but APP_ENV=prod - refusing to inject faults in production")
+		}
+		rules, err := chaos.Parse(cfg.Chaos)
+		if err != nil {
+			return nil, err
+		}
+		slog.Warn("chaos: fault injection enabled", "rules", cfg.Chaos)
+		s.handler = chaos.Middleware(rules, s.handler)
+	}
+	// recording sits outside chaos so injected failures show up in /admin/requests
+	if len(cfg.DebugRecord) > 0 {
+		s.exchanges = newExchangeLog(cfg.DebugRecordSize)
+		s.handler = s.recordExchanges(s.handler)
+	}
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const sessionCookie = "admin_session"
+
+// sessions is a tiny in-process session table for the admin ui.
+// tokens are random and opaque - nothing about the user lives in the cookie.
+type sessions struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	m   map[string]time.Time // token -> expiry
+}
+
+func newSessions(ttl time.Duration) *sessions {
+	return &sessions{ttl: ttl, m: map[string]time.Time{}}
+}
+
+func (s *sessions) create() (string, time.Time) {
+	b := make([]byte, 32)
+	rand.Read(b) // never returns an error (crypto/rand docs)
+	token := hex.EncodeToString(b)
+	exp := time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	s.m[token] = exp
+	s.mu.Unlock()
+	return token, exp
+}
+
+// valid reports whether token is live, sliding its expiry forward if so.
+func (s *sessions) valid(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.m[token]
+	if !ok {
+		return false
+	}
+	if time.Now().After(exp) {
+		delete(s.m, token)
+		return false
+	}
+	s.m[token] = time.Now().Add(s.ttl)
+	return true
+}
+
+func (s *sessions) destroy(token string) {
+	s.mu.Lock()
+	delete(s.m, token)
+	s.mu.Unlock()
+}
+
+// purge drops expired sessions; valid only notices the ones that come back.
+func (s *sessions) purge(ctx context.Context) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, exp := range s.m {
+		if now.After(exp) {
+			delete(s.m, token)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/errs"
+	"github.com/iamskyy666/simple-api/reqctx"
+)
+
+// request signing, for server-to-server callers that share a secret with us
+// (cfg.SigningKeys, "id:secret" pairs). a signed request carries
+//
+//	X-Signature-Key:       the key id
+//	X-Signature-Timestamp: unix seconds
+//	X-Signature-Nonce:     unique per request
+//	X-Signature:           hex HMAC-SHA256 of stringToSign
+//
+// and, on routes that take bodies over maxBodyBytes (imports),
+// X-Signature-Content-SHA256: the hex sha256 stringToSign has for the body.
+// the signature is checked against that before a byte of the body is read;
+// then the body is spooled to a temp file and checked against it, and only a
+// body that matches reaches the route. elsewhere the header is ignored and
+// the body read and hashed up front, up to maxBodyBytes or the route's own cap
+// if that's less.
+//
+// a timestamp outside cfg.SignatureSkew, or a nonce already seen with the
+// same key inside that window, is rejected - so a captured request can't be
+// replayed. signed requests count against "hmac:<key id>" in GET /usage.
+//
+// with cfg.RequireSignature, unsigned requests to the api get 401; otherwise
+// signing is optional but a bad signature still fails.
+
+// signedKey holds the key id a request was verified with. sub-requests of a
+// signed batch inherit it through the context.
+var signedKey = reqctx.NewKey[string]("signed by")
+
+func signedBy(ctx context.Context) (string, bool) { return signedKey.Get(ctx) }
+
+// parseSigningKeys reads "id:secret" pairs.
+func parseSigningKeys(pairs []string) (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(pairs))
+	for _, p := range pairs {
+		id, secret, ok := strings.Cut(p, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("SIGNING_KEYS: want id:secret, got %q", redactPair(p))
+		}
+		keys[id] = []byte(secret)
+	}
+	return keys, nil
+}
+
+// redactPair keeps the id (if there is one) for the error message.
+func redactPair(p string) string {
+	if id, _, ok := strings.Cut(p, ":"); ok {
+		return id + ":***"
+	}
+	return "***"
+}
+
+// stringToSign is what the signature covers: everything that changes what
+// the request does. bodySum is the body's hex sha256.
+func stringToSign(ts, nonce, method, uri, bodySum string) string {
+	return ts + "\n" + nonce + "\n" + method + "\n" + uri + "\n" + bodySum
+}
+
+func bodySum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func sign(secret []byte, msg string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// nonces remembers recently used nonces until their timestamp would be
+// rejected anyway.
+type nonces struct {
+	mu sync.Mutex
+	m  map[string]time.Time // key id + nonce -> expiry
+}
+
+func newNonces() *nonces { return &nonces{m: map[string]time.Time{}} }
+
+// use records nonce, reporting false if it's still remembered.
+func (n *nonces) use(nonce string, exp time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if old, ok := n.m[nonce]; ok && time.Now().Before(old) {
+		return false
+	}
+	n.m[nonce] = exp
+	return true
+}
+
+func (n *nonces) purge(ctx context.Context) error {
+	now := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for nonce, exp := range n.m {
+		if now.After(exp) {
+			delete(n.m, nonce)
+		}
+	}
+	return nil
+}
+
+// requireSigned turns away what verifySignature didn't vouch for. it's per
+// route (see route.unsigned): RequireSignature covers the api, not probes or
+// the uis.
+func requireSigned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := signedBy(r.Context()); !ok {
+			unauthorized(w, r, "signature required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) verifySignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := signedBy(r.Context()); ok {
+			next.ServeHTTP(w, r) // batch sub-request, the batch was verified
+			return
+		}
+		sig := r.Header.Get("X-Signature")
+		if sig == "" {
+			next.ServeHTTP(w, r) // requireSigned's call, once the route is known
+			return
+		}
+
+		id := r.Header.Get("X-Signature-Key")
+		secret, ok := s.signingKeys[id]
+		if !ok {
+			unauthorized(w, r, "unknown signing key")
+			return
+		}
+		ts := r.Header.Get("X-Signature-Timestamp")
+		nonce := r.Header.Get("X-Signature-Nonce")
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || nonce == "" {
+			unauthorized(w, r, "invalid signature")
+			return
+		}
+		at := time.Unix(unix, 0)
+		if d := time.Since(at); d > s.cfg.SignatureSkew || d < -s.cfg.SignatureSkew {
+			unauthorized(w, r, "signature expired")
+			return
+		}
+
+		rt, _ := s.routeFor(r)
+		claimed := r.Header.Get("X-Signature-Content-SHA256")
+		spooled := claimed != "" && rt.maxBody > maxBodyBytes
+		var sum string
+		if spooled {
+			if sum, ok = claimedSum(claimed); !ok {
+				writeError(w, r, http.StatusBadRequest, "invalid X-Signature-Content-SHA256")
+				return
+			}
+		} else if sum, ok = readSigned(w, r, rt); !ok {
+			return
+		}
+		want := sign(secret, stringToSign(ts, nonce, r.Method, r.URL.RequestURI(), sum))
+		if !hmac.Equal([]byte(sig), []byte(want)) {
+			unauthorized(w, r, "invalid signature")
+			return
+		}
+		// checked after the signature, so junk requests can't burn someone
+		// else's nonces, and before spooling, so a replay can't make us
+		if !s.nonces.use(id+"\x00"+nonce, at.Add(s.cfg.SignatureSkew)) {
+			unauthorized(w, r, "replayed nonce")
+			return
+		}
+		if spooled {
+			f, ok := spoolSigned(w, r, rt.maxBody, sum)
+			if !ok {
+				return
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+			r.Body = f
+		}
+		next.ServeHTTP(w, r.WithContext(signedKey.Set(r.Context(), id)))
+	})
+}
+
+// claimedSum normalises an X-Signature-Content-SHA256 value to the hex
+// stringToSign takes.
+func claimedSum(claimed string) (string, bool) {
+	sum, err := hex.DecodeString(claimed)
+	if err != nil || len(sum) != sha256.Size {
+		return "", false
+	}
+	return hex.EncodeToString(sum), true
+}
+
+// spoolSigned copies r's body, up to maxBody, to a temp file and returns it
+// rewound if its sha256 is sum - the route doesn't see a byte of a body that
+// isn't the one signed. it writes the error itself; the caller removes the
+// file.
+func spoolSigned(w http.ResponseWriter, r *http.Request, maxBody int64, sum string) (*os.File, bool) {
+	f, err := os.CreateTemp("", "signed-body-*")
+	if err != nil {
+		fail(w, r, fmt.Errorf("spooling signed body: %w", err))
+		return nil, false
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), http.MaxBytesReader(w, r.Body, maxBody))
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	switch {
+	case err != nil:
+		bodyFailed(w, r, err, false)
+	case hex.EncodeToString(h.Sum(nil)) != sum:
+		writeError(w, r, http.StatusBadRequest, "body does not match X-Signature-Content-SHA256")
+	default:
+		return f, true
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil, false
+}
+
+// readSigned reads r's body up front, up to rt's cap or maxBodyBytes if
+// that's less, and returns its sum. it writes the error itself.
+func readSigned(w http.ResponseWriter, r *http.Request, rt route) (string, bool) {
+	limit := int64(maxBodyBytes)
+	if rt.maxBody > 0 {
+		limit = min(rt.maxBody, limit)
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		bodyFailed(w, r, err, rt.maxBody > maxBodyBytes)
+		return "", false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return bodySum(body), true
+}
+
+// bodyFailed answers a signed body that couldn't be read: 413 only if it was
+// too big. spoolable says the route would take it with
+// X-Signature-Content-SHA256.
+func bodyFailed(w http.ResponseWriter, r *http.Request, err error, spoolable bool) {
+	var maxErr *http.MaxBytesError
+	switch {
+	case clientGone(r):
+		fail(w, r, err)
+	case errors.As(err, &maxErr) && spoolable:
+		writeErrorf(w, r, http.StatusRequestEntityTooLarge, "signed bodies over %d bytes need X-Signature-Content-SHA256", maxErr.Limit)
+	case errors.As(err, &maxErr):
+		writeErrorf(w, r, http.StatusRequestEntityTooLarge, "body must not be larger than %d bytes", maxErr.Limit)
+	default:
+		writeError(w, r, http.StatusBadRequest, "could not read body")
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", "HMAC-SHA256")
+	fail(w, r, errs.New(errs.Unauthorized, msg))
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// signedRequest signs a request the way a client with secret would.
+func signedRequest(method, uri, body, key, secret, nonce string, at time.Time) *http.Request {
+	req := httptest.NewRequest(method, uri, strings.NewReader(body))
+	ts := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set("X-Signature-Key", key)
+	req.Header.Set("X-Signature-Timestamp", ts)
+	req.Header.Set("X-Signature-Nonce", nonce)
+	req.Header.Set("X-Signature", sign([]byte(secret), stringToSign(ts, nonce, method, uri, bodySum([]byte(body)))))
+	return req
+}
+
+// signedStream signs a request by the body sum it claims in
+// X-Signature-Content-SHA256, whatever the body is.
+func signedStream(method, uri string, body io.Reader, sum, key, secret, nonce string, at time.Time) *http.Request {
+	req := httptest.NewRequest(method, uri, body)
+	ts := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set("X-Signature-Key", key)
+	req.Header.Set("X-Signature-Timestamp", ts)
+	req.Header.Set("X-Signature-Nonce", nonce)
+	req.Header.Set("X-Signature-Content-SHA256", sum)
+	req.Header.Set("X-Signature", sign([]byte(secret), stringToSign(ts, nonce, method, uri, sum)))
+	return req
+}
+
+type brokenBody struct{}
+
+func (brokenBody) Read([]byte) (int, error) { return 0, errors.New("unexpected EOF") }
+
+// TestSignedBodies: a signed body is read up front only up to the route's
+// cap or maxBodyBytes; bigger ones are spooled and checked against the sum
+// they're signed with before the route sees them, and only an oversized body
+// is a 413.
+func TestSignedBodies(t *testing.T) {
+	s := newRouteServer(t, func(cfg *config.Config) {
+		cfg.SigningKeys = []string{"ci:secret"}
+		cfg.Search = "off" // the import is big enough to make indexing it slow
+	})
+	now := time.Now()
+	big := strings.Repeat("x", maxBodyBytes+1)
+	var rows strings.Builder
+	for i := range 20000 { // over maxBodyBytes
+		fmt.Fprintf(&rows, `{"name": "user %d %s", "email": "user%d@example.com"}`+"\n", i, strings.Repeat("p", 40), i)
+	}
+	user := `{"name": "Ada", "email": "ada@example.com"}`
+
+	gone, hangUp := context.WithCancel(context.Background())
+	hangUp()
+	hungUp := signedRequest("POST", "/users", user, "ci", "secret", "n6", now).WithContext(gone)
+	hungUp.Body = io.NopCloser(brokenBody{})
+	broken := signedRequest("POST", "/users", user, "ci", "secret", "n7", now)
+	broken.Body = io.NopCloser(brokenBody{})
+
+	// a forged body under a genuine signature: turned away before the
+	// import writes a row
+	forged := strings.Replace(rows.String(), "user 0 ", "evil 0 ", 1)
+	req := signedStream("POST", "/users/import", strings.NewReader(forged), bodySum([]byte(rows.String())), "ci", "secret", "n4", now)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "does not match") {
+		t.Errorf("forged import: status %d: %.200s", rec.Code, rec.Body)
+	}
+	if users, err := s.store.ListUsers(context.Background(), store.Filter{}); err != nil || len(users) != 0 {
+		t.Fatalf("forged import left %d users (%v)", len(users), err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		req      *http.Request
+		want     int
+		contains string
+	}{
+		{"over the route's cap", signedRequest("POST", "/users", big, "ci", "secret", "n1", now), http.StatusRequestEntityTooLarge, "not be larger than"},
+		{"big import without a sum", signedRequest("POST", "/users/import", rows.String(), "ci", "secret", "n2", now), http.StatusRequestEntityTooLarge, "X-Signature-Content-SHA256"},
+		{"big import with its sum", signedStream("POST", "/users/import", strings.NewReader(rows.String()), bodySum([]byte(rows.String())), "ci", "secret", "n3", now), http.StatusOK, `"imported":20000`},
+		{"bad sum", signedStream("POST", "/users/import", strings.NewReader(rows.String()), "xyz", "ci", "secret", "n5", now), http.StatusBadRequest, "invalid X-Signature-Content-SHA256"},
+		// the header is for routes that take big bodies; elsewhere the body is hashed
+		{"sum on a small route", signedStream("POST", "/users", strings.NewReader(user), bodySum([]byte(user)), "ci", "secret", "n8", now), http.StatusCreated, ""},
+		{"wrong sum on a small route", signedStream("POST", "/users", strings.NewReader(user), bodySum([]byte("{}")), "ci", "secret", "n9", now), http.StatusUnauthorized, "invalid signature"},
+		{"client hung up", hungUp, statusClientClosed, ""},
+		{"broken body", broken, http.StatusBadRequest, "could not read body"},
+	} {
+		c.req.Header.Set("Content-Type", "application/x-ndjson")
+		if c.req.URL.Path == "/users" {
+			c.req.Header.Set("Content-Type", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, c.req)
+		if rec.Code != c.want || !strings.Contains(rec.Body.String(), c.contains) {
+			t.Errorf("%s: status %d, want %d with %q: %.200s", c.name, rec.Code, c.want, c.contains, rec.Body)
+		}
+	}
+}
+
+// TestSignatureReplay: a nonce works once per key inside the skew window,
+// and a request turned away for its timestamp or signature doesn't use it up.
+func TestSignatureReplay(t *testing.T) {
+	s := newRouteServer(t, func(cfg *config.Config) {
+		cfg.SigningKeys = []string{"ci:secret", "cd:other"}
+		cfg.SignatureSkew = time.Minute
+	})
+	now := time.Now()
+	for _, c := range []struct {
+		name     string
+		req      *http.Request
+		want     int
+		contains string
+	}{
+		{"signed", signedRequest("GET", "/users", "", "ci", "secret", "n1", now), http.StatusOK, ""},
+		{"replayed", signedRequest("GET", "/users", "", "ci", "secret", "n1", now), http.StatusUnauthorized, "replayed nonce"},
+		{"replayed later", signedRequest("GET", "/users", "", "ci", "secret", "n1", now.Add(30*time.Second)), http.StatusUnauthorized, "replayed nonce"},
+		{"other key", signedRequest("GET", "/users", "", "cd", "other", "n1", now), http.StatusOK, ""},
+		{"too old", signedRequest("GET", "/users", "", "ci", "secret", "n2", now.Add(-2*time.Minute)), http.StatusUnauthorized, "signature expired"},
+		{"too new", signedRequest("GET", "/users", "", "ci", "secret", "n2", now.Add(2*time.Minute)), http.StatusUnauthorized, "signature expired"},
+		{"wrong secret", signedRequest("GET", "/users", "", "ci", "guess", "n2", now), http.StatusUnauthorized, "invalid signature"},
+		{"fresh after those", signedRequest("GET", "/users", "", "ci", "secret", "n2", now), http.StatusOK, ""},
+	} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, c.req)
+		if rec.Code != c.want || !strings.Contains(rec.Body.String(), c.contains) {
+			t.Errorf("%s: status %d, want %d with %q: %s", c.name, rec.Code, c.want, c.contains, rec.Body)
+		}
+	}
+}
+
+func TestNoncePurge(t *testing.T) {
+	n := newNonces()
+	now := time.Now()
+	if !n.use("ci\x00old", now.Add(-time.Second)) || !n.use("ci\x00new", now.Add(time.Minute)) {
+		t.Fatal("fresh nonces refused")
+	}
+	if !n.use("ci\x00old", now.Add(time.Minute)) {
+		t.Error("a nonce past its expiry is still refused")
+	}
+	n.m["ci\x00gone"] = now.Add(-time.Second)
+	n.purge(context.Background())
+	if _, ok := n.m["ci\x00gone"]; ok {
+		t.Error("purge kept an expired nonce")
+	}
+	if len(n.m) != 2 {
+		t.Errorf("after purge %d nonces, want the 2 unexpired", len(n.m))
+	}
+	if n.use("ci\x00new", now.Add(time.Minute)) {
+		t.Error("purge dropped an unexpired nonce")
+	}
+}
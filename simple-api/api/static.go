@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// cache policy for the embedded frontend:
+// - /assets/* are content-hashed by the bundler -> cache forever
+// - index.html must always be revalidated, otherwise clients get stuck on an old build
+const (
+	cacheImmutable = "public, max-age=31536000, immutable"
+	cacheShort     = "public, max-age=3600"
+	cacheNoCache   = "no-cache"
+)
+
+// SPA serves a single page app out of fsys.
+// unknown paths without a file extension fall back to index.html (history-mode routing),
+// and a sibling "<file>.gz" is served instead of the original when the client accepts gzip.
+func SPA(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+
+		if !fileExists(fsys, name) {
+			// deep links like /admin/users/3 belong to the client-side router..
+			// but missing assets (and api clients) should still see a real 404
+			if path.Ext(name) != "" || !acceptsHTML(r) {
+				http.NotFound(w, r)
+				return
+			}
+			name = "index.html"
+		}
+
+		serveFile(w, r, fsys, name)
+	})
+}
+
+func serveFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) {
+	h := w.Header()
+	h.Set("Cache-Control", cacheControl(name))
+	h.Add("Vary", "Accept-Encoding")
+
+	// content type comes from the original name, not the .gz one
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	h.Set("Content-Type", ctype)
+
+	file := name
+	if acceptsGzip(r) && fileExists(fsys, name+".gz") {
+		file = name + ".gz"
+		h.Set("Content-Encoding", "gzip")
+	}
+
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// embed.FS has no mod times, so ServeContent only gets to do Range/HEAD for us
+	// (the etag makes conditional requests work instead)
+	h.Set("ETag", etag(data))
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
+
+func cacheControl(name string) string {
+	switch {
+	case name == "index.html":
+		return cacheNoCache
+	case strings.HasPrefix(name, "assets/"):
+		return cacheImmutable
+	default:
+		return cacheShort
+	}
+}
+
+func fileExists(fsys fs.FS, name string) bool {
+	st, err := fs.Stat(fsys, name)
+	return err == nil && !st.IsDir()
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(enc, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return accept == "" || strings.Contains(accept, "text/html") || strings.Contains(accept, "*/*")
+}
+
+// etag is a strong validator derived from the served bytes
+// (gzip and identity variants get different tags, as they should)
+func etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
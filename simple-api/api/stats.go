@@ -0,0 +1,124 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// live stats for /admin/stats, for deployments without prometheus: request
+// rate, 5xx rate and latency over the last seconds, from a ring of one-second
+// slots, plus the user cache and the db pools as they are right now. like
+// /usage it's this replica only.
+
+const statsSeconds = 60
+
+// the windows reported, each over complete seconds (the current one is still
+// filling up)
+var statsWindows = [...]int{10, statsSeconds}
+
+type liveStats struct {
+	mu    sync.Mutex
+	slots [statsSeconds]statsSlot
+}
+
+type statsSlot struct {
+	sec int64 // unix second the slot holds; anything else is stale
+	routeWindow
+}
+
+func (l *liveStats) record(route string, status int, d time.Duration, now time.Time) {
+	sec := now.Unix()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sl := &l.slots[sec%statsSeconds]
+	if sl.sec != sec {
+		*sl = statsSlot{sec: sec}
+	}
+	if latencyUnjudged[route] {
+		// counted, but a long poll's minutes would swamp the percentiles
+		sl.requests++
+		if status >= 500 {
+			sl.errors++
+		}
+		return
+	}
+	sl.add(status, d)
+}
+
+// over sums the n complete seconds before now.
+func (l *liveStats) over(n int, now time.Time) routeWindow {
+	sec := now.Unix()
+	var w routeWindow
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for s := sec - int64(n); s < sec; s++ {
+		if sl := l.slots[s%statsSeconds]; sl.sec == s {
+			w.merge(sl.routeWindow)
+		}
+	}
+	return w
+}
+
+type statsReport struct {
+	At      time.Time             `json:"at"`
+	Windows []statsWindow         `json:"windows"`
+	Cache   cacheReport           `json:"user_cache"`
+	Pools   map[string]poolReport `json:"pools,omitempty"` // sql backends only
+}
+
+type statsWindow struct {
+	Window    string  `json:"window"`
+	Requests  int     `json:"requests"`
+	RPS       float64 `json:"rps"`
+	ErrorRate float64 `json:"error_rate"`  // 5xx
+	P50       float64 `json:"p50_seconds"` // bucket upper bounds, see latencyBounds
+	P95       float64 `json:"p95_seconds"`
+}
+
+type cacheReport struct {
+	Hits    int64   `json:"hits"` // since start
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+	Entries int     `json:"entries"`
+}
+
+func (s *Server) statsReport(now time.Time) statsReport {
+	rep := statsReport{At: now.UTC()}
+	for _, n := range statsWindows {
+		w := s.stats.over(n, now)
+		sw := statsWindow{
+			Window:   (time.Duration(n) * time.Second).String(),
+			Requests: w.requests,
+			RPS:      float64(w.requests) / float64(n),
+			P50:      w.percentile(50).Seconds(),
+			P95:      w.percentile(95).Seconds(),
+		}
+		if w.requests > 0 {
+			sw.ErrorRate = float64(w.errors) / float64(w.requests)
+		}
+		rep.Windows = append(rep.Windows, sw)
+	}
+	c := &rep.Cache
+	c.Hits, c.Misses, c.Entries = s.userBodies.hits.Load(), s.userBodies.misses.Load(), s.userBodies.len()
+	if c.Hits+c.Misses > 0 {
+		c.HitRate = float64(c.Hits) / float64(c.Hits+c.Misses)
+	}
+	if s.pools != nil {
+		rep.Pools = s.pools.report(now)
+	}
+	return rep
+}
+
+// getStats is json, or for a browser a page that polls the json.
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Add("Vary", "Accept")
+	rep := s.statsReport(time.Now())
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		renderAdmin(w, http.StatusOK, "stats", adminPage{Title: "Stats", LoggedIn: s.cfg.AdminPassword != "", Stats: &rep})
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
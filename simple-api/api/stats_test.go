@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLiveStats checks the windows only sum complete seconds that are still
+// in the ring, and that long polls count without skewing latency.
+func TestLiveStats(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	var l liveStats
+	l.record("GET /users", 200, 3*time.Millisecond, now.Add(-90*time.Second)) // overwritten below
+	l.record("GET /users", 200, 3*time.Millisecond, now.Add(-30*time.Second))
+	l.record("GET /users", 500, 400*time.Millisecond, now.Add(-5*time.Second))
+	l.record("GET /users/changes", 200, time.Minute, now.Add(-5*time.Second))
+	l.record("GET /users", 200, time.Millisecond, now) // the current second: not yet
+
+	for _, c := range []struct {
+		n                int
+		requests, errors int
+		p50, p95         time.Duration
+	}{
+		{10, 2, 1, 500 * time.Millisecond, 500 * time.Millisecond},
+		{statsSeconds, 3, 1, 5 * time.Millisecond, 500 * time.Millisecond},
+	} {
+		w := l.over(c.n, now)
+		if w.requests != c.requests || w.errors != c.errors {
+			t.Errorf("%ds: %d requests, %d errors; want %d, %d", c.n, w.requests, w.errors, c.requests, c.errors)
+		}
+		if p50, p95 := w.percentile(50), w.percentile(95); p50 != c.p50 || p95 != c.p95 {
+			t.Errorf("%ds: p50 %v, p95 %v; want %v, %v", c.n, p50, p95, c.p50, c.p95)
+		}
+	}
+}
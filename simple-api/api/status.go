@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// GET /status is the public status page, for clients that want more than
+// /healthz's yes or no: this replica's uptime, the last cfg.StatusHistory
+// checks of every dependency (one every cfg.StatusCheckInterval) and the
+// incidents an operator has open:
+//
+//	POST   /admin/incidents       {"title": "...", "impact": "degraded", "message": "..."}
+//	PUT    /admin/incidents/{id}  the same, to update it
+//	DELETE /admin/incidents/{id}  resolved
+//
+// (admin session or X-Lifecycle-Token, like /admin/maintenance). incidents
+// live in the process like maintenance mode does: set them on every
+// replica. it's public, so what a failing check said is logged, not shown.
+
+const (
+	impactDegraded = "degraded"
+	impactOutage   = "outage"
+)
+
+type statusBody struct {
+	Status       string             `json:"status"` // ok, degraded, outage or maintenance
+	StartedAt    time.Time          `json:"started_at"`
+	Uptime       float64            `json:"uptime_seconds"`
+	Dependencies []dependencyStatus `json:"dependencies"`
+	Incidents    []incident         `json:"incidents"`
+	Maintenance  *maintenanceState  `json:"maintenance,omitempty"`
+}
+
+type dependencyStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok, failing, or unknown before the first check
+	// Availability is the share of History that passed
+	Availability float64       `json:"availability"`
+	History      []checkSample `json:"history"` // oldest first
+}
+
+type checkSample struct {
+	At      time.Time `json:"at"`
+	OK      bool      `json:"ok"`
+	Latency float64   `json:"latency_seconds"`
+}
+
+type incident struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Impact    string    `json:"impact"` // degraded or outage
+	Message   string    `json:"message,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type incidentInput struct {
+	Title   string `json:"title"`
+	Impact  string `json:"impact"` // defaults to degraded
+	Message string `json:"message"`
+}
+
+type statusBoard struct {
+	started time.Time
+	history int
+
+	mu        sync.Mutex
+	deps      []*dependency // in the order they were added
+	incidents []incident    // oldest first
+}
+
+type dependency struct {
+	name    string
+	check   func(context.Context) error
+	samples []checkSample
+}
+
+func newStatusBoard(history int) *statusBoard {
+	return &statusBoard{started: time.Now().UTC(), history: history}
+}
+
+func (b *statusBoard) add(name string, check func(context.Context) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deps = append(b.deps, &dependency{name: name, check: check})
+}
+
+// CheckDependency adds a dependency to /status, for the ones New doesn't
+// see (main's lock backend). call it before the jobs start.
+func (s *Server) CheckDependency(name string, check func(context.Context) error) {
+	if s.cfg.StatusCheckInterval > 0 {
+		s.status.add(name, check)
+	}
+}
+
+// statusProbeID is a user that never exists: finding nothing is the store
+// answering.
+const statusProbeID = "00000000000000000000000000"
+
+// addStatusChecks registers the dependencies the server itself talks to.
+func (s *Server) addStatusChecks(st store.Storage) {
+	if s.cfg.StatusCheckInterval == 0 {
+		return
+	}
+	if p, ok := st.(store.Pools); ok {
+		pools := p.Pools()
+		for _, name := range slices.Sorted(maps.Keys(pools)) {
+			s.status.add("postgres "+name, pools[name].PingContext)
+		}
+	} else {
+		s.status.add(s.cfg.Storage, func(ctx context.Context) error {
+			if _, err := s.store.GetUser(ctx, statusProbeID); !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+			return nil
+		})
+	}
+	if s.search != nil {
+		s.status.add("search", func(ctx context.Context) error {
+			_, err := s.search.Search(ctx, "status", 1)
+			return err
+		})
+	}
+}
+
+// checkDependencies runs every check once, side by side (a job, every
+// cfg.StatusCheckInterval), and logs the ones that changed state.
+func (b *statusBoard) checkDependencies(ctx context.Context, timeout time.Duration) error {
+	b.mu.Lock()
+	deps := slices.Clone(b.deps)
+	b.mu.Unlock()
+
+	samples := make([]checkSample, len(deps))
+	errs := make([]error, len(deps))
+	var wg sync.WaitGroup
+	for i, d := range deps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			errs[i] = d.check(ctx)
+			samples[i] = checkSample{At: start.UTC(), OK: errs[i] == nil, Latency: time.Since(start).Seconds()}
+		}()
+	}
+	wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, d := range deps {
+		was := len(d.samples) == 0 || d.samples[len(d.samples)-1].OK
+		if len(d.samples) == b.history {
+			d.samples = slices.Delete(d.samples, 0, 1)
+		}
+		d.samples = append(d.samples, samples[i])
+		switch {
+		case was && errs[i] != nil:
+			slog.Warn("status: dependency failing", "dependency", d.name, "err", errs[i])
+		case !was && errs[i] == nil:
+			slog.Info("status: dependency recovered", "dependency", d.name)
+		}
+	}
+	return nil
+}
+
+func (b *statusBoard) report(now time.Time, maint maintenanceState) statusBody {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	body := statusBody{
+		Status:       "ok",
+		StartedAt:    b.started,
+		Uptime:       now.Sub(b.started).Round(time.Second).Seconds(),
+		Dependencies: make([]dependencyStatus, 0, len(b.deps)),
+		Incidents:    slices.Clone(b.incidents),
+	}
+	if body.Incidents == nil {
+		body.Incidents = []incident{}
+	}
+	degraded, outage := len(b.incidents) > 0, false
+	for _, in := range b.incidents {
+		outage = outage || in.Impact == impactOutage
+	}
+	for _, d := range b.deps {
+		ds := dependencyStatus{Name: d.name, Status: "unknown", History: slices.Clone(d.samples)}
+		if ds.History == nil {
+			ds.History = []checkSample{}
+		}
+		if n := len(d.samples); n > 0 {
+			passed := 0
+			for _, sm := range d.samples {
+				if sm.OK {
+					passed++
+				}
+			}
+			ds.Availability = float64(passed) / float64(n)
+			ds.Status = "ok"
+			if !d.samples[n-1].OK {
+				ds.Status, degraded = "failing", true
+			}
+		}
+		body.Dependencies = append(body.Dependencies, ds)
+	}
+	switch {
+	case outage:
+		body.Status = impactOutage
+	case degraded:
+		body.Status = impactDegraded
+	case maint.Enabled:
+		body.Status = "maintenance"
+	}
+	if maint.Enabled {
+		body.Maintenance = &maint
+	}
+	return body
+}
+
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, s.status.report(time.Now(), s.maintenance.get()))
+}
+
+// bindIncident reads and checks an incidentInput.
+func bindIncident(w http.ResponseWriter, r *http.Request) (incidentInput, bool) {
+	var in incidentInput
+	if err := bindJSON(w, r, &in); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return in, false
+	}
+	if in.Impact == "" {
+		in.Impact = impactDegraded
+	}
+	switch {
+	case in.Title == "":
+		writeError(w, r, http.StatusBadRequest, "title is required")
+	case in.Impact != impactDegraded && in.Impact != impactOutage:
+		writeError(w, r, http.StatusBadRequest, "impact must be degraded or outage")
+	default:
+		return in, true
+	}
+	return in, false
+}
+
+func (s *Server) openIncident(w http.ResponseWriter, r *http.Request) {
+	in, ok := bindIncident(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	inc := incident{ID: ids.New(), Title: in.Title, Impact: in.Impact, Message: in.Message, StartedAt: now, UpdatedAt: now}
+	b := s.status
+	b.mu.Lock()
+	b.incidents = append(b.incidents, inc)
+	b.mu.Unlock()
+	slog.Warn("status: incident opened", "id", inc.ID, "title", inc.Title, "impact", inc.Impact, "remote", r.RemoteAddr)
+	w.Header().Set("Location", "/admin/incidents/"+inc.ID)
+	writeJSON(w, http.StatusCreated, inc)
+}
+
+func (s *Server) updateIncident(w http.ResponseWriter, r *http.Request) {
+	in, ok := bindIncident(w, r)
+	if !ok {
+		return
+	}
+	b := s.status
+	b.mu.Lock()
+	i := slices.IndexFunc(b.incidents, func(inc incident) bool { return inc.ID == r.PathValue("id") })
+	var inc incident
+	if i >= 0 {
+		inc = b.incidents[i]
+		inc.Title, inc.Impact, inc.Message, inc.UpdatedAt = in.Title, in.Impact, in.Message, time.Now().UTC()
+		b.incidents[i] = inc
+	}
+	b.mu.Unlock()
+	if i < 0 {
+		writeError(w, r, http.StatusNotFound, "incident not found")
+		return
+	}
+	slog.Warn("status: incident updated", "id", inc.ID, "title", inc.Title, "impact", inc.Impact, "remote", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, inc)
+}
+
+func (s *Server) resolveIncident(w http.ResponseWriter, r *http.Request) {
+	b := s.status
+	b.mu.Lock()
+	n := len(b.incidents)
+	b.incidents = slices.DeleteFunc(b.incidents, func(inc incident) bool { return inc.ID == r.PathValue("id") })
+	found := len(b.incidents) < n
+	b.mu.Unlock()
+	if !found {
+		writeError(w, r, http.StatusNotFound, "incident not found")
+		return
+	}
+	slog.Info("status: incident resolved", "id", r.PathValue("id"), "remote", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStatus walks /status through a failing dependency and an incident's
+// life.
+func TestStatus(t *testing.T) {
+	s := newRouteServer(t, nil)
+	var down error
+	s.CheckDependency("flaky", func(context.Context) error { return down })
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Lifecycle-Token", "token")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+	status := func() statusBody {
+		t.Helper()
+		var body statusBody
+		if err := json.Unmarshal(do(http.MethodGet, "/status", "").Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+	check := func() {
+		if err := s.status.checkDependencies(context.Background(), time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := status(); got.Status != "ok" || len(got.Dependencies) != 3 || got.Dependencies[2].Status != "unknown" {
+		t.Fatalf("before any check: %+v", got)
+	}
+	check()
+	down = errors.New("connection refused")
+	check()
+	got := status()
+	if flaky := got.Dependencies[2]; got.Status != impactDegraded || flaky.Status != "failing" || flaky.Availability != 0.5 || len(flaky.History) != 2 {
+		t.Fatalf("after a failed check: %+v", got)
+	}
+	down = nil
+	check()
+
+	rec := do(http.MethodPost, "/admin/incidents", `{"title":"Slow exports","impact":"outage"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("open: %d %s", rec.Code, rec.Body)
+	}
+	var inc incident
+	json.Unmarshal(rec.Body.Bytes(), &inc)
+	if got := status(); got.Status != impactOutage || len(got.Incidents) != 1 {
+		t.Fatalf("with an outage: %+v", got)
+	}
+	if rec := do(http.MethodPut, "/admin/incidents/"+inc.ID, `{"title":"Slow exports","message":"recovering"}`); rec.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body)
+	}
+	if got := status(); got.Status != impactDegraded || got.Incidents[0].Message != "recovering" {
+		t.Fatalf("updated: %+v", got)
+	}
+	if rec := do(http.MethodDelete, "/admin/incidents/"+inc.ID, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("resolve: %d %s", rec.Code, rec.Body)
+	}
+	if got := status(); got.Status != "ok" || len(got.Incidents) != 0 {
+		t.Fatalf("resolved: %+v", got)
+	}
+
+	for _, c := range []struct{ method, path, body string }{
+		{http.MethodPost, "/admin/incidents", `{"impact":"outage"}`},
+		{http.MethodPost, "/admin/incidents", `{"title":"x","impact":"minor"}`},
+	} {
+		if rec := do(c.method, c.path, c.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: %d", c.body, c.path, rec.Code)
+		}
+	}
+	if rec := do(http.MethodDelete, "/admin/incidents/"+inc.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("resolving twice: %d", rec.Code)
+	}
+}
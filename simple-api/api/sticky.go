@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// read-your-writes with a read replica: a client that writes gets a short-lived
+// cookie, and while it has one its reads go to the primary instead of a
+// replica that may still be behind. state lives in the cookie, so it holds no
+// matter which replica of the api the next request lands on.
+
+const stickyCookie = "rw_primary"
+
+func (s *Server) readYourWrites(next http.Handler) http.Handler {
+	window := s.cfg.ReadYourWrites
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if c, err := r.Cookie(stickyCookie); err == nil && c.Value != "" {
+				if until, err := strconv.ParseInt(c.Value, 10, 64); err == nil && time.Now().Unix() < until {
+					r = r.WithContext(store.ReadFromPrimary(r.Context()))
+				}
+			}
+		default:
+			// set before the handler runs (headers can't change after it writes);
+			// a failed write costs a few primary reads, nothing worse
+			until := time.Now().Add(window)
+			http.SetCookie(w, &http.Cookie{
+				Name:     stickyCookie,
+				Value:    strconv.FormatInt(until.Unix(), 10),
+				Path:     "/",
+				Expires:  until,
+				MaxAge:   int(window.Seconds()) + 1,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			r = r.WithContext(store.ReadFromPrimary(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
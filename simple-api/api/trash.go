@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// trash keeps deleted users around for cfg.UndoWindow so a delete can be
+// taken back: DELETE /users/{id} answers with an X-Undo-Token header, a bulk
+// DELETE /users with undo_token in the body, and
+//
+//	POST /undo/{token}
+//
+// puts the users back with their ids and timestamps. a token works once.
+// like sessions the trash lives in this process - an undo has to reach the
+// replica that did the delete, and a restart empties it.
+type trash struct {
+	mu     sync.Mutex
+	window time.Duration
+	m      map[string]trashEntry
+}
+
+type trashEntry struct {
+	users   []models.User
+	expires time.Time
+}
+
+type undoResponse struct {
+	Restored []string          `json:"restored"`
+	Failed   map[string]string `json:"failed,omitempty"` // id -> why, eg its email was taken meanwhile
+}
+
+func newTrash(window time.Duration) *trash {
+	return &trash{window: window, m: map[string]trashEntry{}}
+}
+
+// put keeps users and returns the token that restores them.
+func (t *trash) put(users []models.User) (string, time.Time) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	exp := time.Now().Add(t.window)
+
+	t.mu.Lock()
+	t.m[token] = trashEntry{users: users, expires: exp}
+	t.mu.Unlock()
+	return token, exp
+}
+
+// take hands out the users for token, once.
+func (t *trash) take(token string) ([]models.User, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.m[token]
+	delete(t.m, token)
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.users, true
+}
+
+func (t *trash) purge(ctx context.Context) error {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for token, e := range t.m {
+		if now.After(e.expires) {
+			delete(t.m, token)
+		}
+	}
+	return nil
+}
+
+func (s *Server) undo(w http.ResponseWriter, r *http.Request) {
+	users, ok := s.trash.take(r.PathValue("token"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "undo token not found or expired")
+		return
+	}
+	res := undoResponse{Restored: []string{}}
+	tag := lang(w, r)
+	for _, u := range users {
+		if _, err := s.store.RestoreUser(r.Context(), u); err != nil {
+			if res.Failed == nil {
+				res.Failed = map[string]string{}
+			}
+			res.Failed[u.ID] = failMessage(r, tag, err)
+			continue
+		}
+		res.Restored = append(res.Restored, u.ID)
+	}
+	writeBody(w, r, http.StatusOK, res)
+}
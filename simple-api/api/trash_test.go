@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// TestUndo: a delete comes back once through its token, a restore that
+// fails says why in terms fit for a client, and an expired token - purged
+// or not - is gone.
+func TestUndo(t *testing.T) {
+	s := newRouteServer(t, nil)
+	ctx := context.Background()
+	do := func(method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	create := func(name string) models.User {
+		t.Helper()
+		u, err := s.store.CreateUser(ctx, models.User{Name: name, Email: name + "@example.com", Role: "user"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	remove := func(u models.User) string {
+		t.Helper()
+		rec := do("DELETE", "/users/"+u.ID)
+		token := rec.Header().Get("X-Undo-Token")
+		if rec.Code != http.StatusNoContent || token == "" {
+			t.Fatalf("DELETE: status %d, token %q", rec.Code, token)
+		}
+		return token
+	}
+	undo := func(token string) (int, undoResponse) {
+		t.Helper()
+		rec := do("POST", "/undo/"+token)
+		var res undoResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, res
+	}
+
+	ada := create("ada")
+	token := remove(ada)
+	if code, res := undo(token); code != http.StatusOK || len(res.Restored) != 1 || res.Restored[0] != ada.ID {
+		t.Errorf("undo: %d %+v", code, res)
+	}
+	if code, _ := undo(token); code != http.StatusNotFound {
+		t.Errorf("second undo: %d", code)
+	}
+
+	// ada's email is taken while she's in the trash
+	token = remove(ada)
+	create("ada")
+	code, res := undo(token)
+	if code != http.StatusOK || len(res.Restored) != 0 || res.Failed[ada.ID] != "email already in use" {
+		t.Errorf("undo onto a taken email: %d %+v", code, res)
+	}
+
+	expire := func(token string) {
+		s.trash.mu.Lock()
+		e := s.trash.m[token]
+		e.expires = time.Now().Add(-time.Second)
+		s.trash.m[token] = e
+		s.trash.mu.Unlock()
+	}
+	grace := create("grace")
+	token = remove(grace)
+	expire(token)
+	if code, _ := undo(token); code != http.StatusNotFound {
+		t.Errorf("undo after expiry: %d", code)
+	}
+
+	linus := create("linus")
+	token = remove(linus)
+	expire(token)
+	s.trash.purge(ctx)
+	if n := len(s.trash.m); n != 0 {
+		t.Errorf("purge left %d expired entries", n)
+	}
+	if code, _ := undo(token); code != http.StatusNotFound {
+		t.Errorf("undo after purge: %d", code)
+	}
+	if _, err := s.store.GetUser(ctx, linus.ID); err == nil {
+		t.Error("purged user is back")
+	}
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/reqctx"
+)
+
+// usage counts requests to the users api per caller and calendar month (UTC),
+// and turns them away with 429 once cfg.MonthlyQuota is used up (0 = count
+// only). a caller is its client certificate identity, signing key or
+// X-Api-Key from cfg.APIKeys, or its ip without any of those - a key nobody
+// configured is just a header, and rotating it mustn't reset a count.
+//
+// counts live in this process: with several replicas each enforces the quota
+// on its own share of the traffic.
+type usage struct {
+	mu     sync.Mutex
+	limit  int
+	counts map[callerKey]usageCount
+
+	month     string    // period() of the current month..
+	monthEnds time.Time // ..until this, so it's formatted once a month, not per request
+}
+
+// callerKey is who a request counts against, eg {"ip", "10.0.0.1"}. kept
+// apart rather than joined so the api's hot path doesn't build a string per
+// request just to look the count up.
+type callerKey struct{ kind, name string }
+
+func (c callerKey) String() string { return c.kind + ":" + c.name }
+
+type usageCount struct {
+	period string // "2006-01"
+	n      int
+}
+
+type usageReport struct {
+	Caller    string    `json:"caller"`
+	Period    string    `json:"period"`
+	Used      int       `json:"used"`
+	Limit     int       `json:"limit,omitempty"` // absent = unlimited
+	Remaining *int      `json:"remaining,omitempty"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+func newUsage(limit int) *usage {
+	return &usage{limit: limit, counts: map[callerKey]usageCount{}}
+}
+
+func period(now time.Time) string { return now.UTC().Format("2006-01") }
+
+// periodEnd is the start of the next month, when every count goes back to 0.
+func periodEnd(now time.Time) time.Time {
+	y, m, _ := now.UTC().Date()
+	return time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// take counts one request for caller, unless that would go over the quota.
+// it returns the count after the call either way.
+func (u *usage) take(caller callerKey, now time.Time) (int, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	c := u.current(caller, now)
+	if u.limit > 0 && c.n >= u.limit {
+		return c.n, false
+	}
+	c.n++
+	u.counts[caller] = c
+	return c.n, true
+}
+
+func (u *usage) report(caller callerKey, now time.Time) usageReport {
+	u.mu.Lock()
+	c := u.current(caller, now)
+	u.mu.Unlock()
+
+	rep := usageReport{Caller: caller.String(), Period: c.period, Used: c.n, ResetsAt: periodEnd(now)}
+	if u.limit > 0 {
+		left := max(u.limit-c.n, 0)
+		rep.Limit, rep.Remaining = u.limit, &left
+	}
+	return rep
+}
+
+// current is caller's count for this month; callers must hold mu.
+func (u *usage) current(caller callerKey, now time.Time) usageCount {
+	if !now.Before(u.monthEnds) {
+		u.month, u.monthEnds = period(now), periodEnd(now)
+	}
+	p := u.month
+	if c := u.counts[caller]; c.period == p {
+		return c
+	}
+	return usageCount{period: p}
+}
+
+// purge drops last month's callers; take only resets the ones that come back.
+func (u *usage) purge(ctx context.Context) error {
+	p := period(time.Now())
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for caller, c := range u.counts {
+		if c.period != p {
+			delete(u.counts, caller)
+		}
+	}
+	return nil
+}
+
+// parseAPIKeys reads cfg.APIKeys. keys are kept hashed, so looking one up
+// doesn't compare secrets byte by byte.
+func parseAPIKeys(pairs []string) (map[[sha256.Size]byte]string, error) {
+	keys := make(map[[sha256.Size]byte]string, len(pairs))
+	for _, p := range pairs {
+		name, key, ok := strings.Cut(p, ":")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("API_KEYS: want name:key, got %q", redactPair(p))
+		}
+		keys[sha256.Sum256([]byte(key))] = name
+	}
+	return keys, nil
+}
+
+// caller identifies who a request counts against: who it's verified to be
+// from, else its ip.
+func (s *Server) caller(r *http.Request) callerKey {
+	if id, ok := reqctx.Claims(r.Context()); ok {
+		return callerKey{id.Kind, id.Name}
+	}
+	if id, ok := signedBy(r.Context()); ok {
+		return callerKey{"hmac", id}
+	}
+	if key := r.Header.Get("X-Api-Key"); key != "" && len(s.apiKeys) > 0 {
+		if name, ok := s.apiKeys[sha256.Sum256([]byte(key))]; ok {
+			return callerKey{"key", name}
+		}
+	}
+	return callerKey{"ip", s.clientIP(r)}
+}
+
+// clientIP is the address a request came from, or with cfg.TrustProxy the
+// one the proxy says it did: the last X-Forwarded-For hop, the one our proxy
+// added. those before it are whatever the client sent.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.cfg.TrustProxy {
+		if ip := lastHeaderValue(r, "X-Forwarded-For"); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+// metered is the users api - not probes, metrics, the ui or GET /usage
+// itself. POST /batch isn't counted either, the sub-requests it makes are.
+func metered(r *http.Request) bool {
+	return r.URL.Path == "/users" || strings.HasPrefix(r.URL.Path, "/users/")
+}
+
+// meter counts metered requests and enforces the quota, telling clients
+// where they stand in X-Quota-* headers.
+func (s *Server) meter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !metered(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		n, ok := s.usage.take(s.caller(r), now)
+		if limit := s.usage.limit; limit > 0 {
+			reset := periodEnd(now)
+			w.Header().Set("X-Quota-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-Quota-Remaining", strconv.Itoa(max(limit-n, 0)))
+			w.Header().Set("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+				writeError(w, r, http.StatusTooManyRequests, "monthly quota exceeded")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getUsage is GET /usage: the caller's consumption this month.
+func (s *Server) getUsage(w http.ResponseWriter, r *http.Request) {
+	writeBody(w, r, http.StatusOK, s.usage.report(s.caller(r), time.Now()))
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/iamskyy666/simple-api/config"
+)
+
+// TestUsageCallers: only a configured X-Api-Key is a caller of its own; a
+// made-up one counts against the ip like no key at all.
+func TestUsageCallers(t *testing.T) {
+	s := newRouteServer(t, func(cfg *config.Config) {
+		cfg.APIKeys = []string{"ci:k3y"}
+	})
+	usage := func(key string) usageReport {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set("X-Api-Key", key)
+		s.ServeHTTP(rec, req)
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/usage", nil)
+		req.Header.Set("X-Api-Key", key)
+		s.ServeHTTP(rec, req)
+		var rep usageReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+			t.Fatalf("GET /usage: %v: %s", err, rec.Body)
+		}
+		return rep
+	}
+	for i, key := range []string{"guess-1", "guess-2", ""} {
+		if rep := usage(key); rep.Caller != "ip:192.0.2.1" || rep.Used != i+1 {
+			t.Errorf("key %q: %s used %d, want ip:192.0.2.1 used %d", key, rep.Caller, rep.Used, i+1)
+		}
+	}
+	if rep := usage("k3y"); rep.Caller != "key:ci" || rep.Used != 1 {
+		t.Errorf("configured key: %s used %d, want key:ci used 1", rep.Caller, rep.Used)
+	}
+}
+
+// TestClientIPBehindProxy: with TRUST_PROXY the client is the hop our proxy
+// added, so making up X-Forwarded-For entries in front of it doesn't get a
+// new quota or rate limit.
+func TestClientIPBehindProxy(t *testing.T) {
+	s := newRouteServer(t, func(cfg *config.Config) { cfg.TrustProxy = true })
+	for _, xff := range [][]string{
+		{"203.0.113.7"},
+		{"10.0.0.1, 203.0.113.7"},
+		{"198.51.100.99, 203.0.113.7"},
+		{"1.2.3.4", "203.0.113.7"},
+	} {
+		req := httptest.NewRequest("GET", "/usage", nil)
+		req.Header["X-Forwarded-For"] = xff
+		if got := s.caller(req); got != (callerKey{"ip", "203.0.113.7"}) {
+			t.Errorf("X-Forwarded-For %q: caller %v, want the proxy's hop", xff, got)
+		}
+	}
+
+	login := func(spoofed string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/ui/login", nil)
+		req.Header.Set("X-Forwarded-For", spoofed+", 203.0.113.7")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for i := range 10 {
+		login("192.0.2." + strconv.Itoa(i))
+	}
+	if code := login("192.0.2.200"); code != http.StatusTooManyRequests {
+		t.Errorf("11th login with a new spoofed hop: %d, want 429", code)
+	}
+}
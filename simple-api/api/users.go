@@ -0,0 +1,306 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// userInput is what clients may send - the id always comes from the path/store.
+// read-only fields (created_at, display_name, ...) are rejected as unknown.
+type userInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role,omitempty"` // defaults to member
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	f, err := listFilter(w, r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	users, err := s.store.ListUsers(r.Context(), f)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	users, status := sliceRange(w, r, users)
+	if status == 0 {
+		return
+	}
+	writeBody(w, r, status, s.usersView(r, users))
+}
+
+// listFilter reads the filter, sort and collation params shared by the
+// listing endpoints.
+func listFilter(w http.ResponseWriter, r *http.Request) (store.Filter, error) {
+	q := r.URL.Query()
+	f, err := store.ParseFilter(q["filter"])
+	if err != nil {
+		return store.Filter{}, err
+	}
+	if f.Sort, err = store.ParseSort(q.Get("sort")); err != nil {
+		return store.Filter{}, err
+	}
+	f.Collation, err = sortCollation(w, r, f.Sort)
+	return f, err
+}
+
+// collations are the plain per-language orders; variants like
+// de-u-co-phonebk only when asked for by name, or the matcher would hand
+// german browsers phone book order.
+var collations, collationMatcher = func() ([]language.Tag, language.Matcher) {
+	var plain []language.Tag
+	for _, t := range collate.Supported() {
+		if !strings.Contains(t.String(), "-u-") {
+			plain = append(plain, t)
+		}
+	}
+	return plain, language.NewMatcher(plain)
+}()
+
+// sortCollation picks how names sort: ?collation=<bcp 47 tag> if given ("C"
+// for bytewise), else the client's Accept-Language when we have a collation
+// for it, else bytewise. only matters when sorting by name.
+func sortCollation(w http.ResponseWriter, r *http.Request, sort []store.SortKey) (string, error) {
+	if !slices.ContainsFunc(sort, func(k store.SortKey) bool { return k.Field == "name" }) {
+		return "", nil
+	}
+	if raw := r.URL.Query().Get("collation"); raw != "" {
+		if raw == "C" {
+			return "", nil
+		}
+		tag, err := language.Parse(raw)
+		if err != nil {
+			return "", fmt.Errorf("collation %q: %v", raw, err)
+		}
+		if slices.Contains(collate.Supported(), tag) {
+			return tag.String(), nil
+		}
+		if _, i, conf := collationMatcher.Match(tag); conf != language.No {
+			return collations[i].String(), nil
+		}
+		return "", fmt.Errorf("collation %q: not supported", raw)
+	}
+	w.Header().Add("Vary", "Accept-Language")
+	prefs, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil || len(prefs) == 0 {
+		return "", nil
+	}
+	if _, i, conf := collationMatcher.Match(prefs...); conf != language.No {
+		return collations[i].String(), nil
+	}
+	return "", nil
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	u, err := s.store.GetUser(r.Context(), id)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	s.writeUser(w, r, u)
+}
+
+// getUserByEmail is GET /users/by-email/{email} - an exact (case-insensitive) match.
+func (s *Server) getUserByEmail(w http.ResponseWriter, r *http.Request) {
+	email := models.NormalizeEmail(r.PathValue("email"))
+	if email == "" {
+		writeError(w, r, http.StatusBadRequest, "email is required")
+		return
+	}
+	u, err := s.store.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	s.writeUser(w, r, u)
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	var in userInput
+	if err := bind(w, r, &in); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	u := models.User{Name: in.Name, Email: in.Email, Role: in.Role}
+	dry, ok := dryRunParam(w, r)
+	if !ok || !validUser(w, r, &u) {
+		return
+	}
+	write := s.store.CreateUser
+	if dry {
+		write = s.previewCreate
+	}
+
+	u, err := write(r.Context(), u)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	if dry {
+		writeBody(w, r, http.StatusOK, u) // no id yet, so no links either
+		return
+	}
+	w.Header().Set("Location", "/users/"+u.ID)
+	if returnMinimal(w, r) {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	writeBody(w, r, http.StatusCreated, s.userView(r, u))
+}
+
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var in userInput
+	if err := bind(w, r, &in); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	u := models.User{ID: id, Name: in.Name, Email: in.Email, Role: in.Role}
+	dry, ok := dryRunParam(w, r)
+	if !ok || !validUser(w, r, &u) {
+		return
+	}
+	write := s.store.UpdateUser
+	if dry {
+		write = s.previewUpdate
+	}
+
+	u, err := write(r.Context(), u)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	if !dry && returnMinimal(w, r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeBody(w, r, http.StatusOK, s.userView(r, u))
+}
+
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if s.trash == nil {
+		if err := s.store.DeleteUser(r.Context(), id); err != nil {
+			fail(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// keep a copy for undo; by ulid from here on, in case id was a legacy one
+	u, err := s.store.GetUser(r.Context(), id)
+	if err == nil {
+		err = s.store.DeleteUser(r.Context(), u.ID)
+	}
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	token, exp := s.trash.put([]models.User{u})
+	w.Header().Set("X-Undo-Token", token)
+	w.Header().Set("X-Undo-Expires", exp.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type bulkDeleteResponse struct {
+	Deleted       int        `json:"deleted"`
+	DryRun        bool       `json:"dry_run,omitempty"`
+	IDs           []string   `json:"ids"`
+	UndoToken     string     `json:"undo_token,omitempty"`
+	UndoExpiresAt *time.Time `json:"undo_expires_at,omitempty"`
+}
+
+// deleteUsers is DELETE /users?filter=...[&dry_run=true] - same filter syntax as listing.
+func (s *Server) deleteUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := store.ParseFilter(q["filter"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// a bare DELETE /users wiping the table is never what anybody meant
+	if f.Empty() {
+		writeError(w, r, http.StatusBadRequest, "at least one filter is required")
+		return
+	}
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+
+	// for undo, read what's about to go first. a user that starts matching
+	// between the two calls is deleted without landing in the trash
+	var before []models.User
+	if s.trash != nil && !dryRun {
+		if before, err = s.store.ListUsers(r.Context(), f); err != nil {
+			fail(w, r, err)
+			return
+		}
+	}
+	ids, err := s.store.DeleteUsers(r.Context(), f, dryRun)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	res := bulkDeleteResponse{Deleted: len(ids), DryRun: dryRun, IDs: ids}
+	if len(before) > 0 && len(ids) > 0 {
+		gone := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			gone[id] = true
+		}
+		var trashed []models.User
+		for _, u := range before {
+			if gone[u.ID] {
+				trashed = append(trashed, u)
+			}
+		}
+		token, exp := s.trash.put(trashed)
+		res.UndoToken, res.UndoExpiresAt = token, &exp
+	}
+	writeBody(w, r, http.StatusOK, res)
+}
+
+// validUser normalizes u and writes a 422 if it doesn't validate.
+func validUser(w http.ResponseWriter, r *http.Request, u *models.User) bool {
+	u.Normalize()
+	if err := u.Validate(); err != nil {
+		fail(w, r, err)
+		return false
+	}
+	return true
+}
+
+// pathID takes a ULID, or a legacy integer id during the migration window.
+func pathID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if !ids.Valid(id) {
+		writeError(w, r, http.StatusBadRequest, "invalid user id")
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/iamskyy666/simple-api/version"
+)
+
+// the build info can't change while we run
+var versionBody = sync.OnceValue(func() encoded { return encode(version.Get()) })
+
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache")
+	writeEncoded(w, r, versionBody())
+}
@@ -0,0 +1,103 @@
+// Package bench holds the load-testing helpers: fixtures shared by the go
+// benchmarks (bench_test.go) and a target generator for external tools.
+//
+//	go test ./bench -bench . -benchmem
+//	go test ./bench -run x -bench Import -benchtime 1x    # a million-row import
+//	go test ./bench -bench HotPath -memprofile mem.out -memprofilerate 1 && go tool pprof -sample_index=alloc_objects -top mem.out
+//	go run ./cmd/bench-targets -base http://localhost:3000 -n 1000 | vegeta attack -format=json -rate=200 | vegeta report
+//	go run ./cmd/bench-targets -format k6 -n 1000 > targets.json   # for http.batch() in a k6 script
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+// Seed creates n users with predictable, unique emails and returns them.
+func Seed(ctx context.Context, st store.Storage, n int) ([]models.User, error) {
+	out := make([]models.User, 0, n)
+	for i := range n {
+		u, err := st.CreateUser(ctx, SampleUser(i))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+// SampleUser is the i-th fixture user (already normalized).
+func SampleUser(i int) models.User {
+	return models.User{Name: fmt.Sprintf("Bench User %d", i), Email: fmt.Sprintf("bench%d@example.com", i)}
+}
+
+// Target is one request in a load test, in vegeta's json target format
+// (body is base64 on the wire, which []byte gives us for free).
+type Target struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Body   []byte              `json:"body,omitempty"`
+	Header map[string][]string `json:"header,omitempty"`
+}
+
+// Targets builds a request mix over the main endpoints: for each i a create,
+// a lookup of what was just created, and a list call.
+func Targets(base string, n int) []Target {
+	jsonHeader := map[string][]string{"Content-Type": {"application/json"}, "Accept": {"application/json"}}
+	out := make([]Target, 0, 3*n)
+	for i := range n {
+		u := SampleUser(i)
+		body, _ := json.Marshal(map[string]string{"name": u.Name, "email": u.Email})
+		out = append(out,
+			Target{Method: http.MethodPost, URL: base + "/users", Body: body, Header: jsonHeader},
+			Target{Method: http.MethodGet, URL: base + "/users/by-email/" + url.PathEscape(u.Email), Header: jsonHeader},
+			Target{Method: http.MethodGet, URL: base + "/users?filter=email:prefix:bench", Header: jsonHeader},
+		)
+	}
+	return out
+}
+
+// WriteVegeta writes targets as newline-delimited json (vegeta attack -format=json).
+func WriteVegeta(w io.Writer, targets []Target) error {
+	enc := json.NewEncoder(w)
+	for _, t := range targets {
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// k6Request matches the object form accepted by k6's http.batch().
+type k6Request struct {
+	Method string   `json:"method"`
+	URL    string   `json:"url"`
+	Body   string   `json:"body,omitempty"`
+	Params k6Params `json:"params"`
+}
+
+type k6Params struct {
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// WriteK6 writes targets as a json array for k6 (open() + JSON.parse in the script).
+func WriteK6(w io.Writer, targets []Target) error {
+	out := make([]k6Request, len(targets))
+	for i, t := range targets {
+		h := make(map[string]string, len(t.Header))
+		for k, v := range t.Header {
+			h[k] = v[0]
+		}
+		out[i] = k6Request{Method: t.Method, URL: t.URL, Body: string(t.Body), Params: k6Params{Headers: h}}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,275 @@
+package bench_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/api"
+	"github.com/iamskyy666/simple-api/bench"
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+const seeded = 100
+
+func newServer(b *testing.B, mutate func(*config.Config)) (http.Handler, []models.User) {
+	b.Helper()
+	cfg := config.FromEnv()
+	cfg.ServeUI = false
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	st := store.NewMemory()
+	users, err := bench.Seed(context.Background(), st, seeded)
+	if err != nil {
+		b.Fatal(err)
+	}
+	srv, err := api.New(cfg, st)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return srv, users
+}
+
+func serve(b *testing.B, h http.Handler, method, target string, body []byte, want int) {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != want {
+		b.Fatalf("%s %s: got %d, want %d: %s", method, target, rec.Code, want, rec.Body)
+	}
+}
+
+func BenchmarkListUsers(b *testing.B) {
+	h, _ := newServer(b, nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		serve(b, h, http.MethodGet, "/users", nil, http.StatusOK)
+	}
+}
+
+func BenchmarkListUsersFiltered(b *testing.B) {
+	h, _ := newServer(b, nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		serve(b, h, http.MethodGet, "/users?filter=email:prefix:bench1", nil, http.StatusOK)
+	}
+}
+
+func BenchmarkListUsersHypermedia(b *testing.B) {
+	h, _ := newServer(b, func(c *config.Config) { c.Hypermedia = true })
+	b.ReportAllocs()
+	for b.Loop() {
+		serve(b, h, http.MethodGet, "/users", nil, http.StatusOK)
+	}
+}
+
+func BenchmarkGetUser(b *testing.B) {
+	h, users := newServer(b, nil)
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		serve(b, h, http.MethodGet, "/users/"+users[i%len(users)].ID, nil, http.StatusOK)
+		i++
+	}
+}
+
+func BenchmarkGetUserByEmail(b *testing.B) {
+	h, users := newServer(b, nil)
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		serve(b, h, http.MethodGet, "/users/by-email/"+users[i%len(users)].Email, nil, http.StatusOK)
+		i++
+	}
+}
+
+func BenchmarkCreateUser(b *testing.B) {
+	h, _ := newServer(b, nil)
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		body := fmt.Appendf(nil, `{"name":"New %d","email":"new%d@example.com"}`, i, i)
+		serve(b, h, http.MethodPost, "/users", body, http.StatusCreated)
+		i++
+	}
+}
+
+var importRows = flag.Int("import-rows", 1_000_000, "users per BenchmarkImport run")
+
+// BenchmarkImport loads -import-rows users into an empty store: one POST
+// /users per row, then POST /users/import with one worker and with
+// GOMAXPROCS. rows/s is the figure to compare; B/op and allocs/op show
+// what the pooled chunks save. each run is a million rows by default, so:
+//
+//	go test ./bench -run x -bench Import -benchtime 1x
+func BenchmarkImport(b *testing.B) {
+	var body bytes.Buffer
+	for i := range *importRows {
+		u := bench.SampleUser(seeded + i) // past the seeded ones
+		fmt.Fprintf(&body, `{"name":%q,"email":%q}`+"\n", u.Name, u.Email)
+	}
+	run := func(b *testing.B, workers int, load func(h http.Handler)) {
+		b.ReportAllocs()
+		for range b.N {
+			b.StopTimer()
+			h, _ := newServer(b, func(c *config.Config) {
+				c.Search = "off" // indexing isn't what's measured
+				c.ImportConcurrency = workers
+			})
+			b.StartTimer()
+			load(h)
+		}
+		b.ReportMetric(float64(*importRows*b.N)/b.Elapsed().Seconds(), "rows/s")
+	}
+
+	b.Run("one by one", func(b *testing.B) {
+		run(b, 1, func(h http.Handler) {
+			for line := range bytes.Lines(body.Bytes()) {
+				serve(b, h, http.MethodPost, "/users", line, http.StatusCreated)
+			}
+		})
+	})
+	for _, workers := range slices.Compact([]int{1, runtime.GOMAXPROCS(0)}) {
+		b.Run(fmt.Sprintf("import/workers=%d", workers), func(b *testing.B) {
+			run(b, workers, func(h http.Handler) {
+				req := httptest.NewRequest(http.MethodPost, "/users/import", bytes.NewReader(body.Bytes()))
+				req.Header.Set("Content-Type", "application/x-ndjson")
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), fmt.Appendf(nil, `"imported":%d,"failed":0`, *importRows)) {
+					b.Fatalf("import: %d: %s", rec.Code, rec.Body)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkBatch(b *testing.B) {
+	h, users := newServer(b, nil)
+	body := fmt.Appendf(nil, `{"concurrent":true,"requests":[
+		{"method":"GET","path":"/users/%s"},
+		{"method":"GET","path":"/users/%s"},
+		{"method":"GET","path":"/users?filter=name:contains:user 4"}]}`, users[0].ID, users[1].ID)
+	b.ReportAllocs()
+	for b.Loop() {
+		serve(b, h, http.MethodPost, "/batch", body, http.StatusOK)
+	}
+}
+
+// the hot path benchmarks reuse one request and throw the response away, so
+// allocs/op is the server's own - the recorder and request parsing above
+// account for about half of what the endpoint benchmarks report. they also
+// report p99 latency (over the last 8192 iterations).
+
+type discard struct {
+	h    http.Header
+	code int
+}
+
+func (d *discard) Header() http.Header         { return d.h }
+func (d *discard) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discard) WriteHeader(code int)        { d.code = code }
+
+type latencies struct {
+	samples [8192]time.Duration
+	n       int
+}
+
+func (l *latencies) observe(d time.Duration) {
+	l.samples[l.n%len(l.samples)] = d
+	l.n++
+}
+
+func (l *latencies) report(b *testing.B) {
+	s := slices.Clone(l.samples[:min(l.n, len(l.samples))])
+	if len(s) == 0 {
+		return
+	}
+	slices.Sort(s)
+	b.ReportMetric(float64(s[len(s)*99/100].Nanoseconds()), "p99-ns")
+}
+
+func hotPath(b *testing.B, h http.Handler, target string, want int) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Accept", "application/json")
+	w := &discard{h: http.Header{}}
+	var lat latencies
+	b.ReportAllocs()
+	for b.Loop() {
+		clear(w.h)
+		start := time.Now()
+		h.ServeHTTP(w, req)
+		lat.observe(time.Since(start))
+		if w.code != want {
+			b.Fatalf("GET %s: got %d, want %d", target, w.code, want)
+		}
+	}
+	lat.report(b)
+}
+
+func BenchmarkHotPathGetUser(b *testing.B) {
+	h, users := newServer(b, nil)
+	hotPath(b, h, "/users/"+users[0].ID, http.StatusOK)
+}
+
+// with read coalescing, which New only turns on for the networked backends
+// (the store here is still memory): what the singleflight bookkeeping costs
+func BenchmarkHotPathGetUserCoalesced(b *testing.B) {
+	h, users := newServer(b, func(c *config.Config) { c.Storage = "postgres" })
+	hotPath(b, h, "/users/"+users[0].ID, http.StatusOK)
+}
+
+func BenchmarkHotPathNotModified(b *testing.B) {
+	h, users := newServer(b, nil)
+	req := httptest.NewRequest(http.MethodGet, "/users/"+users[0].ID, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	target := "/users/" + users[0].ID
+	req = httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	w := &discard{h: http.Header{}}
+	b.ReportAllocs()
+	for b.Loop() {
+		clear(w.h)
+		h.ServeHTTP(w, req)
+		if w.code != http.StatusNotModified {
+			b.Fatalf("GET %s: got %d, want 304", target, w.code)
+		}
+	}
+}
+
+func BenchmarkHotPathVersion(b *testing.B) {
+	h, _ := newServer(b, nil)
+	hotPath(b, h, "/version", http.StatusOK)
+}
+
+// ids are checked on every /users/{id} request; none of that may allocate
+func TestIDsDoNotAllocate(t *testing.T) {
+	id := ids.New()
+	for name, fn := range map[string]func(){
+		"Valid ulid":      func() { ids.Valid(id) },
+		"Valid legacy":    func() { ids.Valid("42") },
+		"Legacy ulid":     func() { ids.Legacy(id) },
+		"Canonical ulid":  func() { ids.Canonical(id) },
+		"Canonical other": func() { ids.Canonical("42") },
+	} {
+		if n := testing.AllocsPerRun(100, fn); n != 0 {
+			t.Errorf("%s: %v allocs, want 0", name, n)
+		}
+	}
+}
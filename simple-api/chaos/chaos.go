@@ -0,0 +1,127 @@
+// Package chaos injects faults into http handlers so client retry logic and
+// timeouts can be exercised against a real server. dev/test only - the api
+// refuses to install it when APP_ENV=prod.
+//
+// rules are "prefix:key=value,..." separated by ";", eg
+//
+//	CHAOS="/users:latency=200ms,jitter=100ms,error=0.1;/batch:drop=0.05"
+//
+// options:
+//   - latency/jitter: delay before the handler runs (latency + rand(0, jitter))
+//   - error: probability of answering 500 instead of calling the handler
+//   - drop: probability of killing the connection without a response
+//
+// the longest matching prefix wins.
+package chaos
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Rule struct {
+	Prefix  string
+	Latency time.Duration
+	Jitter  time.Duration
+	Error   float64 // 0..1
+	Drop    float64 // 0..1
+}
+
+// Parse reads the CHAOS syntax described in the package doc.
+func Parse(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		prefix, opts, ok := strings.Cut(part, ":")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("chaos rule %q: want /prefix:key=value,...", part)
+		}
+		r := Rule{Prefix: prefix}
+		for _, opt := range strings.Split(opts, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			var err error
+			switch k {
+			case "latency":
+				r.Latency, err = time.ParseDuration(v)
+			case "jitter":
+				r.Jitter, err = time.ParseDuration(v)
+			case "error":
+				r.Error, err = probability(v)
+			case "drop":
+				r.Drop, err = probability(v)
+			default:
+				err = fmt.Errorf("unknown option %q", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("chaos rule %q: %w", part, err)
+			}
+		}
+		rules = append(rules, r)
+	}
+	// longest prefix first, so the first match is the most specific one
+	sort.Slice(rules, func(i, j int) bool { return len(rules[i].Prefix) > len(rules[j].Prefix) })
+	return rules, nil
+}
+
+func probability(v string) (float64, error) {
+	p, err := strconv.ParseFloat(v, 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0, fmt.Errorf("probability %q must be between 0 and 1", v)
+	}
+	return p, nil
+}
+
+// Middleware applies the first rule matching the request path.
+func Middleware(rules []Rule, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := match(rules, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if d := rule.Latency + jitter(rule.Jitter); d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				t.Stop()
+				return
+			}
+		}
+		if rand.Float64() < rule.Drop {
+			// the server closes the connection (h1) or resets the stream (h2)
+			panic(http.ErrAbortHandler)
+		}
+		if rand.Float64() < rule.Error {
+			w.Header().Set("X-Chaos", "injected")
+			http.Error(w, "chaos: injected failure", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func match(rules []Rule, path string) (Rule, bool) {
+	for _, r := range rules {
+		if strings.HasPrefix(path, r.Prefix) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/api"
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/lock"
+	"github.com/iamskyy666/simple-api/store"
+	"github.com/iamskyy666/simple-api/templates"
+)
+
+// the startup self-check: what would make this process fail, or serve
+// wrong, once it's up - looked at before it is. every boot logs the report
+// and refuses to start past a failure; --check prints it as json and exits
+// 1 on a failure, without migrating or listening, for ci and deploy gates:
+//
+//	STORAGE=postgres DATABASE_URL=... ./simple-api --check
+//
+// warnings (a short secret, a cert close to expiry) never fail it.
+
+type checkStatus string
+
+const (
+	checkOK   checkStatus = "ok"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+	checkSkip checkStatus = "skip" // doesn't apply to this config
+)
+
+type checkResult struct {
+	Name   string      `json:"name"`
+	Status checkStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+type checkReport struct {
+	OK     bool          `json:"ok"` // nothing failed
+	Checks []checkResult `json:"checks"`
+}
+
+func (r *checkReport) add(name string, status checkStatus, detail string) {
+	r.Checks = append(r.Checks, checkResult{Name: name, Status: status, Detail: detail})
+	if status == checkFail {
+		r.OK = false
+	}
+}
+
+// result adds a check that passed unless err is set.
+func (r *checkReport) result(name string, err error) {
+	if err != nil {
+		r.add(name, checkFail, err.Error())
+		return
+	}
+	r.add(name, checkOK, "")
+}
+
+func (r *checkReport) failed() []string {
+	var names []string
+	for _, c := range r.Checks {
+		if c.Status == checkFail {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// log writes one line per check, at a level to match.
+func (r *checkReport) log() {
+	for _, c := range r.Checks {
+		level := slog.LevelInfo
+		switch c.Status {
+		case checkWarn:
+			level = slog.LevelWarn
+		case checkFail:
+			level = slog.LevelError
+		}
+		slog.Log(context.Background(), level, "self-check", "check", c.Name, "status", c.Status, "detail", c.Detail)
+	}
+}
+
+// certWarning is how close to expiry the serving cert gets before the check
+// says so.
+const certWarning = 14 * 24 * time.Hour
+
+// selfCheck runs every check against cfg and the backends. migrating says
+// whether the caller is about to migrate - on boot a schema that isn't there
+// yet is about to be, so it's a warning rather than a failure.
+func selfCheck(cfg config.Config, b backends, migrating bool) checkReport {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rep := checkReport{OK: true}
+
+	err := errors.Join(cfg.Validate(), api.CheckConfig(cfg))
+	if err == nil {
+		_, err = clientTLS(cfg) // reads the CA file
+	}
+	rep.result("config", err)
+	checkCert(&rep, cfg)
+	checkSecrets(&rep, cfg)
+	_, err = templates.Load(cfg.EmailTemplatesDir)
+	rep.result("email templates", err)
+
+	if b.primary != nil {
+		rep.result("postgres primary", b.primary.PingContext(ctx))
+	}
+	if b.replica != nil {
+		rep.result("postgres replica", b.replica.PingContext(ctx))
+	}
+	if b.mongo != nil {
+		rep.result("mongo", b.mongo.Client().Ping(ctx, nil))
+	}
+	if cfg.LockBackend == "redis" {
+		rep.result("redis", lock.NewRedis(cfg.RedisAddr, cfg.RedisPassword, cfg.LockTTL).Ping(ctx))
+	}
+
+	var schema func(context.Context) error
+	switch {
+	case cfg.Storage == "postgres" && b.primary != nil:
+		schema = store.NewPostgres(b.primary, b.replica).CheckSchema
+	case cfg.Storage == "mongo" && b.mongo != nil:
+		schema = func(ctx context.Context) error { return store.CheckMongoSchema(ctx, b.mongo) }
+	}
+	if schema == nil && (cfg.Storage == "postgres" || cfg.Storage == "mongo") {
+		rep.add("migrations", checkSkip, "no database to look at") // config has failed
+	} else if schema == nil {
+		rep.add("migrations", checkSkip, "nothing to migrate with STORAGE="+cfg.Storage)
+	} else if err := schema(ctx); err != nil && migrating {
+		rep.add("migrations", checkWarn, err.Error()+" (migrating now)")
+	} else {
+		rep.result("migrations", err)
+	}
+
+	// taken by another process, or not ours to bind - better found out here
+	// than after the migration ran
+	if ln, err := net.Listen("tcp", cfg.Addr); err != nil {
+		rep.add("port", checkFail, err.Error())
+	} else {
+		ln.Close()
+		rep.add("port", checkOK, cfg.Addr)
+	}
+	return rep
+}
+
+// checkCert loads the serving cert the way ListenAndServeTLS will, and looks
+// at its expiry.
+func checkCert(rep *checkReport, cfg config.Config) {
+	if cfg.TLSCert == "" || cfg.TLSKey == "" {
+		rep.add("tls", checkSkip, "plain http")
+		return
+	}
+	pair, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		rep.add("tls", checkFail, err.Error())
+		return
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		rep.add("tls", checkFail, err.Error())
+		return
+	}
+	expires := "expires " + leaf.NotAfter.UTC().Format(time.RFC3339)
+	switch left := time.Until(leaf.NotAfter); {
+	case left <= 0:
+		rep.add("tls", checkFail, "certificate expired "+leaf.NotAfter.UTC().Format(time.RFC3339))
+	case left < certWarning:
+		rep.add("tls", checkWarn, expires)
+	default:
+		rep.add("tls", checkOK, expires)
+	}
+}
+
+// checkSecrets warns about secrets that are set but weak; the ones that are
+// required and missing are config failures already.
+func checkSecrets(rep *checkReport, cfg config.Config) {
+	var weak []string
+	for _, p := range cfg.SigningKeys {
+		if id, secret, ok := strings.Cut(p, ":"); ok && secret != "" && len(secret) < 32 {
+			weak = append(weak, fmt.Sprintf("SIGNING_KEYS %q is shorter than 32 bytes", id))
+		}
+	}
+	if cfg.AnomalyWebhookSecret != "" && len(cfg.AnomalyWebhookSecret) < 32 {
+		weak = append(weak, "ANOMALY_WEBHOOK_SECRET is shorter than 32 bytes")
+	}
+	if cfg.AdminPassword != "" && len(cfg.AdminPassword) < 12 {
+		weak = append(weak, "ADMIN_PASSWORD is shorter than 12 characters")
+	}
+	if cfg.LifecycleToken != "" && len(cfg.LifecycleToken) < 16 {
+		weak = append(weak, "LIFECYCLE_TOKEN is shorter than 16 characters")
+	}
+	if cfg.IsProd() && cfg.LockBackend == "redis" && cfg.RedisPassword == "" {
+		weak = append(weak, "REDIS_PASSWORD is not set")
+	}
+	if len(weak) > 0 {
+		rep.add("secrets", checkWarn, strings.Join(weak, "; "))
+		return
+	}
+	rep.add("secrets", checkOK, "")
+}
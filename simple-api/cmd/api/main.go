@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/iamskyy666/simple-api/api"
+	"github.com/iamskyy666/simple-api/config"
+	"github.com/iamskyy666/simple-api/jobs"
+	"github.com/iamskyy666/simple-api/leader"
+	"github.com/iamskyy666/simple-api/lock"
+	"github.com/iamskyy666/simple-api/metrics"
+	"github.com/iamskyy666/simple-api/store"
+	"github.com/iamskyy666/simple-api/version"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"golang.org/x/net/http2"
+)
+
+func main() {
+	check := flag.Bool("check", false, "run the startup self-check, print it as json and exit (1 if a check failed)")
+	flag.Parse()
+	if *check {
+		os.Exit(checkOnly())
+	}
+	if err := run(); err != nil {
+		slog.Error("exiting", "err", err)
+		os.Exit(1)
+	}
+}
+
+// run is the whole server's life; it returns when it has shut down, so the
+// deferred cleanup happens on the error paths too.
+func run() error {
+	cfg := config.FromEnv()
+	v := version.Get()
+	slog.Info("starting", "version", v.Version, "commit", v.Commit, "built", v.BuildDate)
+	slog.Info("config loaded", "config", cfg)
+
+	b, err := openBackends(cfg)
+	if err != nil {
+		return err
+	}
+	defer logClose("backends", b.close) // last: the store and the locker use them
+	rep := selfCheck(cfg, b, true)
+	rep.log()
+	if !rep.OK {
+		return fmt.Errorf("self-check failed: %s", strings.Join(rep.failed(), ", "))
+	}
+	st, closeStore, err := newStore(cfg, b)
+	if err != nil {
+		return err
+	}
+	defer logClose("store", closeStore) // once the server has drained and the jobs are done
+	handler, err := api.New(cfg, st)
+	if err != nil {
+		return err
+	}
+	locker, err := newLocker(cfg, b.primary)
+	if err != nil {
+		return err
+	}
+	if r, ok := locker.(*lock.Redis); ok {
+		handler.CheckDependency("redis", r.Ping)
+	}
+	sched := jobs.NewScheduler(locker)
+	if err := sched.Add(handler.Jobs()...); err != nil {
+		return err
+	}
+	mem, _ := st.(*store.Memory)
+	if mem != nil && cfg.SnapshotFile != "" {
+		err := sched.Add(jobs.Job{
+			Name:  "memory-snapshot",
+			Every: cfg.SnapshotEvery,
+			Run:   func(ctx context.Context) error { return mem.SaveSnapshot(ctx, cfg.SnapshotFile) },
+			Local: true, // it's this process' table
+		})
+		if err != nil {
+			return err
+		}
+	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	var elector *leader.Elector
+	if cfg.LeaderElection {
+		elector = leader.New(locker, "background", instanceID(), cfg.LeaseTTL)
+		sched.FollowLeader(elector)
+		handler.FollowLeader(elector)
+	}
+	go func() {
+		defer close(jobsDone)
+		if elector == nil {
+			sched.Run(jobsCtx)
+			return
+		}
+		ran := make(chan struct{})
+		go func() {
+			defer close(ran)
+			sched.Run(jobsCtx)
+		}()
+		elector.Run(jobsCtx) // releases the lease on the way out
+		<-ran                // a snapshot run mustn't overlap the one at shutdown
+	}()
+	// on the error paths; shutdown stops them first thing. waited for, so
+	// no job is still using the store when it closes
+	defer func() {
+		stopJobs()
+		<-jobsDone
+	}()
+
+	tlsConf, err := clientTLS(cfg)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:      cfg.Addr,
+		Handler:   handler,
+		TLSConfig: tlsConf,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLSCert != "" && cfg.TLSKey != "" {
+			// h2 needs tls, so only bother configuring it for the https listener
+			if err := http2.ConfigureServer(server, &http2.Server{}); err != nil {
+				serveErr <- err
+				return
+			}
+			fmt.Println("✅ Server is listening (https) on:", cfg.Addr)
+			serveErr <- server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			fmt.Println("✅ Server is listening on:", cfg.Addr)
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	// k8s sends SIGTERM (after any preStop hook); ctrl-c is SIGINT
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case s := <-sig:
+		slog.Info("shutdown: signal received", "signal", s.String())
+	case <-handler.QuitRequested():
+		slog.Info("shutdown: requested via /quitquitquit")
+	}
+
+	// readiness goes red first and we keep serving while the load balancer
+	// catches up - closing the listener straight away is what causes 502s
+	handler.StartDraining()
+	stopJobs() // nothing new starts; a running job gets until Shutdown finishes
+	slog.Info("shutdown: draining", "delay", cfg.DrainDelay)
+	select {
+	case <-time.After(cfg.DrainDelay):
+	case <-sig: // second signal: skip the wait
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	<-jobsDone
+	if mem != nil && cfg.SnapshotFile != "" {
+		// after Shutdown, so the last in-flight writes are in it
+		if err := mem.SaveSnapshot(context.Background(), cfg.SnapshotFile); err != nil {
+			slog.Error("shutdown: snapshot failed", "err", err)
+		}
+	}
+	slog.Info("shutdown: done")
+	return nil
+}
+
+// checkOnly is --check: the self-check on its own, the report on stdout and
+// the exit code for whoever asked. nothing is migrated or listened on.
+func checkOnly() int {
+	cfg := config.FromEnv()
+	b, err := openBackends(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer logClose("backends", b.close)
+	rep := selfCheck(cfg, b, false)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(rep)
+	if !rep.OK {
+		return 1
+	}
+	return 0
+}
+
+// backends are the connections the store, the locker and the self-check
+// share. opening them doesn't dial anything; the first use (or the
+// self-check's ping) does.
+type backends struct {
+	primary, replica *sql.DB         // nil without DATABASE_URL
+	mongo            *mongo.Database // nil unless STORAGE=mongo
+}
+
+// close closes the pools and disconnects from mongo.
+func (b backends) close() error {
+	var errs []error
+	for _, db := range []*sql.DB{b.replica, b.primary} {
+		if db != nil {
+			errs = append(errs, db.Close())
+		}
+	}
+	if b.mongo != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		errs = append(errs, b.mongo.Client().Disconnect(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// logClose runs release on the way out, where an error has nowhere to go
+// but the log.
+func logClose(what string, release func() error) {
+	if err := release(); err != nil {
+		slog.Error("shutdown: closing "+what+" failed", "err", err)
+	}
+}
+
+func openBackends(cfg config.Config) (backends, error) {
+	var b backends
+	var err error
+	if b.primary, b.replica, err = openDB(cfg); err != nil {
+		return b, err
+	}
+	if cfg.Storage == "mongo" {
+		client, err := mongo.Connect(options.Client().ApplyURI(cfg.MongoURL))
+		if err != nil {
+			return b, err
+		}
+		b.mongo = client.Database(cfg.MongoDB)
+	}
+	return b, nil
+}
+
+// openDB opens the primary pool and, if DATABASE_READ_URL is set, the replica
+// pool. both are nil without DATABASE_URL.
+func openDB(cfg config.Config) (primary, replica *sql.DB, err error) {
+	if cfg.DatabaseURL == "" {
+		return nil, nil, nil
+	}
+	if primary, err = openPool(cfg, cfg.DatabaseURL, "primary"); err != nil {
+		return nil, nil, err
+	}
+	if cfg.DatabaseReadURL != "" {
+		if replica, err = openPool(cfg, cfg.DatabaseReadURL, "replica"); err != nil {
+			return nil, nil, err
+		}
+	}
+	return primary, replica, nil
+}
+
+// openPool opens one pool sized from config, with its sql.DBStats in /metrics.
+func openPool(cfg config.Config, dsn, name string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+	metrics.Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+	return db, nil
+}
+
+// newStore opens the configured store and returns it with what releases it:
+// bolt's file lock, postgres' cached statements (the connections are the
+// backends', see backends.close).
+func newStore(cfg config.Config, b backends) (store.Storage, func() error, error) {
+	noop := func() error { return nil }
+	switch cfg.Storage {
+	case "memory", "":
+		m := store.NewMemory()
+		if cfg.SnapshotFile != "" {
+			n, err := m.LoadSnapshot(cfg.SnapshotFile)
+			if err != nil {
+				return nil, nil, err
+			}
+			slog.Info("memory: snapshot loaded", "file", cfg.SnapshotFile, "users", n)
+		}
+		return m, noop, nil
+	case "bolt":
+		bolt, err := store.OpenBolt(cfg.BoltPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bolt, bolt.Close, nil
+	case "mongo":
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		m, err := store.NewMongo(ctx, b.mongo, cfg.MongoTimeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		return m, noop, nil
+	case "postgres":
+		if b.primary == nil {
+			return nil, nil, errors.New("STORAGE=postgres needs DATABASE_URL")
+		}
+		pg := store.NewPostgres(b.primary, b.replica)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := pg.Migrate(ctx); err != nil {
+			pg.Close()
+			return nil, nil, fmt.Errorf("migrate: %w", err)
+		}
+		return pg, pg.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown STORAGE %q (want memory, bolt, mongo or postgres)", cfg.Storage)
+	}
+}
+
+// newLocker picks the backend replicas coordinate through (job locks, leader lease).
+func newLocker(cfg config.Config, db *sql.DB) (lock.Backend, error) {
+	switch cfg.LockBackend {
+	case "local", "":
+		return lock.NewLocal(), nil
+	case "postgres":
+		if db == nil {
+			return nil, errors.New("LOCK_BACKEND=postgres needs DATABASE_URL")
+		}
+		return lock.NewPostgres(db), nil
+	case "redis":
+		return lock.NewRedis(cfg.RedisAddr, cfg.RedisPassword, cfg.LockTTL), nil
+	default:
+		return nil, fmt.Errorf("unknown LOCK_BACKEND %q (want local, postgres or redis)", cfg.LockBackend)
+	}
+}
+
+// clientTLS is the tls config for mTLS (nil with TLS_CLIENT_AUTH=off): which
+// CAs client certificates must chain to, and whether one is required.
+func clientTLS(cfg config.Config) (*tls.Config, error) {
+	var mode tls.ClientAuthType
+	switch cfg.ClientAuth {
+	case "off":
+		return nil, nil
+	case "optional":
+		mode = tls.VerifyClientCertIfGiven
+	case "require":
+		mode = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("TLS_CLIENT_AUTH %q: want off, optional or require", cfg.ClientAuth)
+	}
+	if cfg.TLSCert == "" || cfg.TLSKey == "" {
+		return nil, errors.New("TLS_CLIENT_AUTH needs TLS_CERT and TLS_KEY - client certs only exist over https")
+	}
+	pem, err := os.ReadFile(cfg.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("TLS_CLIENT_CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("TLS_CLIENT_CA %s: no certificates found", cfg.ClientCA)
+	}
+	return &tls.Config{ClientCAs: pool, ClientAuth: mode, MinVersion: tls.VersionTLS12}, nil
+}
+
+// instanceID names this replica in the leader lease - the pod name under k8s.
+func instanceID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
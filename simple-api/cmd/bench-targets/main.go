@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/iamskyy666/simple-api/bench"
+)
+
+// prints load-test targets for the main endpoints, see package bench.
+func main() {
+	base := flag.String("base", "http://localhost:3000", "base url of the api under test")
+	n := flag.Int("n", 100, "number of users to create (each adds a create, a lookup and a list call)")
+	format := flag.String("format", "vegeta", "output format: vegeta or k6")
+	flag.Parse()
+
+	targets := bench.Targets(strings.TrimSuffix(*base, "/"), *n)
+
+	var err error
+	switch *format {
+	case "vegeta":
+		err = bench.WriteVegeta(os.Stdout, targets)
+	case "k6":
+		err = bench.WriteK6(os.Stdout, targets)
+	default:
+		log.Fatalf("⚠️ ERR: unknown format %q (want vegeta or k6)", *format)
+	}
+	if err != nil {
+		log.Fatal("⚠️ ERR:", err)
+	}
+}
@@ -0,0 +1,477 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/redact"
+)
+
+// Config holds every knob the api server reads on startup.
+// values come from env vars so the same binary works locally and in containers.
+type Config struct {
+	Env  string // dev, test or prod - gates dev-only features like chaos
+	Addr string // listen address, eg ":3000"
+
+	// TLS - both must be set to serve https (cert.pem/key.pem from openssl)
+	TLSCert string
+	TLSKey  string
+
+	// mTLS: ClientAuth is off, optional (verify a cert if one is sent) or
+	// require; certs must chain to ClientCA (a pem bundle). ClientCertMap
+	// maps them to identities, see api/clientcert.go
+	ClientAuth    string
+	ClientCA      string
+	ClientCertMap []string
+
+	// ServeUI mounts the embedded SPA (web/dist) on "/"
+	ServeUI bool
+
+	// EmailTemplatesDir overrides the embedded email templates, file by
+	// file (see package templates)
+	EmailTemplatesDir string
+
+	// Hypermedia adds "_links" to resources (HATEOAS)
+	Hypermedia bool
+	// TrustProxy says a proxy is in front: X-Forwarded-Proto/Host build
+	// absolute urls, and the last X-Forwarded-For hop is the client ip that
+	// quotas and rate limits count against
+	TrustProxy bool
+
+	// RequestTimeout is how long a request may take before its context is
+	// cancelled, 0 for no limit - the default, as the timer costs every
+	// request a few allocs (see bench). routes can override it (see
+	// api/routes.go)
+	RequestTimeout time.Duration
+
+	// long-polling on /users/changes
+	LongPollTimeout time.Duration // max time a request is held open
+	ChangeFeedSize  int           // how many changes are remembered for late pollers
+
+	// RevisionsKept is how many revisions of each user /users/{id}/revisions
+	// keeps; RevisionsMaxAge drops older ones too (0 = keep them), bar a live
+	// user's newest
+	RevisionsKept   int
+	RevisionsMaxAge time.Duration
+
+	// POST /batch limits
+	BatchMaxItems    int
+	BatchConcurrency int // max sub-requests in flight for a concurrent batch
+
+	// POST /users/import: workers decoding and storing rows, one per cpu by default
+	ImportConcurrency int
+
+	// debug recording: path prefixes to capture ("*" for all), viewable at /admin/requests
+	DebugRecord     []string
+	DebugRecordSize int
+
+	// fault injection rules, see package chaos. set in prod, startup fails
+	Chaos string
+
+	// anomaly alerts (see api/anomaly.go): every AnomalyWindow, a route whose
+	// 5xx rate or p95 latency is AnomalyFactor times its baseline is logged,
+	// and POSTed to AnomalyWebhook if set - signed with AnomalyWebhookSecret
+	// if that's set too, see package webhook. windows with fewer than
+	// AnomalyMinRequests requests aren't judged. 0 window = off
+	AnomalyWindow        time.Duration
+	AnomalyFactor        int
+	AnomalyMinRequests   int
+	AnomalyWebhook       string `log:"redact"` // chat webhook urls carry their token
+	AnomalyWebhookSecret string `log:"redact"`
+
+	// GET /status checks the dependencies this often, keeping the last
+	// StatusHistory results of each. 0 = no checks, /status has incidents only
+	StatusCheckInterval time.Duration
+	StatusHistory       int
+
+	// shutdown: time between readiness going red and closing listeners
+	// (lets the LB notice), then how long in-flight requests get to finish
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+	LifecycleToken  string `log:"redact"` // enables POST /quitquitquit
+
+	// Storage is memory, bolt (an embedded file at BoltPath), mongo or postgres.
+	// with postgres, DatabaseURL is the primary and DatabaseReadURL (optional)
+	// a replica that serves reads; a client that wrote reads from the primary
+	// for ReadYourWrites afterwards (0 = off)
+	Storage         string
+	BoltPath        string
+	MongoURL        string `log:"redact"`
+	MongoDB         string
+	MongoTimeout    time.Duration // per call
+	DatabaseURL     string        `log:"redact"`
+	DatabaseReadURL string        `log:"redact"`
+	ReadYourWrites  time.Duration
+	// GET /users/search: Search is bleve (embedded; in memory unless
+	// SearchPath is set), elasticsearch (ElasticURL, ElasticIndex) or off
+	Search       string
+	SearchPath   string
+	ElasticURL   string `log:"redact"` // may carry credentials
+	ElasticIndex string
+
+	// memory backend only: keep the table in a json file across restarts
+	// (loaded on start, saved every SnapshotEvery and on shutdown). "" = off
+	SnapshotFile  string
+	SnapshotEvery time.Duration
+
+	// sql pool sizing (applies to the primary and replica pools alike).
+	// readiness fails once a pool has been exhausted for DBPoolExhaustedFor
+	DBMaxOpenConns     int
+	DBMaxIdleConns     int
+	DBConnMaxLifetime  time.Duration
+	DBConnMaxIdleTime  time.Duration
+	DBPoolExhaustedFor time.Duration
+	// storage calls slower than this are logged (0 = off); all are in /metrics
+	SlowQuery time.Duration
+	// CoalesceReads has identical concurrent reads share one storage call
+	// (postgres and mongo; the in-process backends don't need it), given up
+	// after CoalesceTimeout - it outlives the callers that started it
+	CoalesceReads   bool
+	CoalesceTimeout time.Duration
+
+	// background jobs: LockBackend is local, postgres (on DatabaseURL) or
+	// redis. local is only right with one replica - with more, every pod runs
+	// every job
+	LockBackend   string
+	RedisAddr     string
+	RedisPassword string        `log:"redact"`
+	LockTTL       time.Duration // redis only: how long a crashed holder blocks a job
+
+	// LeaderElection limits background work to one elected replica, using the
+	// lock backend's leases. LeaseTTL is how long failover can take
+	LeaderElection bool
+	LeaseTTL       time.Duration
+
+	// HMAC request signing (see api/signing.go): SigningKeys are "id:secret"
+	// pairs; RequireSignature turns away unsigned api calls. SignatureSkew is
+	// how far a signed timestamp may be off, and how long nonces are kept
+	SigningKeys      []string `log:"redact"`
+	RequireSignature bool
+	SignatureSkew    time.Duration
+
+	// UndoWindow is how long deleted users can be restored with the undo
+	// token the delete returned (0 = deletes are final)
+	UndoWindow time.Duration
+
+	// Maintenance starts the server in maintenance mode (writes get 503);
+	// it can be switched at runtime via /admin/maintenance
+	Maintenance bool
+
+	// MonthlyQuota caps requests to /users per caller - a client cert's or
+	// signature's identity, a key from APIKeys, else the client ip - and
+	// calendar month, per replica; 0 counts without limiting. see GET /usage.
+	// per-route rate limits never count by api key
+	MonthlyQuota int
+	// APIKeys are "name:key" pairs. a request whose X-Api-Key is one of them
+	// counts against that name; any other key counts against the caller's ip
+	APIKeys []string `log:"redact"`
+
+	// admin ui (/admin/ui) - disabled unless a password is set
+	AdminUser     string
+	AdminPassword string `log:"redact"`
+	SessionTTL    time.Duration
+}
+
+// LogValue masks secrets, so the whole config can be logged on startup.
+func (c Config) LogValue() slog.Value { return redact.Value(c) }
+
+func (c Config) IsProd() bool { return c.Env == "prod" }
+
+// FromEnv builds a Config from the environment, falling back to sane dev
+// defaults - also for values it can't parse, which Validate reports.
+func FromEnv() Config {
+	unparsed.Lock()
+	unparsed.vars = nil
+	unparsed.Unlock()
+	return Config{
+		Env:     getString("APP_ENV", "dev"),
+		Addr:    addr(),
+		TLSCert: getString("TLS_CERT", ""),
+		TLSKey:  getString("TLS_KEY", ""),
+
+		ClientAuth:    getString("TLS_CLIENT_AUTH", "off"),
+		ClientCA:      getString("TLS_CLIENT_CA", ""),
+		ClientCertMap: getList("CLIENT_CERT_MAP"),
+
+		ServeUI: getBool("SERVE_UI", true),
+
+		EmailTemplatesDir: getString("EMAIL_TEMPLATES_DIR", ""),
+
+		Hypermedia: getBool("HYPERMEDIA", false),
+		TrustProxy: getBool("TRUST_PROXY", false),
+
+		RequestTimeout: getDuration("REQUEST_TIMEOUT", 0),
+
+		LongPollTimeout: getDuration("LONG_POLL_TIMEOUT", 30*time.Second),
+		ChangeFeedSize:  getInt("CHANGE_FEED_SIZE", 1000),
+
+		RevisionsKept:   getInt("REVISIONS_KEPT", 50),
+		RevisionsMaxAge: getDuration("REVISIONS_MAX_AGE", 90*24*time.Hour),
+
+		BatchMaxItems:    getInt("BATCH_MAX_ITEMS", 20),
+		BatchConcurrency: getInt("BATCH_CONCURRENCY", 4),
+
+		ImportConcurrency: getInt("IMPORT_CONCURRENCY", runtime.NumCPU()),
+
+		DebugRecord:     getList("DEBUG_RECORD"),
+		DebugRecordSize: getInt("DEBUG_RECORD_SIZE", 200),
+
+		Chaos: getString("CHAOS", ""),
+
+		AnomalyWindow:        getDuration("ANOMALY_WINDOW", time.Minute),
+		AnomalyFactor:        getInt("ANOMALY_FACTOR", 3),
+		AnomalyMinRequests:   getInt("ANOMALY_MIN_REQUESTS", 20),
+		AnomalyWebhook:       getString("ANOMALY_WEBHOOK", ""),
+		AnomalyWebhookSecret: getString("ANOMALY_WEBHOOK_SECRET", ""),
+
+		StatusCheckInterval: getDuration("STATUS_CHECK_INTERVAL", 30*time.Second),
+		StatusHistory:       getInt("STATUS_HISTORY", 120),
+
+		DrainDelay:      getDuration("DRAIN_DELAY", 5*time.Second),
+		ShutdownTimeout: getDuration("SHUTDOWN_TIMEOUT", 20*time.Second),
+		LifecycleToken:  getString("LIFECYCLE_TOKEN", ""),
+
+		Storage:         getString("STORAGE", "memory"),
+		BoltPath:        getString("BOLT_PATH", "simple-api.db"),
+		MongoURL:        getString("MONGO_URL", "mongodb://localhost:27017"),
+		MongoDB:         getString("MONGO_DB", "simple_api"),
+		MongoTimeout:    getDuration("MONGO_TIMEOUT", 5*time.Second),
+		DatabaseURL:     getString("DATABASE_URL", ""),
+		DatabaseReadURL: getString("DATABASE_READ_URL", ""),
+		ReadYourWrites:  getDuration("READ_YOUR_WRITES", 5*time.Second),
+		SlowQuery:       getDuration("SLOW_QUERY", 200*time.Millisecond),
+		CoalesceReads:   getBool("COALESCE_READS", true),
+		CoalesceTimeout: getDuration("COALESCE_TIMEOUT", 10*time.Second),
+
+		Search:       getString("SEARCH", "bleve"),
+		SearchPath:   getString("SEARCH_PATH", ""),
+		ElasticURL:   getString("ELASTIC_URL", "http://localhost:9200"),
+		ElasticIndex: getString("ELASTIC_INDEX", "users"),
+
+		SnapshotFile:  getString("MEMORY_SNAPSHOT", ""),
+		SnapshotEvery: getDuration("MEMORY_SNAPSHOT_EVERY", time.Minute),
+
+		DBMaxOpenConns:     getInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:     getInt("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetime:  getDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		DBConnMaxIdleTime:  getDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		DBPoolExhaustedFor: getDuration("DB_POOL_EXHAUSTED_FOR", 30*time.Second),
+
+		LockBackend:   getString("LOCK_BACKEND", "local"),
+		RedisAddr:     getString("REDIS_ADDR", "localhost:6379"),
+		RedisPassword: getString("REDIS_PASSWORD", ""),
+		LockTTL:       getDuration("LOCK_TTL", 5*time.Minute),
+
+		LeaderElection: getBool("LEADER_ELECTION", false),
+		LeaseTTL:       getDuration("LEADER_LEASE_TTL", 15*time.Second),
+
+		SigningKeys:      getList("SIGNING_KEYS"),
+		RequireSignature: getBool("REQUIRE_SIGNATURE", false),
+		SignatureSkew:    getDuration("SIGNATURE_SKEW", 5*time.Minute),
+
+		UndoWindow: getDuration("UNDO_WINDOW", 5*time.Minute),
+
+		Maintenance: getBool("MAINTENANCE", false),
+
+		MonthlyQuota: getInt("MONTHLY_QUOTA", 0),
+		APIKeys:      getList("API_KEYS"),
+
+		AdminUser:     getString("ADMIN_USER", "admin"),
+		AdminPassword: getString("ADMIN_PASSWORD", ""),
+		SessionTTL:    getDuration("SESSION_TTL", 12*time.Hour),
+	}
+}
+
+// addr honours PORT (what heroku/cloud run/k8s charts set) over ADDR.
+func addr() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return getString("ADDR", ":3000")
+}
+
+func getString(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func getBool(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		malformed(key, v, "a bool")
+		return def
+	}
+	return b
+}
+
+// getList reads a comma separated list, dropping empty items.
+func getList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func getInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		malformed(key, v, "an integer")
+		return def
+	}
+	return n
+}
+
+func getDuration(key string, def time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		malformed(key, v, "a duration")
+		return def
+	}
+	return d
+}
+
+// the env vars the last FromEnv couldn't parse
+var unparsed struct {
+	sync.Mutex
+	vars []string
+}
+
+func malformed(key, value, want string) {
+	unparsed.Lock()
+	defer unparsed.Unlock()
+	unparsed.vars = append(unparsed.vars, fmt.Sprintf("%s=%q is not %s, using the default", key, value, want))
+}
+
+// Validate reports what the config can't work with: env vars that didn't
+// parse, unknown modes, and settings that only make sense with another one.
+// all problems at once, joined.
+func (c Config) Validate() error {
+	var problems []error
+	bad := func(format string, args ...any) { problems = append(problems, fmt.Errorf(format, args...)) }
+
+	unparsed.Lock()
+	for _, v := range unparsed.vars {
+		bad("%s", v)
+	}
+	unparsed.Unlock()
+
+	oneOf := func(key, v string, allowed ...string) {
+		if !slices.Contains(allowed, v) {
+			bad("%s %q: want one of %s", key, v, strings.Join(allowed, ", "))
+		}
+	}
+	oneOf("APP_ENV", c.Env, "dev", "test", "prod")
+	oneOf("STORAGE", c.Storage, "memory", "bolt", "mongo", "postgres", "") // "" is memory, as in main
+	oneOf("SEARCH", c.Search, "bleve", "elasticsearch", "off")
+	oneOf("LOCK_BACKEND", c.LockBackend, "local", "postgres", "redis", "")
+	oneOf("TLS_CLIENT_AUTH", c.ClientAuth, "off", "optional", "require")
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		bad("TLS_CERT and TLS_KEY go together")
+	}
+	if c.ClientAuth != "off" && (c.TLSCert == "" || c.ClientCA == "") {
+		bad("TLS_CLIENT_AUTH=%s needs TLS_CERT, TLS_KEY and TLS_CLIENT_CA", c.ClientAuth)
+	}
+	if c.DatabaseURL == "" {
+		if c.Storage == "postgres" {
+			bad("STORAGE=postgres needs DATABASE_URL")
+		}
+		if c.LockBackend == "postgres" {
+			bad("LOCK_BACKEND=postgres needs DATABASE_URL")
+		}
+		if c.DatabaseReadURL != "" {
+			bad("DATABASE_READ_URL without DATABASE_URL")
+		}
+	}
+	if c.RequireSignature && len(c.SigningKeys) == 0 {
+		bad("REQUIRE_SIGNATURE needs SIGNING_KEYS")
+	}
+	// nonces are remembered for the whole window, so it's bounded both ways
+	if len(c.SigningKeys) > 0 && (c.SignatureSkew <= 0 || c.SignatureSkew > time.Hour) {
+		bad("SIGNATURE_SKEW must be positive and at most 1h")
+	}
+	if c.SnapshotFile != "" && c.Storage != "memory" {
+		bad("MEMORY_SNAPSHOT only applies to STORAGE=memory")
+	}
+
+	for _, n := range []struct {
+		key string
+		v   int
+	}{
+		{"REVISIONS_KEPT", c.RevisionsKept}, {"CHANGE_FEED_SIZE", c.ChangeFeedSize},
+		{"BATCH_MAX_ITEMS", c.BatchMaxItems}, {"BATCH_CONCURRENCY", c.BatchConcurrency},
+		{"IMPORT_CONCURRENCY", c.ImportConcurrency},
+	} {
+		if n.v < 1 {
+			bad("%s must be at least 1", n.key)
+		}
+	}
+	if c.MonthlyQuota < 0 {
+		bad("MONTHLY_QUOTA must not be negative")
+	}
+	if c.RequestTimeout < 0 {
+		bad("REQUEST_TIMEOUT must not be negative")
+	}
+	if c.UndoWindow < 0 {
+		bad("UNDO_WINDOW must not be negative")
+	}
+	if c.CoalesceReads && c.CoalesceTimeout <= 0 {
+		bad("COALESCE_TIMEOUT must be positive")
+	}
+	if c.RevisionsMaxAge < 0 {
+		bad("REVISIONS_MAX_AGE must not be negative")
+	}
+	if c.AnomalyWindow < 0 {
+		bad("ANOMALY_WINDOW must not be negative")
+	}
+	if c.AnomalyWindow > 0 && c.AnomalyFactor < 2 {
+		bad("ANOMALY_FACTOR must be at least 2")
+	}
+	if c.AnomalyWindow > 0 && c.AnomalyMinRequests < 1 {
+		bad("ANOMALY_MIN_REQUESTS must be at least 1")
+	}
+	if c.AnomalyWebhookSecret != "" && c.AnomalyWebhook == "" {
+		bad("ANOMALY_WEBHOOK_SECRET without ANOMALY_WEBHOOK")
+	}
+	if c.SnapshotEvery <= 0 {
+		bad("MEMORY_SNAPSHOT_EVERY must be positive")
+	}
+	if c.LockTTL <= 0 {
+		bad("LOCK_TTL must be positive")
+	}
+	if c.LeaderElection && c.LeaseTTL <= 0 {
+		bad("LEADER_LEASE_TTL must be positive")
+	}
+	if c.StatusCheckInterval < 0 {
+		bad("STATUS_CHECK_INTERVAL must not be negative")
+	}
+	if c.StatusCheckInterval > 0 && c.StatusHistory < 1 {
+		bad("STATUS_HISTORY must be at least 1")
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,66 @@
+// Package errs is the error vocabulary shared by the layers: storage and
+// models say what kind of thing went wrong, the api decides what status that
+// is (api/respond.go, in one place). a kind is matched with errors.Is however
+// deeply it's wrapped:
+//
+//	if errors.Is(err, errs.NotFound) { ... }
+//
+// and the concrete errors keep their detail for errors.As - store.DuplicateError
+// (a Conflict) knows which record holds the value, models.FieldErrors (Invalid)
+// which fields failed.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// the kinds. they're only ever compared against, never returned bare.
+var (
+	NotFound     = errors.New("not found")
+	Conflict     = errors.New("conflict")     // a unique value is taken, or the record exists
+	Invalid      = errors.New("invalid")      // the input breaks a rule
+	Unauthorized = errors.New("unauthorized") // the caller couldn't be authenticated
+)
+
+// Error is a kind plus a message for the client. Format is english and is
+// also the i18n catalog key, so the api can translate it before filling in
+// Args.
+type Error struct {
+	Kind   error
+	Format string
+	Args   []any
+	Err    error // the cause, for logs; never shown to clients
+}
+
+// New returns an error of kind; format and args as for fmt.Sprintf.
+func New(kind error, format string, args ...any) *Error {
+	return &Error{Kind: kind, Format: format, Args: args}
+}
+
+// Wrap is New with a cause attached.
+func Wrap(kind error, cause error, format string, args ...any) *Error {
+	return &Error{Kind: kind, Format: format, Args: args, Err: cause}
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf(e.Format, e.Args...)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Is(target error) bool { return target == e.Kind }
+func (e *Error) Unwrap() error        { return e.Err }
+
+// KindOf returns err's kind, or nil for errors outside the vocabulary (which
+// the api treats as internal).
+func KindOf(err error) error {
+	for _, k := range []error{NotFound, Conflict, Invalid, Unauthorized} {
+		if errors.Is(err, k) {
+			return k
+		}
+	}
+	return nil
+}
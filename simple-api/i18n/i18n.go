@@ -0,0 +1,84 @@
+// Package i18n translates user-facing messages. catalogs are json files in
+// locales/, one per language, mapping the english message (the key - so call
+// sites stay readable and untranslated messages still make sense) to its
+// translation. formatted messages are keyed by their format string.
+//
+// en.json lists every key and is the template for new locales.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+var (
+	supported []language.Tag // English first: it's the fallback
+	catalogs  = map[language.Tag]map[string]string{}
+	matcher   language.Matcher
+)
+
+func init() {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	supported = []language.Tag{language.English}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".json")
+		tag, err := language.Parse(name)
+		if err != nil {
+			panic(fmt.Sprintf("i18n: locale file %s: %v", f.Name(), err))
+		}
+		raw, err := locales.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		msgs := map[string]string{}
+		if err := json.Unmarshal(raw, &msgs); err != nil {
+			panic(fmt.Sprintf("i18n: locale file %s: %v", f.Name(), err))
+		}
+		catalogs[tag] = msgs
+		if tag != language.English {
+			supported = append(supported, tag)
+		}
+	}
+	matcher = language.NewMatcher(supported)
+}
+
+// Match picks the best supported language for an Accept-Language header,
+// English if nothing fits.
+func Match(acceptLanguage string) language.Tag {
+	prefs, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(prefs) == 0 {
+		return language.English
+	}
+	_, i, conf := matcher.Match(prefs...)
+	if conf == language.No {
+		return language.English
+	}
+	return supported[i] // the catalog's own tag, not the matcher's annotated one
+}
+
+// T translates msg, or returns it unchanged if tag has no translation.
+func T(tag language.Tag, msg string) string {
+	if t, ok := catalogs[tag][msg]; ok && t != "" {
+		return t
+	}
+	return msg
+}
+
+// Sprintf translates format, then formats it.
+func Sprintf(tag language.Tag, format string, args ...any) string {
+	return fmt.Sprintf(T(tag, format), args...)
+}
+
+// Supported lists the languages with a catalog, English first.
+func Supported() []language.Tag { return append([]language.Tag(nil), supported...) }
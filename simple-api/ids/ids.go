@@ -0,0 +1,67 @@
+// Package ids generates and recognises resource identifiers.
+//
+// new records get a ULID: 26 chars of crockford base32, sortable by creation
+// time and not guessable like a counter. records from before the switch may
+// still be addressed by their old integer id while clients migrate.
+package ids
+
+import (
+	"crypto/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	mu sync.Mutex
+	// crypto entropy keeps ids unguessable; monotonic keeps ids made in
+	// the same millisecond in creation order
+	entropy = ulid.Monotonic(rand.Reader, 0)
+)
+
+// New returns a fresh ULID string.
+func New() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
+}
+
+// IsULID reports whether s is a well-formed ULID (case-insensitive).
+func IsULID(s string) bool {
+	_, err := ulid.ParseStrict(s)
+	return err == nil
+}
+
+// Legacy parses an old-style positive integer id.
+func Legacy(s string) (int64, bool) {
+	// every ulid passes through here on its way to IsULID; ParseInt would
+	// allocate an error for each of them
+	if s == "" || len(s) > 19 {
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil && n > 0
+}
+
+// Valid reports whether s is either id format.
+func Valid(s string) bool {
+	_, legacy := Legacy(s)
+	return legacy || IsULID(s)
+}
+
+// Canonical upper-cases a ULID (the canonical spelling) and leaves legacy ids alone.
+func Canonical(s string) string {
+	id, err := ulid.ParseStrict(s)
+	if err != nil || strings.ToUpper(s) == s { // already canonical: no copy
+		return s
+	}
+	return id.String()
+}
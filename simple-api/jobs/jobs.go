@@ -0,0 +1,102 @@
+// Package jobs runs periodic background work. each job takes a named lock
+// before every run, so with a shared lock backend only one replica runs it
+// each round; the others just skip that tick.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/lock"
+)
+
+type Job struct {
+	Name  string
+	Every time.Duration
+	Run   func(ctx context.Context) error
+
+	// Local jobs tidy up per-process state (eg in-memory sessions), so they
+	// run on every replica and skip the lock.
+	Local bool
+}
+
+type Scheduler struct {
+	locker lock.Locker
+	leader interface{ IsLeader() bool } // nil: no election, the lock alone decides
+	jobs   []Job
+}
+
+func NewScheduler(l lock.Locker) *Scheduler { return &Scheduler{locker: l} }
+
+// FollowLeader makes non-local jobs run only while e reports leadership (see
+// package leader). the per-job lock is still taken, which covers the moment
+// two replicas both think they lead during a failover.
+func (s *Scheduler) FollowLeader(e interface{ IsLeader() bool }) { s.leader = e }
+
+// Add schedules jobs, or none of them if one has no positive Every.
+func (s *Scheduler) Add(jobs ...Job) error {
+	for _, j := range jobs {
+		if j.Every <= 0 {
+			return fmt.Errorf("jobs: %s: every %v, want more than 0", j.Name, j.Every)
+		}
+	}
+	s.jobs = append(s.jobs, jobs...)
+	return nil
+}
+
+// Run ticks every job until ctx is cancelled, then waits for in-flight runs.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t := time.NewTicker(j.Every)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					s.tick(ctx, j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) tick(ctx context.Context, j Job) {
+	if !j.Local {
+		if s.leader != nil && !s.leader.IsLeader() {
+			return
+		}
+		l, ok, err := s.locker.TryLock(ctx, "job:"+j.Name)
+		if err != nil {
+			slog.Error("jobs: lock failed", "job", j.Name, "err", err)
+			return
+		}
+		if !ok {
+			slog.Debug("jobs: held elsewhere, skipping", "job", j.Name)
+			return
+		}
+		defer func() {
+			// ctx may be done by now (shutdown), the lock still has to go
+			uctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := l.Unlock(uctx); err != nil {
+				slog.Warn("jobs: unlock failed", "job", j.Name, "err", err)
+			}
+		}()
+	}
+
+	start := time.Now()
+	if err := j.Run(ctx); err != nil {
+		slog.Error("jobs: run failed", "job", j.Name, "err", err, "took", time.Since(start))
+		return
+	}
+	slog.Debug("jobs: ran", "job", j.Name, "took", time.Since(start))
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/lock"
+)
+
+// TestSharedLocker ticks two schedulers - two replicas - at the same moment,
+// round after round: with one locker between them each round runs the job
+// once, and a local job on both.
+func TestSharedLocker(t *testing.T) {
+	locker := lock.NewLocal()
+	a, b := NewScheduler(locker), NewScheduler(locker)
+	var runs atomic.Int32
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	job := Job{Name: "purge", Run: func(context.Context) error {
+		runs.Add(1)
+		started <- struct{}{}
+		<-release
+		return nil
+	}}
+
+	for round := 1; round <= 3; round++ {
+		release = make(chan struct{})
+		ticked := make(chan struct{}, 2)
+		for _, s := range []*Scheduler{a, b} {
+			go func() {
+				s.tick(context.Background(), job)
+				ticked <- struct{}{}
+			}()
+		}
+		// a run doesn't return before release, so the first tick back is
+		// the one that found the lock taken
+		<-started
+		<-ticked
+		close(release)
+		<-ticked
+		if got := runs.Load(); got != int32(round) {
+			t.Fatalf("round %d: %d runs so far, want %d", round, got, round)
+		}
+	}
+
+	runs.Store(0)
+	release = make(chan struct{})
+	local := job
+	local.Local = true
+	var wg sync.WaitGroup
+	for _, s := range []*Scheduler{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.tick(context.Background(), local)
+		}()
+	}
+	<-started
+	<-started
+	close(release)
+	wg.Wait()
+	if got := runs.Load(); got != 2 {
+		t.Errorf("local job: %d runs, want one per scheduler", got)
+	}
+}
+
+type follower struct{}
+
+func (follower) IsLeader() bool { return false }
+
+// TestFollowLeader: off the leader only local jobs run.
+func TestFollowLeader(t *testing.T) {
+	s := NewScheduler(lock.NewLocal())
+	s.FollowLeader(follower{})
+	var runs atomic.Int32
+	job := Job{Name: "purge", Run: func(context.Context) error { runs.Add(1); return nil }}
+	s.tick(context.Background(), job)
+	if got := runs.Load(); got != 0 {
+		t.Fatalf("non-local job ran %d times off the leader", got)
+	}
+	job.Local = true
+	s.tick(context.Background(), job)
+	if got := runs.Load(); got != 1 {
+		t.Errorf("local job ran %d times, want 1", got)
+	}
+}
+
+func TestAddRejectsNoInterval(t *testing.T) {
+	s := NewScheduler(lock.NewLocal())
+	noop := func(context.Context) error { return nil }
+	if err := s.Add(Job{Name: "ok", Every: time.Minute, Run: noop}, Job{Name: "never", Run: noop}); err == nil {
+		t.Fatal("a job with Every 0 was added")
+	}
+	if len(s.jobs) != 0 {
+		t.Errorf("%d jobs added alongside the bad one", len(s.jobs))
+	}
+}
@@ -0,0 +1,127 @@
+// Package leader is lease-based leader election: every replica campaigns for
+// the same lease, the holder renews it every TTL/3, and if it stops (crash,
+// partition, shutdown) the lease expires and another replica takes over.
+//
+// it's the coarse alternative to per-job locks - background subsystems that
+// should only run on one instance check IsLeader, or run under Lead.
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamskyy666/simple-api/lock"
+)
+
+type Elector struct {
+	leases lock.Leaser
+	name   string // the lease everyone campaigns for
+	id     string // this replica
+	ttl    time.Duration
+
+	leading atomic.Bool
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced on every transition
+}
+
+func New(leases lock.Leaser, name, id string, ttl time.Duration) *Elector {
+	return &Elector{leases: leases, name: name, id: id, ttl: ttl, changed: make(chan struct{})}
+}
+
+func (e *Elector) ID() string { return e.id }
+
+func (e *Elector) IsLeader() bool { return e.leading.Load() }
+
+// Run campaigns until ctx is cancelled, then releases the lease if held so a
+// successor doesn't have to wait out the ttl.
+func (e *Elector) Run(ctx context.Context) {
+	t := time.NewTicker(e.ttl / 3)
+	defer t.Stop()
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				rctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := e.leases.Release(rctx, e.name, e.id); err != nil {
+					slog.Warn("leader: release failed", "lease", e.name, "err", err)
+				}
+				cancel()
+				e.set(false)
+			}
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (e *Elector) campaign(ctx context.Context) {
+	// a renewal that can't finish before the lease would lapse counts as lost
+	actx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+	ok, err := e.leases.Acquire(actx, e.name, e.id, e.ttl)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("leader: campaign failed", "lease", e.name, "err", err)
+		}
+		ok = false // can't prove we still hold it, so step down
+	}
+	e.set(ok)
+}
+
+func (e *Elector) set(leading bool) {
+	if e.leading.Swap(leading) == leading {
+		return
+	}
+	if leading {
+		slog.Info("leader: elected", "lease", e.name, "id", e.id)
+	} else {
+		slog.Warn("leader: lost leadership", "lease", e.name, "id", e.id)
+	}
+	e.mu.Lock()
+	close(e.changed)
+	e.changed = make(chan struct{})
+	e.mu.Unlock()
+}
+
+func (e *Elector) watch() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.changed
+}
+
+// Lead runs fn whenever this replica is leader. fn's context is cancelled as
+// soon as leadership is lost, and fn is started again on re-election.
+// returns when ctx is done.
+func (e *Elector) Lead(ctx context.Context, fn func(ctx context.Context)) {
+	for {
+		changed := e.watch()
+		if !e.IsLeader() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				continue
+			}
+		}
+
+		lctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fn(lctx)
+		}()
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		}
+		cancel()
+		<-done
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
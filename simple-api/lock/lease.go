@@ -0,0 +1,119 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Leaser hands out time-bound leases, which leader election is built on.
+// unlike a Lock a lease is renewed by its holder and simply expires if the
+// holder goes quiet, so another replica can take over.
+type Leaser interface {
+	// Acquire takes name for holder, or extends it if holder already has it.
+	// ok is false while someone else holds an unexpired lease.
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (ok bool, err error)
+	// Release gives the lease up early; a no-op if holder doesn't have it.
+	Release(ctx context.Context, name, holder string) error
+}
+
+// local
+
+type localLease struct {
+	holder  string
+	expires time.Time
+}
+
+func (l *Local) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if cur, ok := l.leases[name]; ok && cur.holder != holder && now.Before(cur.expires) {
+		return false, nil
+	}
+	l.leases[name] = localLease{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (l *Local) Release(ctx context.Context, name, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.leases[name].holder == holder {
+		delete(l.leases, name)
+	}
+	return nil
+}
+
+// postgres: one row per lease, taken with an upsert that only wins if the row
+// is ours or expired. expiry uses the database clock, so replica clock skew
+// doesn't matter.
+
+const pgLeaseTable = `CREATE TABLE IF NOT EXISTS leases (
+	name       text PRIMARY KEY,
+	holder     text NOT NULL,
+	expires_at timestamptz NOT NULL
+)`
+
+const pgAcquire = `INSERT INTO leases (name, holder, expires_at)
+VALUES ($1, $2, now() + $3::bigint * interval '1 millisecond')
+ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < now()`
+
+func (p *Postgres) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	if err := p.ensureLeaseTable(ctx); err != nil {
+		return false, fmt.Errorf("lease table: %w", err)
+	}
+	res, err := p.db.ExecContext(ctx, pgAcquire, name, holder, ttl.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("lease %q: %w", name, err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ensureLeaseTable creates the table on first use, retrying until it works.
+func (p *Postgres) ensureLeaseTable(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.leaseTable {
+		return nil
+	}
+	if _, err := p.db.ExecContext(ctx, pgLeaseTable); err != nil {
+		return err
+	}
+	p.leaseTable = true
+	return nil
+}
+
+func (p *Postgres) Release(ctx context.Context, name, holder string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM leases WHERE name = $1 AND holder = $2", name, holder)
+	return err
+}
+
+// redis: the value is the holder. renewing has to check the holder and move
+// the expiry in one step, hence the scripts.
+
+const (
+	redisAcquire = `local cur = redis.call("get", KEYS[1])
+if cur == false or cur == ARGV[1] then
+	redis.call("set", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0`
+	redisRelease = redisUnlock
+)
+
+func (r *Redis) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	reply, err := r.do(ctx, "EVAL", redisAcquire, "1", "lease:simple-api:"+name, holder, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, fmt.Errorf("lease %q: %w", name, err)
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+func (r *Redis) Release(ctx context.Context, name, holder string) error {
+	_, err := r.do(ctx, "EVAL", redisRelease, "1", "lease:simple-api:"+name, holder)
+	return err
+}
@@ -0,0 +1,45 @@
+package lock
+
+import (
+	"context"
+	"sync"
+)
+
+// Local is a Locker for a single process. it's the default when no shared
+// backend is configured, which is only correct with one replica.
+type Local struct {
+	mu     sync.Mutex
+	held   map[string]bool
+	leases map[string]localLease
+}
+
+func NewLocal() *Local {
+	return &Local{held: map[string]bool{}, leases: map[string]localLease{}}
+}
+
+func (l *Local) TryLock(ctx context.Context, name string) (Lock, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[name] {
+		return nil, false, nil
+	}
+	l.held[name] = true
+	return &localLock{owner: l, name: name}, true, nil
+}
+
+type localLock struct {
+	owner *Local
+	name  string
+	once  sync.Once
+}
+
+func (k *localLock) Unlock(ctx context.Context) error {
+	err := ErrNotHeld
+	k.once.Do(func() {
+		k.owner.mu.Lock()
+		delete(k.owner.held, k.name)
+		k.owner.mu.Unlock()
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,39 @@
+// Package lock hands out named mutexes that hold across replicas, so
+// background jobs run on one instance at a time instead of on every pod.
+//
+// backends:
+//
+//	Local     in-process only - dev, tests and single-replica deploys
+//	Postgres  session advisory locks (pg_try_advisory_lock)
+//	Redis     SET key token NX PX ttl, released with a compare-and-delete
+//
+// every backend is try-only: a job that doesn't get the lock just skips its
+// turn, it never queues behind the replica that has it.
+package lock
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotHeld is returned by Unlock when the lock was already gone - released
+// twice, or (redis) the ttl ran out and someone else may have taken it.
+var ErrNotHeld = errors.New("lock: not held")
+
+// Locker is implemented by every backend.
+type Locker interface {
+	// TryLock takes name without waiting. ok is false if another holder has it;
+	// err is only for the backend itself failing.
+	TryLock(ctx context.Context, name string) (l Lock, ok bool, err error)
+}
+
+// Backend is what every implementation in this package provides.
+type Backend interface {
+	Locker
+	Leaser
+}
+
+// Lock is a held lock. Unlock must be called exactly once.
+type Lock interface {
+	Unlock(ctx context.Context) error
+}
@@ -0,0 +1,72 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// Postgres uses session-level advisory locks. the lock lives on one pooled
+// connection, which is held until Unlock - if the process dies the connection
+// drops and postgres releases the lock by itself, so there is no ttl to tune.
+//
+// the driver is up to the caller (main registers pgx).
+type Postgres struct {
+	db *sql.DB
+
+	mu         sync.Mutex
+	leaseTable bool // leases table exists, see ensureLeaseTable
+}
+
+func NewPostgres(db *sql.DB) *Postgres { return &Postgres{db: db} }
+
+func (p *Postgres) TryLock(ctx context.Context, name string) (Lock, bool, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("lock: %w", err)
+	}
+	key := advisoryKey(name)
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("lock %q: %w", name, err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+	return &pgLock{conn: conn, key: key, name: name}, true, nil
+}
+
+type pgLock struct {
+	conn *sql.Conn
+	key  int64
+	name string
+}
+
+func (k *pgLock) Unlock(ctx context.Context) error {
+	if k.conn == nil {
+		return ErrNotHeld
+	}
+	defer func() { k.conn = nil }()
+	defer k.conn.Close()
+
+	var released bool
+	if err := k.conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", k.key).Scan(&released); err != nil {
+		// closing the connection below releases it anyway
+		return fmt.Errorf("unlock %q: %w", k.name, err)
+	}
+	if !released {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// advisoryKey maps a lock name onto postgres' bigint advisory key space.
+func advisoryKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("simple-api:" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,141 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Redis takes locks with SET NX PX. unlike postgres the lock outlives a
+// crashed holder only until TTL, so TTL has to be longer than any job run -
+// a job that overruns it may find Unlock returning ErrNotHeld.
+//
+// it speaks just enough RESP for SET/EVAL over a fresh connection per call;
+// jobs lock once a minute at most, so pooling isn't worth a client dependency.
+type Redis struct {
+	Addr     string // host:port
+	Password string
+	TTL      time.Duration
+}
+
+func NewRedis(addr, password string, ttl time.Duration) *Redis {
+	return &Redis{Addr: addr, Password: password, TTL: ttl}
+}
+
+// only delete the key if it still holds our token, or we'd release a lock
+// someone else took after our ttl ran out
+const redisUnlock = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+func (r *Redis) TryLock(ctx context.Context, name string) (Lock, bool, error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	key := "lock:simple-api:" + name
+
+	reply, err := r.do(ctx, "SET", key, token, "NX", "PX", strconv.FormatInt(r.TTL.Milliseconds(), 10))
+	if err != nil {
+		return nil, false, fmt.Errorf("lock %q: %w", name, err)
+	}
+	if reply == nil {
+		return nil, false, nil // NX: someone has it
+	}
+	return &redisLock{r: r, key: key, token: token}, true, nil
+}
+
+type redisLock struct {
+	r          *Redis
+	key, token string
+}
+
+func (k *redisLock) Unlock(ctx context.Context) error {
+	reply, err := k.r.do(ctx, "EVAL", redisUnlock, "1", k.key, k.token)
+	if err != nil {
+		return fmt.Errorf("unlock %q: %w", k.key, err)
+	}
+	if n, _ := reply.(int64); n != 1 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// do sends one command and returns its reply: string, int64, nil, or an error
+// for a redis error reply.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", r.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	} else {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	rd := bufio.NewReader(conn)
+	if r.Password != "" {
+		if _, err := command(conn, rd, "AUTH", r.Password); err != nil {
+			return nil, err
+		}
+	}
+	return command(conn, rd, args...)
+}
+
+func command(conn net.Conn, rd *bufio.Reader, args ...string) (any, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := conn.Write([]byte(sb.String())); err != nil {
+		return nil, err
+	}
+	return readReply(rd)
+}
+
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch body := line[1:]; line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, errors.New("redis: " + body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err // $-1 is nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// Ping checks that the server answers (and takes the password), for the
+// startup self-check.
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"log/slog"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/errs"
+	"github.com/iamskyy666/simple-api/redact"
+)
+
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+
+	DefaultRole = RoleMember
+)
+
+type User struct {
+	ID string `json:"id"` // ULID, see package ids
+	// LegacyID is the integer id from before ULIDs (0 for newer users).
+	// it still resolves in /users/{id} until clients have migrated.
+	LegacyID int64  `json:"legacy_id,omitempty"`
+	Name     string `json:"name"`
+	Email    string `json:"email" log:"redact"`
+	Role     string `json:"role"`
+
+	// server-managed, never taken from input
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	DisplayName string    `json:"display_name"` // computed, see Compute
+}
+
+// LogValue keeps PII (see the `log` tags) out of logs.
+func (u User) LogValue() slog.Value { return redact.Value(u) }
+
+// PrepareCreate fills in defaults and computed fields for a new user.
+// backends call it inside CreateUser, so every transport gets the same result.
+func (u *User) PrepareCreate(now time.Time) {
+	now = now.UTC()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	if u.Role == "" {
+		u.Role = DefaultRole
+	}
+	u.Compute()
+}
+
+// PrepareUpdate carries the server-managed fields over from the stored
+// version (old) - an update that leaves role out keeps the current one.
+func (u *User) PrepareUpdate(old User, now time.Time) {
+	u.CreatedAt = old.CreatedAt
+	u.UpdatedAt = now.UTC()
+	if u.Role == "" {
+		u.Role = old.Role
+	}
+	if u.Role == "" {
+		u.Role = DefaultRole
+	}
+	u.Compute()
+}
+
+// Compute derives the read-only fields from the stored ones.
+func (u *User) Compute() {
+	u.DisplayName = u.Name
+	if u.DisplayName == "" {
+		// shouldn't happen for validated users, but imports can be messy
+		u.DisplayName, _, _ = strings.Cut(u.Email, "@")
+	}
+}
+
+// Normalize trims the input and lower-cases the email, so the same
+// address always compares (and later indexes) the same way.
+func (u *User) Normalize() {
+	u.Name = strings.TrimSpace(u.Name)
+	u.Email = NormalizeEmail(u.Email)
+	u.Role = strings.ToLower(strings.TrimSpace(u.Role))
+}
+
+// NormalizeEmail is the canonical form emails are stored and looked up in.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Validate returns FieldErrors (or nil) - call Normalize first.
+func (u User) Validate() error {
+	fe := FieldErrors{}
+	if u.Name == "" {
+		fe["name"] = "is required"
+	}
+	if u.Email == "" {
+		fe["email"] = "is required"
+	} else if _, err := mail.ParseAddress(u.Email); err != nil {
+		fe["email"] = "is not a valid email address"
+	}
+	switch u.Role {
+	case "", RoleMember, RoleAdmin: // empty gets the default
+	default:
+		fe["role"] = "must be member or admin"
+	}
+	if len(fe) == 0 {
+		return nil
+	}
+	return fe
+}
+
+// FieldErrors maps a json field name to what's wrong with it. it's an
+// errs.Invalid.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Is(target error) bool { return target == errs.Invalid }
+
+func (e FieldErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+" "+e[k])
+	}
+	return strings.Join(parts, ", ")
+}
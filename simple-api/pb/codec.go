@@ -0,0 +1,70 @@
+// Package pb has the protobuf messages (users.proto) and the
+// application/x-protobuf codec that serves them, for typed clients. the
+// messages mirror package models.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative users.proto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/serializer"
+	"google.golang.org/protobuf/proto"
+)
+
+// Messager is implemented by values that have a protobuf form without being
+// messages themselves (the api's views of users, its error bodies).
+type Messager interface {
+	Proto() proto.Message
+}
+
+// Protobuf is responses only: request bodies stay json or cbor, which carry
+// the field names the validation errors talk about.
+var Protobuf = serializer.Register("application/x-protobuf", codec{})
+
+type codec struct{}
+
+// Encodes says which values have a protobuf form; anything else (the change
+// feed, revisions, usage) is sent as json to a client asking for protobuf.
+func (codec) Encodes(v any) bool {
+	switch v.(type) {
+	case proto.Message, Messager, models.User, []models.User:
+		return true
+	}
+	return false
+}
+
+func (codec) Encode(w io.Writer, v any) error {
+	m, ok := message(v)
+	if !ok {
+		return fmt.Errorf("pb: no message for %T", v)
+	}
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (codec) Decode(body []byte, dst any) error {
+	return errors.New("protobuf request bodies are not supported, send json or cbor")
+}
+
+// message is v's protobuf form, for the types Encodes names.
+func message(v any) (proto.Message, bool) {
+	switch v := v.(type) {
+	case proto.Message:
+		return v, true
+	case Messager:
+		return v.Proto(), true
+	case models.User:
+		return FromUser(v), true
+	case []models.User:
+		return FromUsers(v), true
+	}
+	return nil, false
+}
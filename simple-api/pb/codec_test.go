@@ -0,0 +1,95 @@
+package pb_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/pb"
+	"github.com/iamskyy666/simple-api/serializer"
+	"google.golang.org/protobuf/proto"
+)
+
+var at = time.Date(2026, 3, 14, 15, 9, 26, 535897000, time.UTC)
+
+var user = models.User{
+	ID: "01HV4ZK2Q3M5N6P7R8S9T0VWXY", LegacyID: 42, Name: "Zoë", Email: "zoe@example.com",
+	Role: models.RoleMember, CreatedAt: at, UpdatedAt: at.Add(time.Hour), DisplayName: "Zoë",
+}
+
+// toUser is FromUser backwards, as a client would read the message.
+func toUser(m *pb.User) models.User {
+	return models.User{
+		ID: m.Id, LegacyID: m.LegacyId, Name: m.Name, Email: m.Email, Role: m.Role,
+		CreatedAt: m.CreatedAt.AsTime(), UpdatedAt: m.UpdatedAt.AsTime(), DisplayName: m.DisplayName,
+	}
+}
+
+// TestRoundTrip encodes users with the codec and decodes them as a client
+// with the generated types would.
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := pb.Protobuf.Encode(&buf, user); err != nil {
+		t.Fatal(err)
+	}
+	var m pb.User
+	if err := proto.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if got := toUser(&m); got != user {
+		t.Errorf("user: got %+v, want %+v", got, user)
+	}
+
+	newer := models.User{ID: "01HV4ZK2Q3M5N6P7R8S9T0VWXZ", Name: "a", Email: "a@example.com", CreatedAt: at, UpdatedAt: at}
+	buf.Reset()
+	if err := pb.Protobuf.Encode(&buf, []models.User{user, newer}); err != nil {
+		t.Fatal(err)
+	}
+	var list pb.UserList
+	if err := proto.Unmarshal(buf.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Users) != 2 || toUser(list.Users[0]) != user || toUser(list.Users[1]) != newer {
+		t.Errorf("list: got %v", list.Users)
+	}
+	if list.Users[1].LegacyId != 0 {
+		t.Errorf("a user without a legacy id got %d", list.Users[1].LegacyId)
+	}
+
+	if err := pb.Protobuf.Encode(&buf, map[string]int{"calls": 1}); err == nil {
+		t.Error("encoded a value without a message")
+	}
+}
+
+type view struct{ models.User }
+
+func (v view) Proto() proto.Message { return pb.FromUser(v.User) }
+
+// TestNegotiate: protobuf is picked for what has a message; anything else
+// goes out as json, even to a client that prefers protobuf.
+func TestNegotiate(t *testing.T) {
+	const accept = "application/x-protobuf, application/json;q=0.5"
+	for _, c := range []struct {
+		name string
+		v    any
+		want *serializer.Format
+	}{
+		{"user", user, pb.Protobuf},
+		{"users", []models.User{user}, pb.Protobuf},
+		{"message", &pb.Error{Error: "not found"}, pb.Protobuf},
+		{"messager", view{user}, pb.Protobuf},
+		{"no message", map[string]int{"calls": 1}, serializer.JSON},
+		{"pointer to user", &user, serializer.JSON},
+	} {
+		if f, ok := serializer.Negotiate(accept, c.v); f != c.want || !ok {
+			t.Errorf("%s: %s (ok %t), want %s", c.name, f.MediaType, ok, c.want.MediaType)
+		}
+	}
+	if f, ok := serializer.Negotiate("application/x-protobuf", map[string]int{}); f != serializer.JSON || ok {
+		t.Errorf("protobuf only, no message: %s (ok %t), want json and not ok", f.MediaType, ok)
+	}
+	if f, _ := serializer.Negotiate("application/json", user); f != serializer.JSON {
+		t.Errorf("json asked for: %s", f.MediaType)
+	}
+}
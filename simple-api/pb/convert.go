@@ -0,0 +1,37 @@
+package pb
+
+import (
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func FromUser(u models.User) *User {
+	return &User{
+		Id:          u.ID,
+		LegacyId:    u.LegacyID,
+		Name:        u.Name,
+		Email:       u.Email,
+		Role:        u.Role,
+		CreatedAt:   timestamp(u.CreatedAt),
+		UpdatedAt:   timestamp(u.UpdatedAt),
+		DisplayName: u.DisplayName,
+	}
+}
+
+func FromUsers(users []models.User) *UserList {
+	list := &UserList{Users: make([]*User, len(users))}
+	for i, u := range users {
+		list.Users[i] = FromUser(u)
+	}
+	return list
+}
+
+// timestamp leaves a zero time unset, as proto3 does for zero values.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
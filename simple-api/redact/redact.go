@@ -0,0 +1,123 @@
+// Package redact turns structs into slog values with sensitive fields masked.
+//
+// tag a field with `log:"redact"` to mask it, or `log:"-"` to leave it out:
+//
+//	type User struct {
+//		Email string `json:"email" log:"redact"`
+//	}
+//
+//	func (u User) LogValue() slog.Value { return redact.Value(u) }
+//
+// with LogValue in place the type is safe to hand to any slog call - the
+// handler resolves it, so there's no way to "forget" the masking at a call site.
+package redact
+
+import (
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mask replaces the value of a non-empty redacted field.
+const Mask = "***"
+
+var (
+	logValuerType = reflect.TypeFor[slog.LogValuer]()
+	timeType      = reflect.TypeFor[time.Time]()
+)
+
+// Value renders v as a slog group honouring `log` tags on struct fields.
+// non-struct values are returned as-is.
+func Value(v any) slog.Value {
+	return value(reflect.ValueOf(v), false)
+}
+
+// value walks rv. nested is false for the value Value was called with, so a
+// type whose LogValue calls Value doesn't end up calling itself forever.
+func value(rv reflect.Value, nested bool) slog.Value {
+	if !rv.IsValid() {
+		return slog.AnyValue(nil)
+	}
+	if nested && rv.Type().Implements(logValuerType) && rv.CanInterface() {
+		if rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return slog.AnyValue(nil)
+		}
+		return rv.Interface().(slog.LogValuer).LogValue()
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return slog.AnyValue(nil)
+		}
+		return value(rv.Elem(), nested)
+
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			return slog.TimeValue(rv.Interface().(time.Time))
+		}
+		return structValue(rv)
+
+	case reflect.Slice, reflect.Array:
+		// elements may be structs with redacted fields, so no fmt fallback here
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return slog.AnyValue(rv.Interface()) // []byte
+		}
+		attrs := make([]slog.Attr, rv.Len())
+		for i := range rv.Len() {
+			attrs[i] = slog.Attr{Key: strconv.Itoa(i), Value: value(rv.Index(i), true)}
+		}
+		return slog.GroupValue(attrs...)
+	}
+
+	if !rv.CanInterface() {
+		return slog.AnyValue(nil)
+	}
+	return slog.AnyValue(rv.Interface())
+}
+
+func structValue(rv reflect.Value) slog.Value {
+	t := rv.Type()
+	attrs := make([]slog.Attr, 0, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("log")
+		if tag == "-" {
+			continue
+		}
+
+		key := fieldKey(f)
+		fv := rv.Field(i)
+		if tag == "redact" {
+			if fv.IsZero() {
+				attrs = append(attrs, slog.String(key, ""))
+			} else {
+				attrs = append(attrs, slog.String(key, Mask))
+			}
+			continue
+		}
+		// embedded structs are flattened, like encoding/json does
+		if f.Anonymous && fv.Kind() == reflect.Struct {
+			if g := value(fv, true); g.Kind() == slog.KindGroup {
+				attrs = append(attrs, g.Group()...)
+				continue
+			}
+		}
+		attrs = append(attrs, slog.Attr{Key: key, Value: value(fv, true)})
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// fieldKey prefers the json name so logs and api payloads line up.
+func fieldKey(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
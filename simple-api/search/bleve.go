@@ -0,0 +1,106 @@
+package search
+
+import (
+	"context"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// Bleve is the embedded index. with an empty path it lives in memory and is
+// rebuilt from the store on every start.
+type Bleve struct {
+	idx bleve.Index
+}
+
+func OpenBleve(path string) (*Bleve, error) {
+	if path == "" {
+		idx, err := bleve.NewMemOnly(bleveMapping())
+		return &Bleve{idx: idx}, err
+	}
+	idx, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		idx, err = bleve.New(path, bleveMapping())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Bleve{idx: idx}, nil
+}
+
+func bleveMapping() mapping.IndexMapping {
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = "standard"
+	text.Store = false
+
+	doc := bleve.NewDocumentStaticMapping()
+	doc.AddFieldMappingsAt("name", text)
+	doc.AddFieldMappingsAt("email", text)
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = doc
+	return m
+}
+
+func (b *Bleve) Index(ctx context.Context, u models.User) error {
+	return b.idx.Index(u.ID, indexDoc{Name: u.Name, Email: u.Email})
+}
+
+func (b *Bleve) Delete(ctx context.Context, id string) error { return b.idx.Delete(id) }
+
+// Search ORs three ways of matching each field: the analysed terms (best
+// score), each word with a few edits of slack (typos, scaled to word length
+// like elasticsearch's AUTO), and a prefix of the last word (search-as-you-type).
+func (b *Bleve) Search(ctx context.Context, q string, limit int) ([]Hit, error) {
+	words := strings.Fields(strings.ToLower(q))
+	var qs []query.Query
+	for _, field := range []string{"name", "email"} {
+		exact := bleve.NewMatchQuery(q)
+		exact.SetField(field)
+		exact.SetBoost(3)
+		qs = append(qs, exact)
+
+		for _, w := range words {
+			if edits := fuzziness(w); edits > 0 {
+				fuzzy := bleve.NewFuzzyQuery(w)
+				fuzzy.SetField(field)
+				fuzzy.SetFuzziness(edits)
+				qs = append(qs, fuzzy)
+			}
+		}
+		if len(words) > 0 {
+			prefix := bleve.NewPrefixQuery(words[len(words)-1])
+			prefix.SetField(field)
+			qs = append(qs, prefix)
+		}
+	}
+
+	req := bleve.NewSearchRequestOptions(bleve.NewDisjunctionQuery(qs...), limit, 0, false)
+	res, err := b.idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]Hit, len(res.Hits))
+	for i, h := range res.Hits {
+		hits[i] = Hit{ID: h.ID, Score: h.Score}
+	}
+	return hits, nil
+}
+
+// fuzziness is how many edits a word of this length may be off by:
+// none for very short words (too many false hits), then 1, then 2.
+func fuzziness(w string) int {
+	switch n := len([]rune(w)); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (b *Bleve) Close() error { return b.idx.Close() }
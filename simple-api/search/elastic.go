@@ -0,0 +1,143 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// Elastic talks to an Elasticsearch (or OpenSearch) cluster over plain http -
+// the handful of calls used here aren't worth a client library.
+type Elastic struct {
+	base  string // eg http://localhost:9200
+	index string
+	http  *http.Client
+}
+
+// OpenElastic creates the index with its mapping if it doesn't exist yet.
+func OpenElastic(ctx context.Context, base, index string) (*Elastic, error) {
+	e := &Elastic{base: strings.TrimRight(base, "/"), index: index, http: &http.Client{Timeout: 10 * time.Second}}
+
+	res, err := e.do(ctx, http.MethodHead, "/"+url.PathEscape(index), nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		mapping := map[string]any{
+			"mappings": map[string]any{
+				"dynamic": "strict",
+				"properties": map[string]any{
+					"name":  map[string]any{"type": "text"},
+					"email": map[string]any{"type": "text", "analyzer": "standard"},
+				},
+			},
+		}
+		if err := e.call(ctx, http.MethodPut, "/"+url.PathEscape(index), mapping, nil); err != nil {
+			return nil, fmt.Errorf("create index %s: %w", index, err)
+		}
+	}
+	return e, nil
+}
+
+func (e *Elastic) Index(ctx context.Context, u models.User) error {
+	return e.call(ctx, http.MethodPut, e.docPath(u.ID), indexDoc{Name: u.Name, Email: u.Email}, nil)
+}
+
+func (e *Elastic) Delete(ctx context.Context, id string) error {
+	err := e.call(ctx, http.MethodDelete, e.docPath(id), nil, nil)
+	if se, ok := err.(*statusError); ok && se.status == http.StatusNotFound {
+		return nil // already gone is fine
+	}
+	return err
+}
+
+// Search: multi_match with AUTO fuzziness for typos, plus a phrase prefix
+// clause for search-as-you-type.
+func (e *Elastic) Search(ctx context.Context, q string, limit int) ([]Hit, error) {
+	body := map[string]any{
+		"size":    limit,
+		"_source": false,
+		"query": map[string]any{
+			"bool": map[string]any{
+				"should": []any{
+					map[string]any{"multi_match": map[string]any{"query": q, "fields": []string{"name^2", "email"}, "fuzziness": "AUTO"}},
+					map[string]any{"multi_match": map[string]any{"query": q, "fields": []string{"name^2", "email"}, "type": "phrase_prefix"}},
+				},
+			},
+		},
+	}
+	var res struct {
+		Hits struct {
+			Hits []struct {
+				ID    string  `json:"_id"`
+				Score float64 `json:"_score"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := e.call(ctx, http.MethodPost, "/"+url.PathEscape(e.index)+"/_search", body, &res); err != nil {
+		return nil, err
+	}
+	hits := make([]Hit, len(res.Hits.Hits))
+	for i, h := range res.Hits.Hits {
+		hits[i] = Hit{ID: h.ID, Score: h.Score}
+	}
+	return hits, nil
+}
+
+func (e *Elastic) Close() error { return nil }
+
+func (e *Elastic) docPath(id string) string {
+	return "/" + url.PathEscape(e.index) + "/_doc/" + url.PathEscape(id)
+}
+
+type statusError struct {
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string { return fmt.Sprintf("elasticsearch: %d: %s", e.status, e.body) }
+
+// call sends in as json and decodes a 2xx response into out (if non-nil).
+func (e *Elastic) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	res, err := e.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return &statusError{status: res.StatusCode, body: string(msg)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (e *Elastic) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, e.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return e.http.Do(req)
+}
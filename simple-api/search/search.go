@@ -0,0 +1,125 @@
+// Package search keeps a full-text index of users next to the primary store,
+// for GET /users/search: relevance-ranked, typo tolerant matching on name and
+// email. the store stays the source of truth - the index only hands back ids
+// and scores, and can be rebuilt from the store at any time.
+//
+// backends: Bleve (embedded, the default - in memory or on disk) and
+// Elasticsearch (over its REST api).
+package search
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+)
+
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// indexDoc is what every backend indexes per user (keyed by id) - the
+// searchable fields only, nothing else leaves the store.
+type indexDoc struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type Index interface {
+	Index(ctx context.Context, u models.User) error // insert or replace
+	Delete(ctx context.Context, id string) error
+	// Search returns up to limit hits, best first
+	Search(ctx context.Context, q string, limit int) ([]Hit, error)
+	Close() error
+}
+
+// Rebuild indexes every user in st, eg on start when the index is in memory
+// or may have drifted. it returns the number of users indexed.
+func Rebuild(ctx context.Context, st store.Storage, idx Index) (int, error) {
+	it, err := st.ListUsersIter(ctx, store.Filter{})
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	n := 0
+	for it.Next() {
+		if err := idx.Index(ctx, it.Value()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, it.Err()
+}
+
+// WithIndex keeps idx in step with every successful write on st. indexing
+// failures are logged, not returned: the write already happened, and a stale
+// search result is better than a failed request (Rebuild repairs it).
+func WithIndex(st store.Storage, idx Index) store.Storage {
+	return &indexedStore{Storage: st, idx: idx}
+}
+
+type indexedStore struct {
+	store.Storage
+	idx Index
+}
+
+func (s *indexedStore) reindex(ctx context.Context, u models.User) {
+	if err := s.idx.Index(ctx, u); err != nil {
+		slog.Error("search: index failed", "id", u.ID, "err", err)
+	}
+}
+
+func (s *indexedStore) unindex(ctx context.Context, id string) {
+	if err := s.idx.Delete(ctx, id); err != nil {
+		slog.Error("search: delete failed", "id", id, "err", err)
+	}
+}
+
+func (s *indexedStore) CreateUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.CreateUser(ctx, u)
+	if err == nil {
+		s.reindex(ctx, u)
+	}
+	return u, err
+}
+
+func (s *indexedStore) UpdateUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.UpdateUser(ctx, u)
+	if err == nil {
+		s.reindex(ctx, u)
+	}
+	return u, err
+}
+
+func (s *indexedStore) RestoreUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.RestoreUser(ctx, u)
+	if err == nil {
+		s.reindex(ctx, u)
+	}
+	return u, err
+}
+
+func (s *indexedStore) DeleteUser(ctx context.Context, id string) error {
+	// resolve first: the index is keyed by ulid, the caller may have a legacy id
+	u, err := s.Storage.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.Storage.DeleteUser(ctx, u.ID); err != nil {
+		return err
+	}
+	s.unindex(ctx, u.ID)
+	return nil
+}
+
+func (s *indexedStore) DeleteUsers(ctx context.Context, f store.Filter, dryRun bool) ([]string, error) {
+	ids, err := s.Storage.DeleteUsers(ctx, f, dryRun)
+	if err == nil && !dryRun {
+		for _, id := range ids {
+			s.unindex(ctx, id)
+		}
+	}
+	return ids, err
+}
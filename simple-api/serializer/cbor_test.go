@@ -0,0 +1,152 @@
+package serializer_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/serializer"
+)
+
+var at = time.Date(2026, 3, 14, 15, 9, 26, 535897000, time.UTC)
+
+// what the api sends, in the shapes that matter: nested structs, omitempty,
+// times, maps and lists. times are set, as they are on every stored user (a
+// zero time is null in cbor, see serializer.CBOR).
+var samples = map[string]any{
+	"user": models.User{
+		ID: "01HV4ZK2Q3M5N6P7R8S9T0VWXY", LegacyID: 42, Name: "Zoë", Email: "zoe@example.com",
+		Role: models.RoleMember, CreatedAt: at, UpdatedAt: at.Add(time.Hour), DisplayName: "Zoë",
+	},
+	"user without legacy id": models.User{ID: "01HV4ZK2Q3M5N6P7R8S9T0VWXZ", Name: "a", Email: "a@example.com", CreatedAt: at, UpdatedAt: at},
+	"list":                   []models.User{{ID: "1", Name: "a", CreatedAt: at, UpdatedAt: at}, {ID: "2", Name: "b", CreatedAt: at, UpdatedAt: at}},
+	"empty list":             []models.User{},
+	"error": struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields,omitempty"`
+	}{Error: "validation failed", Fields: map[string]string{"email": "invalid email"}},
+	"numbers": map[string]any{"int": 7, "negative": -3, "float": 1.5, "big": int64(1) << 53},
+	"null":    map[string]any{"nothing": nil, "yes": true},
+}
+
+// TestCBORMatchesJSON checks that every sample, in cbor, says exactly what
+// its json says - same field names, same values - by transcoding it.
+func TestCBORMatchesJSON(t *testing.T) {
+	for name, v := range samples {
+		t.Run(name, func(t *testing.T) {
+			var js, cb bytes.Buffer
+			if err := serializer.JSON.Encode(&js, v); err != nil {
+				t.Fatal(err)
+			}
+			if err := serializer.CBOR.Encode(&cb, v); err != nil {
+				t.Fatal(err)
+			}
+			if cb.Len() >= js.Len() {
+				t.Errorf("cbor is %d bytes, json %d - no saving", cb.Len(), js.Len())
+			}
+
+			var fromCBOR any
+			if err := serializer.CBOR.Decode(cb.Bytes(), &fromCBOR); err != nil {
+				t.Fatal(err)
+			}
+			transcoded, err := json.Marshal(fromCBOR)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := tree(t, transcoded), tree(t, js.Bytes()); !reflect.DeepEqual(got, want) {
+				t.Errorf("cbor says\n\t%s\njson says\n\t%s", transcoded, js.Bytes())
+			}
+		})
+	}
+}
+
+// TestCBORRoundTrip decodes what was encoded back into the same type.
+func TestCBORRoundTrip(t *testing.T) {
+	in := samples["user"].(models.User)
+	var buf bytes.Buffer
+	if err := serializer.CBOR.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	var out models.User
+	if err := serializer.CBOR.Decode(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.CreatedAt.Equal(in.CreatedAt) || !out.UpdatedAt.Equal(in.UpdatedAt) {
+		t.Errorf("times: got %v / %v, want %v / %v", out.CreatedAt, out.UpdatedAt, in.CreatedAt, in.UpdatedAt)
+	}
+	out.CreatedAt, out.UpdatedAt = in.CreatedAt, in.UpdatedAt
+	if out != in {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+// TestCBORDecodeIsStrict holds cbor to what the json codec rejects.
+func TestCBORDecodeIsStrict(t *testing.T) {
+	type input struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	mustCBOR := func(v any) []byte {
+		b, err := cbor.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	valid := mustCBOR(map[string]string{"name": "a", "email": "a@example.com"})
+
+	var ok input
+	if err := serializer.CBOR.Decode(valid, &ok); err != nil || ok.Name != "a" {
+		t.Fatalf("valid body: %v, %+v", err, ok)
+	}
+	for name, body := range map[string][]byte{
+		"empty":         nil,
+		"unknown field": mustCBOR(map[string]string{"name": "a", "email": "a@example.com", "role": "admin"}),
+		"trailing data": append(append([]byte{}, valid...), valid...),
+		"truncated":     valid[:len(valid)-3],
+		// map(2) {"name": "a", "name": "b"}
+		"duplicate key": {0xa2, 0x64, 'n', 'a', 'm', 'e', 0x61, 'a', 0x64, 'n', 'a', 'm', 'e', 0x61, 'b'},
+		// map(1) {"name": text(2) ff fe}
+		"invalid utf-8": {0xa1, 0x64, 'n', 'a', 'm', 'e', 0x62, 0xff, 0xfe},
+	} {
+		var dst input
+		if err := serializer.CBOR.Decode(body, &dst); err == nil {
+			t.Errorf("%s: accepted, got %+v", name, dst)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, c := range []struct {
+		accept string
+		want   *serializer.Format
+		ok     bool
+	}{
+		{"", serializer.JSON, true},
+		{"application/cbor", serializer.CBOR, true},
+		{"application/json;q=0.5, application/cbor", serializer.CBOR, true},
+		{"application/cbor;q=0.5, application/json", serializer.JSON, true},
+		{"application/*", serializer.JSON, true}, // a tie goes to json
+		{"application/*;q=0.5, application/cbor;q=0.4", serializer.JSON, true},
+		{"application/cbor;q=0, */*", serializer.JSON, true},
+		{"APPLICATION/CBOR", serializer.CBOR, true},
+		{"text/html", serializer.JSON, false},
+	} {
+		if f, ok := serializer.Negotiate(c.accept, nil); f != c.want || ok != c.ok {
+			t.Errorf("Negotiate(%q) = %s, %t; want %s, %t", c.accept, f.MediaType, ok, c.want.MediaType, c.ok)
+		}
+	}
+}
+
+func tree(t *testing.T, b []byte) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatalf("%v: %s", err, b)
+	}
+	return v
+}
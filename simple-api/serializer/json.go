@@ -0,0 +1,40 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// jsonCodec is strict on the way in: unknown fields, trailing data and
+// invalid utf-8 are rejected, so typos and mangled payloads don't get
+// silently "fixed".
+type jsonCodec struct{}
+
+// Encode ends the body with a newline, as json.Encoder does.
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(body []byte, dst any) error {
+	// the decoder would swap bad bytes for U+FFFD
+	if !utf8.Valid(body) {
+		return errors.New("body must be valid utf-8")
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("body must not be empty")
+		}
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	// More() would let a stray closing '}' through, Token() doesn't
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("body must contain a single json value")
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package serializer is the registry of wire formats, keyed by media type.
+// request bodies are decoded with the codec their Content-Type names and
+// responses encoded with the one Accept asks for, so a new format is one
+// Register call (in an init, like database/sql drivers) and no handler
+// changes:
+//
+//	serializer.Register("application/cbor", cborCodec{})
+//
+// json and cbor are registered here. json is the default: it's what a body
+// without a Content-Type we know is read as (curl -d says form-urlencoded),
+// and what a client gets when its Accept names nothing registered.
+package serializer
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec encodes and decodes one format.
+type Codec interface {
+	// Encode writes v to w as a complete body.
+	Encode(w io.Writer, v any) error
+	// Decode reads exactly one value from body into dst, rejecting input
+	// that doesn't map onto dst (unknown fields) rather than dropping it.
+	// errors are for the client; they end up in a 400.
+	Decode(body []byte, dst any) error
+}
+
+// Partial is implemented by codecs that can only encode some values -
+// protobuf needs a message type for each. Negotiate passes over them for
+// the rest.
+type Partial interface {
+	Encodes(v any) bool
+}
+
+// Format is a registered codec and the media type it's served as.
+type Format struct {
+	MediaType string
+	// ContentType is the header value, built once: responses share it, so
+	// it must not be modified (an Add on it copies, len == cap).
+	ContentType []string
+	Codec
+}
+
+var (
+	mu      sync.RWMutex
+	formats []*Format // registration order, which breaks ties in Negotiate
+	byType  = map[string]*Format{}
+)
+
+// JSON is the default format.
+var JSON = Register("application/json", jsonCodec{})
+
+// Register adds c as the codec for mediaType and returns its Format. it
+// panics on a malformed or already registered media type - both are bugs.
+func Register(mediaType string, c Codec) *Format {
+	mt, params, err := mime.ParseMediaType(mediaType)
+	if err != nil || len(params) > 0 || strings.Contains(mt, "*") {
+		panic(fmt.Sprintf("serializer: bad media type %q", mediaType))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := byType[mt]; dup {
+		panic("serializer: Register called twice for " + mt)
+	}
+	f := &Format{MediaType: mt, ContentType: []string{mt}, Codec: c}
+	formats = append(formats, f)
+	byType[mt] = f
+	return f
+}
+
+// Lookup finds the format for a Content-Type header value (parameters like
+// charset are ignored).
+func Lookup(contentType string) (*Format, bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := byType[mt]
+	return f, ok
+}
+
+// Plural reports whether there's more than one format to choose from - only
+// then do responses depend on Accept (and say so in Vary).
+func Plural() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(formats) > 1
+}
+
+// Negotiate picks the format to send v in for an Accept header value: of
+// the registered ones that can encode v, the one with the highest q - JSON
+// on a tie, then the earlier registered. ok is false when Accept rules
+// everything out; f is JSON then, as it is for an empty Accept.
+func Negotiate(accept string, v any) (f *Format, ok bool) {
+	// the common cases, without parsing
+	switch accept {
+	case "", "*/*", "application/json":
+		return JSON, true
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	best, bestQ := JSON, quality(accept, JSON.MediaType)
+	for _, cand := range formats {
+		if p, ok := cand.Codec.(Partial); ok && !p.Encodes(v) {
+			continue
+		}
+		if q := quality(accept, cand.MediaType); q > bestQ {
+			best, bestQ = cand, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// quality is the q the most specific matching range in accept gives mt
+// (rfc 9110: "text/plain" beats "text/*" beats "*/*").
+func quality(accept, mt string) float64 {
+	typ, _, _ := strings.Cut(mt, "/")
+	q, specificity := 0.0, -1
+	for rng := range strings.SplitSeq(accept, ",") {
+		rng, params, _ := strings.Cut(rng, ";")
+		rng = strings.ToLower(strings.TrimSpace(rng))
+		s := -1
+		switch {
+		case rng == mt:
+			s = 2
+		case rng == typ+"/*":
+			s = 1
+		case rng == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		for p := range strings.SplitSeq(params, ";") {
+			if k, v, _ := strings.Cut(p, "="); strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+	}
+	return q
+}
@@ -0,0 +1,487 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt is an embedded, durable backend on a single bbolt file - for single
+// binary deployments that want their data to survive without running a
+// database server. one writer at a time (bolt's rule), readers never block.
+//
+// layout: users (id -> json), emails (email -> id) and legacy (big-endian
+// int64 -> id). the index buckets are updated in the same transaction as
+// users, same as Memory does under its lock. revisions (id + big-endian
+// rev -> json) is the RevisionLog.
+type Bolt struct {
+	db *bolt.DB
+}
+
+var (
+	boltUsers  = []byte("users")
+	boltEmails = []byte("emails")
+	boltLegacy = []byte("legacy")
+
+	boltRevisions = []byte("revisions")
+)
+
+// OpenBolt opens (or creates) the database file at path.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second}) // timeout: another process has the file
+	if err != nil {
+		return nil, fmt.Errorf("bolt %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{boltUsers, boltEmails, boltLegacy, boltRevisions} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("bolt %s: %w", path, err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+func (b *Bolt) Close() error { return b.db.Close() }
+
+func legacyKey(n int64) []byte { return binary.BigEndian.AppendUint64(nil, uint64(n)) }
+
+func getBoltUser(tx *bolt.Tx, id []byte) (models.User, error) {
+	raw := tx.Bucket(boltUsers).Get(id)
+	if raw == nil {
+		return models.User{}, ErrNotFound
+	}
+	var u models.User
+	if err := json.Unmarshal(raw, &u); err != nil {
+		return models.User{}, fmt.Errorf("bolt: user %s: %w", id, err)
+	}
+	u.Compute()
+	return u, nil
+}
+
+func putBoltUser(tx *bolt.Tx, u models.User) error {
+	raw, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltUsers).Put([]byte(u.ID), raw)
+}
+
+// resolveBolt maps either id format to the ULID key.
+func resolveBolt(tx *bolt.Tx, id string) []byte {
+	if legacy, ok := ids.Legacy(id); ok {
+		return tx.Bucket(boltLegacy).Get(legacyKey(legacy))
+	}
+	return []byte(ids.Canonical(id))
+}
+
+func (b *Bolt) ListUsers(ctx context.Context, f Filter) ([]models.User, error) {
+	out := []models.User{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUsers).ForEach(func(k, v []byte) error {
+			var u models.User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("bolt: user %s: %w", k, err)
+			}
+			u.Compute()
+			if f.Match(u) {
+				out = append(out, u)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Sort) > 0 {
+		f.sortUsers(out)
+	} // otherwise keys are ulids, already in order
+	return out, nil
+}
+
+func (b *Bolt) GetUser(ctx context.Context, id string) (u models.User, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		key := resolveBolt(tx, id)
+		if key == nil {
+			return ErrNotFound
+		}
+		u, err = getBoltUser(tx, key)
+		return err
+	})
+	return u, err
+}
+
+func (b *Bolt) GetUserByEmail(ctx context.Context, email string) (u models.User, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(boltEmails).Get([]byte(email))
+		if id == nil {
+			return ErrNotFound
+		}
+		u, err = getBoltUser(tx, id)
+		return err
+	})
+	return u, err
+}
+
+func (b *Bolt) CreateUser(ctx context.Context, u models.User) (models.User, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if id := tx.Bucket(boltEmails).Get([]byte(u.Email)); id != nil {
+			return &DuplicateError{Field: "email", ExistingID: string(id)}
+		}
+		if id := tx.Bucket(boltLegacy).Get(legacyKey(u.LegacyID)); u.LegacyID != 0 && id != nil {
+			return &DuplicateError{Field: "legacy_id", ExistingID: string(id)}
+		}
+		u.ID = ids.New()
+		u.PrepareCreate(time.Now())
+		if err := putBoltUser(tx, u); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltEmails).Put([]byte(u.Email), []byte(u.ID)); err != nil {
+			return err
+		}
+		if u.LegacyID != 0 {
+			return tx.Bucket(boltLegacy).Put(legacyKey(u.LegacyID), []byte(u.ID))
+		}
+		return nil
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return u, nil
+}
+
+func (b *Bolt) RestoreUser(ctx context.Context, u models.User) (models.User, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if id := tx.Bucket(boltEmails).Get([]byte(u.Email)); id != nil {
+			return &DuplicateError{Field: "email", ExistingID: string(id)}
+		}
+		if tx.Bucket(boltUsers).Get([]byte(u.ID)) != nil {
+			return &DuplicateError{Field: "id", ExistingID: u.ID}
+		}
+		if id := tx.Bucket(boltLegacy).Get(legacyKey(u.LegacyID)); u.LegacyID != 0 && id != nil {
+			return &DuplicateError{Field: "legacy_id", ExistingID: string(id)}
+		}
+		if err := putBoltUser(tx, u); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltEmails).Put([]byte(u.Email), []byte(u.ID)); err != nil {
+			return err
+		}
+		if u.LegacyID != 0 {
+			return tx.Bucket(boltLegacy).Put(legacyKey(u.LegacyID), []byte(u.ID))
+		}
+		return nil
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	u.Compute()
+	return u, nil
+}
+
+func (b *Bolt) UpdateUser(ctx context.Context, u models.User) (models.User, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		key := resolveBolt(tx, u.ID)
+		if key == nil {
+			return ErrNotFound
+		}
+		old, err := getBoltUser(tx, key)
+		if err != nil {
+			return err
+		}
+		u.ID, u.LegacyID = old.ID, old.LegacyID
+		u.PrepareUpdate(old, time.Now())
+
+		emails := tx.Bucket(boltEmails)
+		if owner := emails.Get([]byte(u.Email)); owner != nil && !bytes.Equal(owner, []byte(u.ID)) {
+			return &DuplicateError{Field: "email", ExistingID: string(owner)}
+		}
+		if err := emails.Delete([]byte(old.Email)); err != nil {
+			return err
+		}
+		if err := emails.Put([]byte(u.Email), []byte(u.ID)); err != nil {
+			return err
+		}
+		return putBoltUser(tx, u)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return u, nil
+}
+
+func (b *Bolt) DeleteUser(ctx context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		key := resolveBolt(tx, id)
+		if key == nil {
+			return ErrNotFound
+		}
+		return dropBolt(tx, key)
+	})
+}
+
+func (b *Bolt) DeleteUsers(ctx context.Context, f Filter, dryRun bool) ([]string, error) {
+	var matched []string
+	fn := func(tx *bolt.Tx) error {
+		err := tx.Bucket(boltUsers).ForEach(func(k, v []byte) error {
+			var u models.User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("bolt: user %s: %w", k, err)
+			}
+			if f.Match(u) {
+				matched = append(matched, u.ID)
+			}
+			return nil
+		})
+		if err != nil || dryRun {
+			return err
+		}
+		for _, id := range matched { // not inside ForEach: bolt forbids changing a bucket mid-iteration
+			if err := dropBolt(tx, []byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var err error
+	if dryRun {
+		err = b.db.View(fn)
+	} else {
+		err = b.db.Update(fn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return matched, nil // ForEach went in key order, so already sorted
+}
+
+// dropBolt removes the user at key from every bucket.
+func dropBolt(tx *bolt.Tx, key []byte) error {
+	u, err := getBoltUser(tx, key)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltUsers).Delete(key); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltEmails).Delete([]byte(u.Email)); err != nil {
+		return err
+	}
+	if u.LegacyID != 0 {
+		return tx.Bucket(boltLegacy).Delete(legacyKey(u.LegacyID))
+	}
+	return nil
+}
+
+func revisionKey(id string, rev int) []byte {
+	return binary.BigEndian.AppendUint64([]byte(id), uint64(rev))
+}
+
+func (b *Bolt) AppendRevision(ctx context.Context, op string, u models.User, keep int) (rev Revision, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(boltRevisions)
+		c := bk.Cursor()
+		prefix := []byte(u.ID)
+		var have [][]byte
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			have = append(have, bytes.Clone(k))
+		}
+		rev = Revision{Rev: 1, Op: op, At: time.Now().UTC(), User: u}
+		if len(have) > 0 {
+			last := have[len(have)-1]
+			rev.Rev = int(binary.BigEndian.Uint64(last[len(prefix):])) + 1
+		}
+		raw, err := json.Marshal(rev)
+		if err != nil {
+			return err
+		}
+		if err := bk.Put(revisionKey(u.ID, rev.Rev), raw); err != nil {
+			return err
+		}
+		for _, k := range have[:max(len(have)+1-keep, 0)] {
+			if err := bk.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return rev, err
+}
+
+func (b *Bolt) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	var revs []Revision
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltRevisions).Cursor()
+		prefix := []byte(id)
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var rev Revision
+			if err := json.Unmarshal(v, &rev); err != nil {
+				return fmt.Errorf("bolt: revision %x: %w", k, err)
+			}
+			rev.User.Compute()
+			revs = append(revs, rev)
+		}
+		return nil
+	})
+	return revs, err
+}
+
+// PruneRevisions works through the bucket boltPageSize keys per write
+// transaction, so writers wait on it no longer than that.
+func (b *Bolt) PruneRevisions(ctx context.Context, cutoff time.Time) (int, error) {
+	pruned := 0
+	var from []byte // where the next transaction starts; nil: done
+	for first := true; first || from != nil; first = false {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+		err := b.db.Update(func(tx *bolt.Tx) error {
+			bk := tx.Bucket(boltRevisions)
+			c := bk.Cursor()
+			k, v := c.First()
+			if from != nil {
+				k, v = c.Seek(from)
+			}
+			from = nil
+			var gone [][]byte
+			for n := 0; k != nil; n++ {
+				if n == boltPageSize {
+					from = bytes.Clone(k)
+					break
+				}
+				var rev Revision
+				if err := json.Unmarshal(v, &rev); err != nil {
+					return fmt.Errorf("bolt: revision %x: %w", k, err)
+				}
+				nk, nv := c.Next()
+				newest := nk == nil || !bytes.Equal(nk[:len(nk)-8], k[:len(k)-8])
+				if rev.At.Before(cutoff) && !(newest && rev.Op != OpDeleted) {
+					gone = append(gone, bytes.Clone(k))
+				}
+				k, v = nk, nv
+			}
+			for _, k := range gone {
+				if err := bk.Delete(k); err != nil {
+					return err
+				}
+			}
+			pruned += len(gone)
+			return nil
+		})
+		if err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+// ListUsersIter pages through the users bucket in short read transactions
+// (a long-lived one would pin old pages and grow the file), resuming after
+// the last key each time. a custom sort needs every row first, so that case
+// falls back to ListUsers.
+func (b *Bolt) ListUsersIter(ctx context.Context, f Filter) (Iterator[models.User], error) {
+	if len(f.Sort) > 0 {
+		users, err := b.ListUsers(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		return &sliceIter{ctx: ctx, users: users}, nil
+	}
+	return &boltIter{ctx: ctx, b: b, f: f}, nil
+}
+
+// boltPageSize is how many keys one read transaction looks at, matching or
+// not: a selective filter makes for short pages, not a long transaction.
+const boltPageSize = 256
+
+type boltIter struct {
+	ctx  context.Context
+	b    *Bolt
+	f    Filter
+	page []models.User
+	last []byte // key to resume after
+	done bool
+	cur  models.User
+	err  error
+}
+
+func (it *boltIter) Next() bool {
+	if it.err == nil && it.ctx.Err() != nil {
+		it.err, it.page = it.ctx.Err(), nil
+	}
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		if it.err = it.ctx.Err(); it.err == nil {
+			it.err = it.fill()
+		}
+	}
+	it.cur, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+func (it *boltIter) fill() error {
+	return it.b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltUsers).Cursor()
+		k, v := c.First()
+		if it.last != nil {
+			if k, v = c.Seek(it.last); k != nil && bytes.Equal(k, it.last) {
+				k, v = c.Next()
+			}
+		}
+		for n := 0; n < boltPageSize; n++ {
+			if k == nil {
+				it.done = true
+				return nil
+			}
+			it.last = append(it.last[:0], k...)
+			var u models.User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("bolt: user %s: %w", k, err)
+			}
+			u.Compute()
+			if it.f.Match(u) {
+				it.page = append(it.page, u)
+			}
+			k, v = c.Next()
+		}
+		return nil
+	})
+}
+
+func (it *boltIter) Value() models.User { return it.cur }
+func (it *boltIter) Err() error         { return it.err }
+func (it *boltIter) Close() error       { it.page, it.done = nil, true; return nil }
+
+// sliceIter iterates an already materialised result.
+type sliceIter struct {
+	ctx   context.Context
+	users []models.User
+	cur   models.User
+	err   error
+}
+
+func (it *sliceIter) Next() bool {
+	if it.err = it.ctx.Err(); it.err != nil || len(it.users) == 0 {
+		return false
+	}
+	it.cur, it.users = it.users[0], it.users[1:]
+	return true
+}
+
+func (it *sliceIter) Value() models.User { return it.cur }
+func (it *sliceIter) Err() error         { return it.err }
+func (it *sliceIter) Close() error       { it.users = nil; return nil }
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// change kinds recorded in the feed
+const (
+	OpCreated = "created"
+	OpUpdated = "updated"
+	OpDeleted = "deleted"
+)
+
+type Change struct {
+	Seq    uint64    `json:"seq"`
+	Op     string    `json:"op"`
+	UserID string    `json:"user_id"`
+	At     time.Time `json:"at"`
+}
+
+// ChangeFeed keeps the most recent mutations in memory and lets readers
+// block until something newer than a given sequence number shows up.
+type ChangeFeed struct {
+	mu      sync.Mutex
+	buf     []Change // oldest first, at most size entries
+	size    int
+	seq     uint64
+	changed chan struct{} // closed (and replaced) on every append - a broadcast
+}
+
+func NewChangeFeed(size int) *ChangeFeed {
+	return &ChangeFeed{size: size, changed: make(chan struct{})}
+}
+
+func (f *ChangeFeed) append(op string, id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	f.buf = append(f.buf, Change{Seq: f.seq, Op: op, UserID: id, At: time.Now().UTC()})
+	if len(f.buf) > f.size {
+		f.buf = f.buf[len(f.buf)-f.size:]
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// Head is the sequence number of the latest change (0 if none yet).
+func (f *ChangeFeed) Head() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+// Since returns the changes after seq, the sequence to resume from, and
+// reset=true when seq is older than what the feed still remembers
+// (the caller missed changes and should re-list).
+func (f *ChangeFeed) Since(seq uint64) (changes []Change, next uint64, reset bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changes, next, reset, _ = f.since(seq)
+	return changes, next, reset
+}
+
+func (f *ChangeFeed) since(seq uint64) ([]Change, uint64, bool, <-chan struct{}) {
+	if seq > f.seq {
+		// token from before a restart (or made up) - start over
+		return nil, f.seq, true, f.changed
+	}
+	reset := len(f.buf) > 0 && seq+1 < f.buf[0].Seq
+	var out []Change
+	for _, c := range f.buf {
+		if c.Seq > seq {
+			out = append(out, c)
+		}
+	}
+	return out, f.seq, reset, f.changed
+}
+
+// Wait is Since, but blocks until there is at least one change, ctx is done
+// or timeout passes. a timeout is not an error - it just returns no changes.
+func (f *ChangeFeed) Wait(ctx context.Context, seq uint64, timeout time.Duration) ([]Change, uint64, bool, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		f.mu.Lock()
+		changes, next, reset, changed := f.since(seq)
+		f.mu.Unlock()
+		if len(changes) > 0 || reset {
+			return changes, next, reset, nil
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, next, false, nil
+		case <-ctx.Done():
+			return nil, next, false, ctx.Err()
+		}
+	}
+}
+
+// WithChangeFeed records every successful mutation on st into feed.
+func WithChangeFeed(st Storage, feed *ChangeFeed) Storage {
+	return &feedStore{Storage: st, feed: feed}
+}
+
+type feedStore struct {
+	Storage
+	feed *ChangeFeed
+}
+
+func (s *feedStore) CreateUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.CreateUser(ctx, u)
+	if err == nil {
+		s.feed.append(OpCreated, u.ID)
+	}
+	return u, err
+}
+
+func (s *feedStore) UpdateUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.UpdateUser(ctx, u)
+	if err == nil {
+		s.feed.append(OpUpdated, u.ID)
+	}
+	return u, err
+}
+
+func (s *feedStore) DeleteUser(ctx context.Context, id string) error {
+	// resolve first so a delete by legacy id still reports the ulid
+	u, err := s.Storage.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = s.Storage.DeleteUser(ctx, u.ID)
+	if err == nil {
+		s.feed.append(OpDeleted, u.ID)
+	}
+	return err
+}
+
+// RestoreUser shows up as a create: for a client following the feed the
+// user is back, with the id it had.
+func (s *feedStore) RestoreUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.RestoreUser(ctx, u)
+	if err == nil {
+		s.feed.append(OpCreated, u.ID)
+	}
+	return u, err
+}
+
+func (s *feedStore) DeleteUsers(ctx context.Context, f Filter, dryRun bool) ([]string, error) {
+	ids, err := s.Storage.DeleteUsers(ctx, f, dryRun)
+	if err == nil && !dryRun {
+		for _, id := range ids {
+			s.feed.append(OpDeleted, id)
+		}
+	}
+	return ids, err
+}
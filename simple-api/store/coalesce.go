@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamskyy666/simple-api/metrics"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+// reads that joined another caller's call (shared) vs the ones that made it
+// (leader), by operation; shared / (leader + shared) is the dedup rate
+var coalesced = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "storage_coalesced_reads_total",
+	Help: "Reads by whether they made the storage call or shared one already in flight.",
+}, []string{"op", "role"})
+
+func init() { metrics.Registry.MustRegister(coalesced) }
+
+// Coalesce collapses identical concurrent reads on st into one call - a
+// hundred clients polling the same user while the database is slow cost one
+// query, not a hundred. writes pass through, and every write that completes
+// starts a new generation of keys, so a read that begins after a caller's
+// write never gets a result fetched before it. reads from the primary
+// (ReadFromPrimary) only coalesce with each other.
+//
+// the shared call runs detached from the callers' contexts: one client
+// giving up doesn't fail the others, and each caller still returns as soon
+// as its own context is done. with nobody left to cancel it, the call is
+// given up after timeout.
+func Coalesce(st Storage, timeout time.Duration) Storage {
+	return &coalescing{Storage: st, timeout: timeout, list: newReadOp("list_users"), get: newReadOp("get_user"), byEmail: newReadOp("get_user_by_email")}
+}
+
+type coalescing struct {
+	Storage
+	group   singleflight.Group
+	gen     atomic.Uint64
+	timeout time.Duration
+
+	list, get, byEmail readOp
+}
+
+// readOp is an operation's name and its counters, resolved once instead of
+// by label on every call.
+type readOp struct {
+	name           string
+	leader, shared prometheus.Counter
+}
+
+func newReadOp(name string) readOp {
+	return readOp{name: name, leader: coalesced.WithLabelValues(name, "leader"), shared: coalesced.WithLabelValues(name, "shared")}
+}
+
+func do[T any](s *coalescing, ctx context.Context, op readOp, key string, fn func(context.Context) (T, error)) (T, error) {
+	// one allocation for the key (the group keeps it), not fmt's several
+	var buf [64]byte
+	b := strconv.AppendUint(buf[:0], s.gen.Load(), 10)
+	if readsFromPrimary(ctx) {
+		b = append(b, " primary"...)
+	}
+	b = append(append(append(append(b, ' '), op.name...), ' '), key...)
+	key = string(b)
+	detached := context.WithoutCancel(ctx)
+	ch := s.group.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(detached, s.timeout)
+		defer cancel()
+		return fn(ctx)
+	})
+	select {
+	case res := <-ch:
+		if res.Shared {
+			op.shared.Inc()
+		} else {
+			op.leader.Inc()
+		}
+		v, _ := res.Val.(T)
+		return v, res.Err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// written bumps the generation after a write, successful or not - a failed
+// one may still have changed something (a bulk delete halfway through).
+func (s *coalescing) written() { s.gen.Add(1) }
+
+// filterKey spells out everything that changes what ListUsers returns.
+func filterKey(f Filter) string {
+	var sb strings.Builder
+	for _, c := range f.Conds {
+		fmt.Fprintf(&sb, "%q:%q:%q ", c.Field, c.Op, c.Value)
+	}
+	for _, k := range f.Sort {
+		fmt.Fprintf(&sb, "sort=%s/%t ", k.Field, k.Desc)
+	}
+	fmt.Fprintf(&sb, "collation=%q", f.Collation)
+	return sb.String()
+}
+
+// ListUsers results are shared between callers, so each gets its own copy
+// of the slice to sort or cut down (Range) without touching the others'.
+func (s *coalescing) ListUsers(ctx context.Context, f Filter) ([]models.User, error) {
+	users, err := do(s, ctx, s.list, filterKey(f), func(ctx context.Context) ([]models.User, error) {
+		return s.Storage.ListUsers(ctx, f)
+	})
+	if users != nil {
+		users = append([]models.User(nil), users...)
+	}
+	return users, err
+}
+
+func (s *coalescing) GetUser(ctx context.Context, id string) (models.User, error) {
+	return do(s, ctx, s.get, id, func(ctx context.Context) (models.User, error) {
+		return s.Storage.GetUser(ctx, id)
+	})
+}
+
+func (s *coalescing) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return do(s, ctx, s.byEmail, email, func(ctx context.Context) (models.User, error) {
+		return s.Storage.GetUserByEmail(ctx, email)
+	})
+}
+
+func (s *coalescing) CreateUser(ctx context.Context, u models.User) (models.User, error) {
+	defer s.written()
+	return s.Storage.CreateUser(ctx, u)
+}
+
+func (s *coalescing) UpdateUser(ctx context.Context, u models.User) (models.User, error) {
+	defer s.written()
+	return s.Storage.UpdateUser(ctx, u)
+}
+
+func (s *coalescing) DeleteUser(ctx context.Context, id string) error {
+	defer s.written()
+	return s.Storage.DeleteUser(ctx, id)
+}
+
+func (s *coalescing) RestoreUser(ctx context.Context, u models.User) (models.User, error) {
+	defer s.written()
+	return s.Storage.RestoreUser(ctx, u)
+}
+
+func (s *coalescing) DeleteUsers(ctx context.Context, f Filter, dryRun bool) ([]string, error) {
+	if !dryRun {
+		defer s.written()
+	}
+	return s.Storage.DeleteUsers(ctx, f, dryRun)
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// heldStore answers GetUser once release is closed, or fails when its
+// context is done.
+type heldStore struct {
+	Storage
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (h *heldStore) GetUser(ctx context.Context, id string) (models.User, error) {
+	h.calls.Add(1)
+	select {
+	case <-h.release:
+		return models.User{ID: id}, nil
+	case <-ctx.Done():
+		return models.User{}, ctx.Err()
+	}
+}
+
+// TestCoalesceReads: concurrent identical reads make one backend call and
+// all get its result, even when the caller that started it gives up.
+func TestCoalesceReads(t *testing.T) {
+	backend := &heldStore{Storage: NewMemory(), release: make(chan struct{})}
+	st := Coalesce(backend, time.Minute)
+
+	const n = 20
+	leaving, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		ctx := context.Background()
+		if i == 0 {
+			ctx = leaving
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := st.GetUser(ctx, "01ARZ3NDEKTSV4RRFFQ69G5FAV")
+			if err == nil && u.ID != "01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+				err = errors.New("got someone else's user")
+			}
+			if ctx != leaving {
+				errs <- err
+			}
+		}()
+	}
+	// every caller has had time to join the call in flight
+	for backend.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	close(backend.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := backend.calls.Load(); got != 1 {
+		t.Errorf("%d backend calls for %d identical reads, want 1", got, n)
+	}
+}
+
+// TestCoalesceTimeout: a shared call nobody cancels still ends.
+func TestCoalesceTimeout(t *testing.T) {
+	backend := &heldStore{Storage: NewMemory(), release: make(chan struct{})}
+	st := Coalesce(backend, 10*time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		_, err := st.GetUser(context.Background(), "01ARZ3NDEKTSV4RRFFQ69G5FAV")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("stuck call: %v, want its deadline", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shared call outlived its timeout")
+	}
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/redact"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Filter is the shared query syntax for listing and bulk operations.
+// on the wire it's one or more `filter=<field>:<op>:<value>` params, all AND'ed:
+//
+//	GET /users?filter=email:suffix:@example.com&filter=name:ne:bot
+//
+// backends get the parsed Conds so they can push them down to their query language.
+//
+// Sort orders listings (`sort=name,-created_at`); ties, and no sort at all,
+// fall back to id, ie creation order. bulk operations ignore it.
+//
+// Collation, a BCP 47 tag, sorts names by that locale's rules (so "Ärzte"
+// lands next to "Arzt" instead of after "Zoe"); empty sorts bytewise.
+type Filter struct {
+	Conds     []Cond
+	Sort      []SortKey
+	Collation string
+}
+
+type SortKey struct {
+	Field string // id, name, email, created_at, updated_at
+	Desc  bool
+}
+
+type Cond struct {
+	Field string // id, name, email
+	Op    string // eq, ne, contains, prefix, suffix
+	Value string
+}
+
+var (
+	filterFields = map[string]bool{"id": true, "name": true, "email": true}
+	filterOps    = map[string]bool{"eq": true, "ne": true, "contains": true, "prefix": true, "suffix": true}
+	sortFields   = map[string]bool{"id": true, "name": true, "email": true, "created_at": true, "updated_at": true}
+)
+
+// ParseFilter parses raw `filter` query values; an empty list is a match-all Filter.
+func ParseFilter(raw []string) (Filter, error) {
+	var f Filter
+	for _, r := range raw {
+		parts := strings.SplitN(r, ":", 3)
+		if len(parts) != 3 {
+			return Filter{}, fmt.Errorf("filter %q: want field:op:value", r)
+		}
+		c := Cond{Field: strings.ToLower(parts[0]), Op: strings.ToLower(parts[1]), Value: parts[2]}
+		if !filterFields[c.Field] {
+			return Filter{}, fmt.Errorf("filter %q: unknown field %q", r, c.Field)
+		}
+		if !filterOps[c.Op] {
+			return Filter{}, fmt.Errorf("filter %q: unknown op %q", r, c.Op)
+		}
+		if c.Field == "id" {
+			if c.Op != "eq" && c.Op != "ne" {
+				return Filter{}, fmt.Errorf("filter %q: id only supports eq and ne", r)
+			}
+			if !ids.Valid(c.Value) {
+				return Filter{}, fmt.Errorf("filter %q: invalid id", r)
+			}
+			c.Value = ids.Canonical(c.Value)
+		}
+		f.Conds = append(f.Conds, c)
+	}
+	return f, nil
+}
+
+// ParseSort parses a `sort` query value: comma separated fields, "-" for descending.
+func ParseSort(raw string) ([]SortKey, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var keys []SortKey
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		k := SortKey{Field: strings.ToLower(strings.TrimSpace(part))}
+		if rest, ok := strings.CutPrefix(k.Field, "-"); ok {
+			k.Field, k.Desc = rest, true
+		}
+		if !sortFields[k.Field] {
+			return nil, fmt.Errorf("sort %q: unknown field %q", raw, k.Field)
+		}
+		if seen[k.Field] {
+			return nil, fmt.Errorf("sort %q: %q given twice", raw, k.Field)
+		}
+		seen[k.Field] = true
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// LogValue prints the filter with name/email values masked, so slow query
+// logs show the shape of a query without the pii in it.
+func (f Filter) LogValue() slog.Value {
+	var sb strings.Builder
+	for i, c := range f.Conds {
+		if i > 0 {
+			sb.WriteString(" AND ")
+		}
+		v := c.Value
+		if c.Field != "id" {
+			v = redact.Mask
+		}
+		fmt.Fprintf(&sb, "%s:%s:%s", c.Field, c.Op, v)
+	}
+	for i, k := range f.Sort {
+		if i == 0 {
+			sb.WriteString(" sort=")
+		} else {
+			sb.WriteString(",")
+		}
+		if k.Desc {
+			sb.WriteString("-")
+		}
+		sb.WriteString(k.Field)
+	}
+	if f.Collation != "" {
+		sb.WriteString(" collation=" + f.Collation)
+	}
+	return slog.StringValue(sb.String())
+}
+
+// Empty reports whether f matches everything (Sort doesn't narrow anything).
+func (f Filter) Empty() bool { return len(f.Conds) == 0 }
+
+// Match is the reference semantics every backend has to agree with:
+// eq/ne are exact, contains/prefix/suffix ignore case.
+func (f Filter) Match(u models.User) bool {
+	for _, c := range f.Conds {
+		if !c.match(u) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Cond) match(u models.User) bool {
+	var v string
+	switch c.Field {
+	case "id":
+		// legacy ids keep working here too while clients migrate
+		if legacy, ok := ids.Legacy(c.Value); ok {
+			match := legacy == u.LegacyID
+			return match == (c.Op == "eq")
+		}
+		v = u.ID
+	case "name":
+		v = u.Name
+	case "email":
+		v = u.Email
+	}
+
+	switch c.Op {
+	case "eq":
+		return v == c.Value
+	case "ne":
+		return v != c.Value
+	case "contains":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(c.Value))
+	case "prefix":
+		return strings.HasPrefix(strings.ToLower(v), strings.ToLower(c.Value))
+	case "suffix":
+		return strings.HasSuffix(strings.ToLower(v), strings.ToLower(c.Value))
+	}
+	return false
+}
+
+// Less is the reference ordering for Sort, with id as the final tie-break.
+func (f Filter) Less(a, b models.User) bool { return f.less()(a, b) }
+
+// less is Less with the collator built once, for sorting a whole slice.
+// collators aren't safe for concurrent use, so each sort gets its own.
+func (f Filter) less() func(a, b models.User) bool {
+	compareName := strings.Compare
+	if f.Collation != "" {
+		compareName = collate.New(language.Make(f.Collation)).CompareString
+	}
+	return func(a, b models.User) bool {
+		for _, k := range f.Sort {
+			var c int
+			if k.Field == "name" {
+				c = compareName(a.Name, b.Name)
+			} else {
+				c = compareField(k.Field, a, b)
+			}
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != k.Desc
+		}
+		return a.ID < b.ID
+	}
+}
+
+// sortUsers sorts users in place by f.Sort.
+func (f Filter) sortUsers(users []models.User) {
+	less := f.less()
+	sort.Slice(users, func(i, j int) bool { return less(users[i], users[j]) })
+}
+
+func compareField(field string, a, b models.User) int {
+	switch field {
+	case "id":
+		return strings.Compare(a.ID, b.ID)
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "email":
+		return strings.Compare(a.Email, b.Email)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	return 0
+}
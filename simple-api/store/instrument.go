@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/iamskyy666/simple-api/errs"
+	"github.com/iamskyy666/simple-api/metrics"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// storage call latency, by operation and result (ok, not_found, duplicate, error)
+var opDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "storage_operation_duration_seconds",
+	Help:    "Latency of storage calls.",
+	Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms .. ~4s
+}, []string{"op", "result"})
+
+func init() { metrics.Registry.MustRegister(opDuration) }
+
+// Instrument times every call on st into the storage histogram and logs the
+// ones slower than slow (0 = never), with their parameters run through
+// LogValue so no PII ends up in the log.
+func Instrument(st Storage, slow time.Duration) Storage {
+	return &instrumented{Storage: st, slow: slow}
+}
+
+type instrumented struct {
+	Storage
+	slow time.Duration
+}
+
+func (s *instrumented) observe(op string, start time.Time, err error, params ...any) {
+	took := time.Since(start)
+	opDuration.WithLabelValues(op, result(err)).Observe(took.Seconds())
+	if s.slow > 0 && took >= s.slow {
+		slog.Warn("storage: slow call", append([]any{"op", op, "took", took, "err", err}, params...)...)
+	}
+}
+
+func result(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	switch errs.KindOf(err) {
+	case errs.NotFound:
+		return "not_found"
+	case errs.Conflict:
+		return "duplicate"
+	default:
+		return "error"
+	}
+}
+
+func (s *instrumented) ListUsers(ctx context.Context, f Filter) (users []models.User, err error) {
+	defer func(start time.Time) { s.observe("list_users", start, err, "filter", f, "rows", len(users)) }(time.Now())
+	return s.Storage.ListUsers(ctx, f)
+}
+
+// ListUsersIter only times opening the stream - the rows arrive as the caller reads them.
+func (s *instrumented) ListUsersIter(ctx context.Context, f Filter) (it Iterator[models.User], err error) {
+	defer func(start time.Time) { s.observe("list_users_iter", start, err, "filter", f) }(time.Now())
+	return s.Storage.ListUsersIter(ctx, f)
+}
+
+func (s *instrumented) GetUser(ctx context.Context, id string) (u models.User, err error) {
+	defer func(start time.Time) { s.observe("get_user", start, err, "id", id) }(time.Now())
+	return s.Storage.GetUser(ctx, id)
+}
+
+func (s *instrumented) GetUserByEmail(ctx context.Context, email string) (u models.User, err error) {
+	defer func(start time.Time) { s.observe("get_user_by_email", start, err) }(time.Now()) // the email is the pii
+	return s.Storage.GetUserByEmail(ctx, email)
+}
+
+func (s *instrumented) CreateUser(ctx context.Context, in models.User) (u models.User, err error) {
+	defer func(start time.Time) { s.observe("create_user", start, err, "user", in) }(time.Now())
+	return s.Storage.CreateUser(ctx, in)
+}
+
+func (s *instrumented) UpdateUser(ctx context.Context, in models.User) (u models.User, err error) {
+	defer func(start time.Time) { s.observe("update_user", start, err, "user", in) }(time.Now())
+	return s.Storage.UpdateUser(ctx, in)
+}
+
+func (s *instrumented) DeleteUser(ctx context.Context, id string) (err error) {
+	defer func(start time.Time) { s.observe("delete_user", start, err, "id", id) }(time.Now())
+	return s.Storage.DeleteUser(ctx, id)
+}
+
+func (s *instrumented) RestoreUser(ctx context.Context, in models.User) (u models.User, err error) {
+	defer func(start time.Time) { s.observe("restore_user", start, err, "user", in) }(time.Now())
+	return s.Storage.RestoreUser(ctx, in)
+}
+
+func (s *instrumented) DeleteUsers(ctx context.Context, f Filter, dryRun bool) (ids []string, err error) {
+	defer func(start time.Time) {
+		s.observe("delete_users", start, err, "filter", f, "dry_run", dryRun, "rows", len(ids))
+	}(time.Now())
+	return s.Storage.DeleteUsers(ctx, f, dryRun)
+}
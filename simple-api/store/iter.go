@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// Iterator streams results one at a time instead of building a slice, so an
+// export of a big table doesn't hold the whole table in memory:
+//
+//	it, err := st.ListUsersIter(ctx, f)
+//	if err != nil { ... }
+//	defer it.Close()
+//	for it.Next() {
+//		u := it.Value()
+//	}
+//	if err := it.Err(); err != nil { ... }
+//
+// iterators stop at the first row after ctx is done, with ctx's error in Err:
+// a client that hangs up on an export doesn't leave the table being read.
+type Iterator[T any] interface {
+	Next() bool
+	Value() T
+	Err() error
+	Close() error
+}
+
+// memory: the matching ids are snapshotted up front (in ListUsers order) and
+// each user is looked up as the caller gets to it. users deleted in the
+// meantime are skipped; updates show up with their latest version.
+
+type memoryIter struct {
+	ctx context.Context
+	m   *Memory
+	f   Filter
+	ids []string
+	cur models.User
+	err error
+}
+
+func (m *Memory) ListUsersIter(ctx context.Context, f Filter) (Iterator[models.User], error) {
+	users, _ := m.ListUsers(ctx, f)
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return &memoryIter{ctx: ctx, m: m, f: f, ids: ids}, nil
+}
+
+func (it *memoryIter) Next() bool {
+	for len(it.ids) > 0 {
+		if it.err = it.ctx.Err(); it.err != nil {
+			return false
+		}
+		id := it.ids[0]
+		it.ids = it.ids[1:]
+
+		it.m.mu.RLock()
+		u, ok := it.m.users[id]
+		it.m.mu.RUnlock()
+		if ok && it.f.Match(u) {
+			it.cur = u
+			return true
+		}
+	}
+	return false
+}
+
+func (it *memoryIter) Value() models.User { return it.cur }
+func (it *memoryIter) Err() error         { return it.err }
+func (it *memoryIter) Close() error       { it.ids = nil; return nil }
+
+// postgres: a thin wrapper over sql.Rows, which the driver already streams
+// (and cancels the query for, when the context is done).
+
+type rowsIter struct {
+	rows *sql.Rows
+	cur  models.User
+	err  error
+}
+
+func (it *rowsIter) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+	it.cur, it.err = scanUser(it.rows)
+	return it.err == nil
+}
+
+func (it *rowsIter) Value() models.User { return it.cur }
+
+func (it *rowsIter) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+func (it *rowsIter) Close() error { return it.rows.Close() }
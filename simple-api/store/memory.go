@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// Memory is the default dev/demo backend. safe for concurrent use, gone on restart.
+type Memory struct {
+	mu    sync.RWMutex
+	users map[string]models.User
+
+	// secondary indexes: email -> id (it's the unique constraint, so it has to
+	// change in the same critical section as users) and legacy int id -> id
+	byEmail  map[string]string
+	byLegacy map[int64]string
+
+	// rev counts mutations, savedRev is the rev last written by SaveSnapshot
+	rev, savedRev uint64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:    map[string]models.User{},
+		byEmail:  map[string]string{},
+		byLegacy: map[int64]string{},
+	}
+}
+
+// resolve maps either id format to the ULID key. callers hold mu.
+func (m *Memory) resolve(id string) (string, bool) {
+	if legacy, ok := ids.Legacy(id); ok {
+		id, ok := m.byLegacy[legacy]
+		return id, ok
+	}
+	id = ids.Canonical(id)
+	_, ok := m.users[id]
+	return id, ok
+}
+
+func (m *Memory) ListUsers(ctx context.Context, f Filter) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]models.User, 0, len(m.users))
+	for _, u := range m.users {
+		if f.Match(u) {
+			out = append(out, u)
+		}
+	}
+	f.sortUsers(out) // by id = by creation time, unless f.Sort
+	return out, nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, id string) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.resolve(id)
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return m.users[id], nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.byEmail[email]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return m.users[id], nil
+}
+
+// CreateUser always assigns a new ULID. a non-zero LegacyID is kept, which is
+// how records from the integer-id days get imported.
+func (m *Memory) CreateUser(ctx context.Context, u models.User) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id, ok := m.byEmail[u.Email]; ok {
+		return models.User{}, &DuplicateError{Field: "email", ExistingID: id}
+	}
+	if id, ok := m.byLegacy[u.LegacyID]; ok && u.LegacyID != 0 {
+		return models.User{}, &DuplicateError{Field: "legacy_id", ExistingID: id}
+	}
+	u.ID = ids.New()
+	u.PrepareCreate(time.Now())
+	m.rev++
+	m.users[u.ID] = u
+	m.byEmail[u.Email] = u.ID
+	if u.LegacyID != 0 {
+		m.byLegacy[u.LegacyID] = u.ID
+	}
+	return u, nil
+}
+
+func (m *Memory) RestoreUser(ctx context.Context, u models.User) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id, ok := m.byEmail[u.Email]; ok {
+		return models.User{}, &DuplicateError{Field: "email", ExistingID: id}
+	}
+	if _, ok := m.users[u.ID]; ok {
+		return models.User{}, &DuplicateError{Field: "id", ExistingID: u.ID}
+	}
+	if id, ok := m.byLegacy[u.LegacyID]; ok && u.LegacyID != 0 {
+		return models.User{}, &DuplicateError{Field: "legacy_id", ExistingID: id}
+	}
+	u.Compute()
+	m.rev++
+	m.users[u.ID] = u
+	m.byEmail[u.Email] = u.ID
+	if u.LegacyID != 0 {
+		m.byLegacy[u.LegacyID] = u.ID
+	}
+	return u, nil
+}
+
+// UpdateUser accepts either id format in u.ID; both ids are kept from the stored record.
+func (m *Memory) UpdateUser(ctx context.Context, u models.User) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.resolve(u.ID)
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	old := m.users[id]
+	u.ID, u.LegacyID = old.ID, old.LegacyID
+	u.PrepareUpdate(old, time.Now())
+
+	if owner, ok := m.byEmail[u.Email]; ok && owner != u.ID {
+		return models.User{}, &DuplicateError{Field: "email", ExistingID: owner}
+	}
+	m.rev++
+	delete(m.byEmail, old.Email)
+	m.users[u.ID] = u
+	m.byEmail[u.Email] = u.ID
+	return u, nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.resolve(id)
+	if !ok {
+		return ErrNotFound
+	}
+	m.drop(id)
+	return nil
+}
+
+func (m *Memory) DeleteUsers(ctx context.Context, f Filter, dryRun bool) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []string
+	for id, u := range m.users {
+		if f.Match(u) {
+			matched = append(matched, id)
+		}
+	}
+	sort.Strings(matched)
+	if !dryRun {
+		for _, id := range matched {
+			m.drop(id)
+		}
+	}
+	return matched, nil
+}
+
+// drop removes id from the table and every index. callers hold mu.
+func (m *Memory) drop(id string) {
+	u := m.users[id]
+	m.rev++
+	delete(m.users, id)
+	delete(m.byEmail, u.Email)
+	delete(m.byLegacy, u.LegacyID)
+}
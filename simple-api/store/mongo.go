@@ -0,0 +1,468 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"golang.org/x/text/language"
+)
+
+// Mongo stores users in one collection, with the ULID as _id. every call is
+// bounded by timeout on top of the caller's context, so a stuck cluster
+// turns into an error instead of a pile of hung requests.
+type Mongo struct {
+	users     *mongo.Collection
+	revisions *mongo.Collection // see AppendRevision
+	timeout   time.Duration
+}
+
+type mongoUser struct {
+	ID        string    `bson:"_id"`
+	LegacyID  int64     `bson:"legacy_id,omitempty"`
+	Name      string    `bson:"name"`
+	Email     string    `bson:"email"`
+	Role      string    `bson:"role"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func toMongo(u models.User) mongoUser {
+	return mongoUser{u.ID, u.LegacyID, u.Name, u.Email, u.Role, u.CreatedAt, u.UpdatedAt}
+}
+
+func (d mongoUser) user() models.User {
+	u := models.User{
+		ID: d.ID, LegacyID: d.LegacyID, Name: d.Name, Email: d.Email, Role: d.Role,
+		CreatedAt: d.CreatedAt.UTC(), UpdatedAt: d.UpdatedAt.UTC(),
+	}
+	u.Compute()
+	return u
+}
+
+const (
+	mongoEmailIndex    = "email_unique"
+	mongoRevisionIndex = "user_rev_unique"
+)
+
+// NewMongo uses the users collection of db and makes sure its indexes exist:
+// unique email (the Storage contract), unique legacy_id where set, and the
+// sort fields paired with _id so sorted listings page off an index.
+func NewMongo(ctx context.Context, db *mongo.Database, timeout time.Duration) (*Mongo, error) {
+	m := &Mongo{users: db.Collection("users"), revisions: db.Collection("revisions"), timeout: timeout}
+	ctx, cancel := m.ctx(ctx)
+	defer cancel()
+
+	_, err := m.users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName(mongoEmailIndex).SetUnique(true)},
+		{
+			Keys: bson.D{{Key: "legacy_id", Value: 1}},
+			Options: options.Index().SetName("legacy_id_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.D{{Key: "legacy_id", Value: bson.D{{Key: "$gt", Value: 0}}}}),
+		},
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("name_id")},
+		{Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("created_id")},
+		{Keys: bson.D{{Key: "updated_at", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("updated_id")},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mongo indexes: %w", err)
+	}
+	_, err = m.revisions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "rev", Value: 1}}, Options: options.Index().SetName(mongoRevisionIndex).SetUnique(true)},
+		{Keys: bson.D{{Key: "at", Value: 1}}, Options: options.Index().SetName("at")},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mongo revision indexes: %w", err)
+	}
+	return m, nil
+}
+
+// CheckMongoSchema reports whether NewMongo has set up db's indexes, without
+// creating them (the unique ones are what keeps the Storage contract).
+func CheckMongoSchema(ctx context.Context, db *mongo.Database) error {
+	var missing []string
+	for coll, names := range map[string][]string{
+		"users":     {mongoEmailIndex, "legacy_id_unique", "name_id", "created_id", "updated_id"},
+		"revisions": {mongoRevisionIndex, "at"},
+	} {
+		specs, err := db.Collection(coll).Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return err
+		}
+		have := map[string]bool{}
+		for _, s := range specs {
+			have[s.Name] = true
+		}
+		for _, name := range names {
+			if !have[name] {
+				missing = append(missing, coll+"."+name)
+			}
+		}
+	}
+	slices.Sort(missing)
+	if len(missing) > 0 {
+		return fmt.Errorf("indexes missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (m *Mongo) ctx(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, m.timeout)
+}
+
+// idFilter matches either id format.
+func idFilter(id string) bson.D {
+	if legacy, ok := ids.Legacy(id); ok {
+		return bson.D{{Key: "legacy_id", Value: legacy}}
+	}
+	return bson.D{{Key: "_id", Value: ids.Canonical(id)}}
+}
+
+// mongoFilter translates f with the same semantics as Filter.Match: the
+// case-insensitive ops become anchored, quoted regexes.
+func mongoFilter(f Filter) bson.D {
+	if f.Empty() {
+		return bson.D{}
+	}
+	and := bson.A{}
+	for _, c := range f.Conds {
+		field := c.Field
+		var val any = c.Value
+		switch c.Field {
+		case "id":
+			field = "_id"
+			if legacy, ok := ids.Legacy(c.Value); ok {
+				field, val = "legacy_id", legacy
+			}
+		}
+		quoted := regexp.QuoteMeta(c.Value)
+		var cond any
+		switch c.Op {
+		case "eq":
+			cond = val
+		case "ne":
+			cond = bson.D{{Key: "$ne", Value: val}}
+		case "contains":
+			cond = bson.Regex{Pattern: quoted, Options: "i"}
+		case "prefix":
+			cond = bson.Regex{Pattern: "^" + quoted, Options: "i"}
+		case "suffix":
+			cond = bson.Regex{Pattern: quoted + "$", Options: "i"}
+		}
+		and = append(and, bson.D{{Key: field, Value: cond}})
+	}
+	// $and rather than one document: two conds on the same field must both hold
+	return bson.D{{Key: "$and", Value: and}}
+}
+
+// mongoSort is f.Sort, ending on _id like every other backend.
+func mongoSort(f Filter) bson.D {
+	var d bson.D
+	for _, k := range f.Sort {
+		field := k.Field
+		if field == "id" {
+			field = "_id"
+		}
+		dir := 1
+		if k.Desc {
+			dir = -1
+		}
+		d = append(d, bson.E{Key: field, Value: dir})
+		if field == "_id" {
+			return d
+		}
+	}
+	return append(d, bson.E{Key: "_id", Value: 1})
+}
+
+// find applies f.Collation to the whole query (mongo has no per-key
+// collation). that's harmless for the filter: regexes ignore collation and
+// eq/ne compare at the default tertiary strength, which still tells case and
+// accents apart.
+func (m *Mongo) find(ctx context.Context, f Filter) (*mongo.Cursor, error) {
+	opts := options.Find().SetSort(mongoSort(f))
+	if f.Collation != "" {
+		base, _ := language.Make(f.Collation).Base()
+		locale := base.String()
+		if locale == "und" {
+			locale = "en" // mongo has no root locale; english uses the root rules
+		}
+		opts.SetCollation(&options.Collation{Locale: locale})
+	}
+	return m.users.Find(ctx, mongoFilter(f), opts)
+}
+
+func (m *Mongo) ListUsers(ctx context.Context, f Filter) ([]models.User, error) {
+	ctx, cancel := m.ctx(ctx)
+	defer cancel()
+	cur, err := m.find(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []models.User{}
+	for cur.Next(ctx) {
+		var d mongoUser
+		if err := cur.Decode(&d); err != nil {
+			return nil, err
+		}
+		out = append(out, d.user())
+	}
+	return out, cur.Err()
+}
+
+// ListUsersIter streams from a cursor. the per-call timeout doesn't apply -
+// an export legitimately takes a while - only the caller's context does.
+func (m *Mongo) ListUsersIter(ctx context.Context, f Filter) (Iterator[models.User], error) {
+	cur, err := m.find(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoIter{ctx: ctx, cur: cur}, nil
+}
+
+func (m *Mongo) getOne(ctx context.Context, filter bson.D) (models.User, error) {
+	ctx, cancel := m.ctx(ctx)
+	defer cancel()
+	var d mongoUser
+	if err := m.users.FindOne(ctx, filter).Decode(&d); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.User{}, ErrNotFound
+		}
+		return models.User{}, err
+	}
+	return d.user(), nil
+}
+
+func (m *Mongo) GetUser(ctx context.Context, id string) (models.User, error) {
+	return m.getOne(ctx, idFilter(id))
+}
+
+func (m *Mongo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return m.getOne(ctx, bson.D{{Key: "email", Value: email}})
+}
+
+func (m *Mongo) CreateUser(ctx context.Context, u models.User) (models.User, error) {
+	u.ID = ids.New()
+	u.PrepareCreate(time.Now())
+
+	cctx, cancel := m.ctx(ctx)
+	defer cancel()
+	if _, err := m.users.InsertOne(cctx, toMongo(u)); err != nil {
+		return models.User{}, m.writeError(ctx, err, u)
+	}
+	return u, nil
+}
+
+func (m *Mongo) RestoreUser(ctx context.Context, u models.User) (models.User, error) {
+	cctx, cancel := m.ctx(ctx)
+	defer cancel()
+	if _, err := m.users.InsertOne(cctx, toMongo(u)); err != nil {
+		return models.User{}, m.writeError(ctx, err, u)
+	}
+	u.Compute()
+	return u, nil
+}
+
+func (m *Mongo) UpdateUser(ctx context.Context, u models.User) (models.User, error) {
+	old, err := m.GetUser(ctx, u.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+	u.ID, u.LegacyID = old.ID, old.LegacyID
+	u.PrepareUpdate(old, time.Now())
+
+	cctx, cancel := m.ctx(ctx)
+	defer cancel()
+	res, err := m.users.ReplaceOne(cctx, bson.D{{Key: "_id", Value: u.ID}}, toMongo(u))
+	if err != nil {
+		return models.User{}, m.writeError(ctx, err, u)
+	}
+	if res.MatchedCount == 0 {
+		return models.User{}, ErrNotFound // deleted between the read and the write
+	}
+	return u, nil
+}
+
+func (m *Mongo) DeleteUser(ctx context.Context, id string) error {
+	ctx, cancel := m.ctx(ctx)
+	defer cancel()
+	res, err := m.users.DeleteOne(ctx, idFilter(id))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteUsers collects the matching ids first and deletes exactly those, so
+// the ids returned are the ones removed even if matching docs appear meanwhile.
+func (m *Mongo) DeleteUsers(ctx context.Context, f Filter, dryRun bool) ([]string, error) {
+	ctx, cancel := m.ctx(ctx)
+	defer cancel()
+
+	cur, err := m.users.Find(ctx, mongoFilter(f),
+		options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}).SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	matched := make([]string, len(docs))
+	for i, d := range docs {
+		matched[i] = d.ID
+	}
+	if dryRun || len(matched) == 0 {
+		return matched, nil
+	}
+	if _, err := m.users.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: matched}}}}); err != nil {
+		return nil, err
+	}
+	return matched, nil
+}
+
+// mongoRevision is a revision document. latest marks a user's newest one,
+// which PruneRevisions keeps however old it is (unless it's a delete).
+type mongoRevision struct {
+	UserID string    `bson:"user_id"`
+	Rev    int       `bson:"rev"`
+	Op     string    `bson:"op"`
+	At     time.Time `bson:"at"`
+	User   mongoUser `bson:"user"`
+	Latest bool      `bson:"latest"`
+}
+
+// AppendRevision numbers the revision one past the user's newest; two
+// replicas racing for the number collide on the unique index, and the loser
+// retries.
+func (m *Mongo) AppendRevision(ctx context.Context, op string, u models.User, keep int) (Revision, error) {
+	ctx, cancel := m.ctx(ctx)
+	defer cancel()
+	doc := mongoRevision{UserID: u.ID, Op: op, At: time.Now().UTC(), User: toMongo(u), Latest: true}
+	for attempt := 1; ; attempt++ {
+		var newest mongoRevision
+		err := m.revisions.FindOne(ctx, bson.D{{Key: "user_id", Value: u.ID}},
+			options.FindOne().SetSort(bson.D{{Key: "rev", Value: -1}})).Decode(&newest)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return Revision{}, fmt.Errorf("revision of %s: %w", u.ID, err)
+		}
+		doc.Rev = newest.Rev + 1
+		if _, err = m.revisions.InsertOne(ctx, doc); err == nil {
+			break
+		}
+		if attempt == 3 || !mongo.IsDuplicateKeyError(err) {
+			return Revision{}, fmt.Errorf("revision of %s: %w", u.ID, err)
+		}
+	}
+	rev := Revision{Rev: doc.Rev, Op: op, At: doc.At, User: u}
+	older := bson.D{{Key: "user_id", Value: u.ID}, {Key: "rev", Value: bson.D{{Key: "$lt", Value: doc.Rev}}}}
+	if _, err := m.revisions.UpdateMany(ctx, older, bson.D{{Key: "$set", Value: bson.D{{Key: "latest", Value: false}}}}); err != nil {
+		return rev, fmt.Errorf("revisions of %s: %w", u.ID, err)
+	}
+	if doc.Rev > keep {
+		dropped := bson.D{{Key: "user_id", Value: u.ID}, {Key: "rev", Value: bson.D{{Key: "$lte", Value: doc.Rev - keep}}}}
+		if _, err := m.revisions.DeleteMany(ctx, dropped); err != nil {
+			return rev, fmt.Errorf("revisions of %s: %w", u.ID, err)
+		}
+	}
+	return rev, nil
+}
+
+func (m *Mongo) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	ctx, cancel := m.ctx(ctx)
+	defer cancel()
+	cur, err := m.revisions.Find(ctx, bson.D{{Key: "user_id", Value: id}}, options.Find().SetSort(bson.D{{Key: "rev", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var revs []Revision
+	for cur.Next(ctx) {
+		var d mongoRevision
+		if err := cur.Decode(&d); err != nil {
+			return nil, err
+		}
+		revs = append(revs, Revision{Rev: d.Rev, Op: d.Op, At: d.At.UTC(), User: d.User.user()})
+	}
+	return revs, cur.Err()
+}
+
+func (m *Mongo) PruneRevisions(ctx context.Context, cutoff time.Time) (int, error) {
+	ctx, cancel := m.ctx(ctx)
+	defer cancel()
+	res, err := m.revisions.DeleteMany(ctx, bson.D{
+		{Key: "at", Value: bson.D{{Key: "$lt", Value: cutoff}}},
+		{Key: "$or", Value: bson.A{bson.D{{Key: "latest", Value: false}}, bson.D{{Key: "op", Value: OpDeleted}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+// writeError turns duplicate key errors into the errors Storage promises.
+func (m *Mongo) writeError(ctx context.Context, err error, u models.User) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	// the driver only names the index in the message
+	field, lookup := "email", func() (models.User, error) { return m.GetUserByEmail(ctx, u.Email) }
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "legacy_id_unique"):
+		field, lookup = "legacy_id", func() (models.User, error) { return m.GetUser(ctx, strconv.FormatInt(u.LegacyID, 10)) }
+	case !strings.Contains(msg, mongoEmailIndex):
+		return &DuplicateError{Field: "id", ExistingID: u.ID} // _id, only a restore can hit it
+	}
+	owner, gerr := lookup()
+	if gerr != nil {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+	return &DuplicateError{Field: field, ExistingID: owner.ID}
+}
+
+type mongoIter struct {
+	ctx context.Context
+	cur *mongo.Cursor
+	val models.User
+	err error
+}
+
+func (it *mongoIter) Next() bool {
+	if it.err != nil || !it.cur.Next(it.ctx) {
+		return false
+	}
+	var d mongoUser
+	if it.err = it.cur.Decode(&d); it.err != nil {
+		return false
+	}
+	it.val = d.user()
+	return true
+}
+
+func (it *mongoIter) Value() models.User { return it.val }
+
+func (it *mongoIter) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.cur.Err()
+}
+
+func (it *mongoIter) Close() error { return it.cur.Close(context.Background()) }
@@ -0,0 +1,220 @@
+//go:build integration
+
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/iamskyy666/simple-api/store"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// run against a real server:
+//
+//	docker run -d -p 27017:27017 mongo:7
+//	MONGO_URL=mongodb://localhost:27017 go test -tags integration ./store
+//
+// every test gets its own throwaway database.
+
+func newMongo(t *testing.T) *store.Mongo {
+	t.Helper()
+	url := os.Getenv("MONGO_URL")
+	if url == "" {
+		t.Skip("MONGO_URL not set")
+	}
+	client, err := mongo.Connect(options.Client().ApplyURI(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("mongo at %s: %v", url, err)
+	}
+
+	db := client.Database(fmt.Sprintf("simple_api_test_%s", ids.New()))
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	m, err := store.NewMongo(ctx, db, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func mustCreate(t *testing.T, st store.Storage, name, email string, legacy int64) models.User {
+	t.Helper()
+	u, err := st.CreateUser(context.Background(), models.User{Name: name, Email: email, LegacyID: legacy})
+	if err != nil {
+		t.Fatalf("create %s: %v", email, err)
+	}
+	return u
+}
+
+func TestMongoCRUD(t *testing.T) {
+	m := newMongo(t)
+	ctx := context.Background()
+
+	u := mustCreate(t, m, "Ada", "ada@example.com", 0)
+	if !ids.IsULID(u.ID) || u.Role != models.DefaultRole || u.CreatedAt.IsZero() {
+		t.Fatalf("create didn't prepare the user: %+v", u)
+	}
+
+	got, err := m.GetUser(ctx, u.ID)
+	if err != nil || got.Email != u.Email || got.DisplayName != "Ada" {
+		t.Fatalf("get: %+v, %v", got, err)
+	}
+	if got, err := m.GetUserByEmail(ctx, "ada@example.com"); err != nil || got.ID != u.ID {
+		t.Fatalf("get by email: %+v, %v", got, err)
+	}
+
+	u.Name, u.Role = "Ada L.", models.RoleAdmin
+	upd, err := m.UpdateUser(ctx, u)
+	if err != nil || upd.Name != "Ada L." || !upd.CreatedAt.Equal(u.CreatedAt) || !upd.UpdatedAt.After(u.CreatedAt) {
+		t.Fatalf("update: %+v, %v", upd, err)
+	}
+
+	if err := m.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetUser(ctx, u.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("get after delete: %v", err)
+	}
+	if err := m.DeleteUser(ctx, u.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second delete: %v", err)
+	}
+}
+
+func TestMongoUniqueEmail(t *testing.T) {
+	m := newMongo(t)
+	ctx := context.Background()
+	a := mustCreate(t, m, "A", "a@example.com", 0)
+	b := mustCreate(t, m, "B", "b@example.com", 0)
+
+	var dup *store.DuplicateError
+	_, err := m.CreateUser(ctx, models.User{Name: "A2", Email: "a@example.com"})
+	if !errors.As(err, &dup) || dup.Field != "email" || dup.ExistingID != a.ID {
+		t.Fatalf("create duplicate: %v", err)
+	}
+	b.Email = "a@example.com"
+	if _, err := m.UpdateUser(ctx, b); !errors.As(err, &dup) || dup.ExistingID != a.ID {
+		t.Fatalf("update to a taken email: %v", err)
+	}
+}
+
+func TestMongoLegacyIDs(t *testing.T) {
+	m := newMongo(t)
+	ctx := context.Background()
+	u := mustCreate(t, m, "Old", "old@example.com", 42)
+	mustCreate(t, m, "New", "new@example.com", 0)
+	mustCreate(t, m, "Newer", "newer@example.com", 0) // two without legacy ids: the partial index allows it
+
+	if got, err := m.GetUser(ctx, "42"); err != nil || got.ID != u.ID {
+		t.Fatalf("get by legacy id: %+v, %v", got, err)
+	}
+	if _, err := m.CreateUser(ctx, models.User{Name: "Again", Email: "again@example.com", LegacyID: 42}); err == nil {
+		t.Fatal("imported legacy id 42 twice")
+	}
+}
+
+func TestMongoFilterAndSort(t *testing.T) {
+	m := newMongo(t)
+	ctx := context.Background()
+	mustCreate(t, m, "carol", "carol@example.com", 0)
+	mustCreate(t, m, "Alice", "alice@corp.test", 0)
+	mustCreate(t, m, "bob", "bob@example.com", 0)
+	mustCreate(t, m, "a.b", "dots@example.com", 0) // "." must not act as a regex wildcard
+
+	f, err := store.ParseFilter([]string{"email:suffix:@EXAMPLE.com", "name:ne:bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Sort, _ = store.ParseSort("-name")
+	users, err := m.ListUsers(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	if fmt.Sprint(names) != "[carol a.b]" {
+		t.Fatalf("got %v", names)
+	}
+
+	f, _ = store.ParseFilter([]string{"name:contains:a.b"})
+	if users, _ := m.ListUsers(ctx, f); len(users) != 1 {
+		t.Fatalf("contains a.b matched %d users", len(users))
+	}
+}
+
+func TestMongoDeleteUsers(t *testing.T) {
+	m := newMongo(t)
+	ctx := context.Background()
+	for i := range 5 {
+		mustCreate(t, m, fmt.Sprint("bot", i), fmt.Sprintf("bot%d@example.com", i), 0)
+	}
+	keep := mustCreate(t, m, "human", "human@example.com", 0)
+
+	f, _ := store.ParseFilter([]string{"name:prefix:bot"})
+	dry, err := m.DeleteUsers(ctx, f, true)
+	if err != nil || len(dry) != 5 {
+		t.Fatalf("dry run: %v, %v", dry, err)
+	}
+	if all, _ := m.ListUsers(ctx, store.Filter{}); len(all) != 6 {
+		t.Fatalf("dry run deleted something: %d left", len(all))
+	}
+
+	gone, err := m.DeleteUsers(ctx, f, false)
+	if err != nil || fmt.Sprint(gone) != fmt.Sprint(dry) {
+		t.Fatalf("delete: %v, %v (dry run said %v)", gone, err, dry)
+	}
+	all, _ := m.ListUsers(ctx, store.Filter{})
+	if len(all) != 1 || all[0].ID != keep.ID {
+		t.Fatalf("left: %+v", all)
+	}
+}
+
+func TestMongoIter(t *testing.T) {
+	m := newMongo(t)
+	ctx := context.Background()
+	var want []string
+	for i := range 50 {
+		want = append(want, mustCreate(t, m, fmt.Sprint("u", i), fmt.Sprintf("u%d@example.com", i), 0).ID)
+	}
+
+	it, err := m.ListUsersIter(ctx, store.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		got = append(got, it.Value().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatal("iterator order differs from creation order")
+	}
+}
+
+func TestMongoTimeout(t *testing.T) {
+	m := newMongo(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.ListUsers(ctx, store.Filter{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled context: %v", err)
+	}
+}
@@ -0,0 +1,394 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"github.com/iamskyy666/simple-api/models"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres stores users in a postgres table. writes go to the primary; reads
+// go to the replica if one is configured, except for contexts marked with
+// ReadFromPrimary (read-your-writes, see api's stickiness cookie).
+//
+// the driver is registered by main (pgx), this file speaks database/sql - only
+// writeError looks past it, for the name of a violated constraint.
+//
+// every query goes through a per-pool prepared statement cache; dynamic
+// where/order by clauses are built by sqlQuery, never by splicing values in.
+type Postgres struct {
+	primary *stmtCache
+	replica *stmtCache // == primary when there's no read dsn
+}
+
+// statements kept prepared per pool - far more than the filter/sort shapes
+// real clients send
+const pgStmtCacheSize = 256
+
+// NewPostgres wraps already opened pools. replica may be nil.
+func NewPostgres(primary, replica *sql.DB) *Postgres {
+	p := &Postgres{primary: newStmtCache(primary, pgStmtCacheSize)}
+	p.replica = p.primary
+	if replica != nil {
+		p.replica = newStmtCache(replica, pgStmtCacheSize)
+	}
+	return p
+}
+
+// Pools names the pools behind this store, for health reporting.
+func (p *Postgres) Pools() map[string]*sql.DB {
+	pools := map[string]*sql.DB{"primary": p.primary.db}
+	if p.replica != p.primary {
+		pools["replica"] = p.replica.db
+	}
+	return pools
+}
+
+// Close releases the cached statements; the pools belong to the caller.
+func (p *Postgres) Close() error {
+	p.replica.Close()
+	return p.primary.Close()
+}
+
+const pgSchema = `CREATE TABLE IF NOT EXISTS users (
+	id         text PRIMARY KEY,
+	legacy_id  bigint UNIQUE,
+	name       text NOT NULL,
+	email      text NOT NULL,
+	role       text NOT NULL,
+	created_at timestamptz NOT NULL,
+	updated_at timestamptz NOT NULL,
+	CONSTRAINT users_email_key UNIQUE (email)
+)`
+
+// the RevisionLog: a user's revisions by number, and by time for pruning
+var pgRevisionSchema = []string{
+	`CREATE TABLE IF NOT EXISTS user_revisions (
+	user_id text NOT NULL,
+	rev     integer NOT NULL,
+	op      text NOT NULL,
+	at      timestamptz NOT NULL,
+	body    jsonb NOT NULL,
+	PRIMARY KEY (user_id, rev)
+)`,
+	`CREATE INDEX IF NOT EXISTS user_revisions_at ON user_revisions (at)`,
+}
+
+// Migrate creates the schema if it isn't there yet. runs against the primary.
+func (p *Postgres) Migrate(ctx context.Context) error {
+	for _, stmt := range append([]string{pgSchema}, pgRevisionSchema...) {
+		if _, err := p.primary.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckSchema reports whether Migrate has run, without changing anything:
+// the users table's three unique constraints the code relies on by name, and
+// the revisions table.
+func (p *Postgres) CheckSchema(ctx context.Context) error {
+	rows, err := p.primary.db.QueryContext(ctx,
+		`SELECT conname FROM pg_constraint WHERE conrelid = to_regclass('users')`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	have := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		have[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var missing []string
+	for _, name := range []string{"users_pkey", "users_legacy_id_key", "users_email_key"} {
+		if !have[name] {
+			missing = append(missing, name)
+		}
+	}
+	var revisions bool
+	if err := p.primary.db.QueryRowContext(ctx, `SELECT to_regclass('user_revisions') IS NOT NULL`).Scan(&revisions); err != nil {
+		return err
+	}
+	if !revisions {
+		missing = append(missing, "user_revisions")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("schema not migrated: missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// reader picks the pool a read runs on.
+func (p *Postgres) reader(ctx context.Context) *stmtCache {
+	if readsFromPrimary(ctx) {
+		return p.primary
+	}
+	return p.replica
+}
+
+const pgColumns = "id, legacy_id, name, email, role, created_at, updated_at"
+
+type rowScanner interface{ Scan(dest ...any) error }
+
+func scanUser(row rowScanner) (models.User, error) {
+	var (
+		u      models.User
+		legacy sql.NullInt64
+	)
+	if err := row.Scan(&u.ID, &legacy, &u.Name, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, ErrNotFound
+		}
+		return models.User{}, err
+	}
+	u.LegacyID = legacy.Int64
+	u.CreatedAt, u.UpdatedAt = u.CreatedAt.UTC(), u.UpdatedAt.UTC()
+	u.Compute()
+	return u, nil
+}
+
+// idCond matches either id format.
+func idCond(id string) (string, any) {
+	if legacy, ok := ids.Legacy(id); ok {
+		return "legacy_id = $1", legacy
+	}
+	return "id = $1", ids.Canonical(id)
+}
+
+func listQuery(f Filter) *sqlQuery {
+	return newQuery("SELECT " + pgColumns + " FROM users").where(f).orderBy(f)
+}
+
+func (p *Postgres) ListUsers(ctx context.Context, f Filter) ([]models.User, error) {
+	q := listQuery(f)
+	rows, err := p.reader(ctx).QueryContext(ctx, q.String(), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (p *Postgres) ListUsersIter(ctx context.Context, f Filter) (Iterator[models.User], error) {
+	q := listQuery(f)
+	rows, err := p.reader(ctx).QueryContext(ctx, q.String(), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	return &rowsIter{rows: rows}, nil
+}
+
+func (p *Postgres) GetUser(ctx context.Context, id string) (models.User, error) {
+	cond, arg := idCond(id)
+	return scanUser(p.reader(ctx).QueryRowContext(ctx, "SELECT "+pgColumns+" FROM users WHERE "+cond, arg))
+}
+
+func (p *Postgres) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return scanUser(p.reader(ctx).QueryRowContext(ctx, "SELECT "+pgColumns+" FROM users WHERE email = $1", email))
+}
+
+func (p *Postgres) CreateUser(ctx context.Context, u models.User) (models.User, error) {
+	u.ID = ids.New()
+	u.PrepareCreate(time.Now())
+	_, err := p.primary.ExecContext(ctx,
+		"INSERT INTO users ("+pgColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		u.ID, nullLegacy(u.LegacyID), u.Name, u.Email, u.Role, u.CreatedAt, u.UpdatedAt)
+	if err != nil {
+		return models.User{}, p.writeError(ctx, err, u)
+	}
+	return u, nil
+}
+
+func (p *Postgres) RestoreUser(ctx context.Context, u models.User) (models.User, error) {
+	_, err := p.primary.ExecContext(ctx,
+		"INSERT INTO users ("+pgColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		u.ID, nullLegacy(u.LegacyID), u.Name, u.Email, u.Role, u.CreatedAt, u.UpdatedAt)
+	if err != nil {
+		return models.User{}, p.writeError(ctx, err, u)
+	}
+	u.Compute()
+	return u, nil
+}
+
+func (p *Postgres) UpdateUser(ctx context.Context, u models.User) (models.User, error) {
+	tx, err := p.primary.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	cond, arg := idCond(u.ID)
+	sel := "SELECT " + pgColumns + " FROM users WHERE " + cond + " FOR UPDATE"
+	var row *sql.Row
+	if st := p.primary.inTx(ctx, tx, sel); st != nil {
+		row = st.QueryRowContext(ctx, arg)
+	} else {
+		row = tx.QueryRowContext(ctx, sel, arg)
+	}
+	old, err := scanUser(row)
+	if err != nil {
+		return models.User{}, err
+	}
+	u.ID, u.LegacyID = old.ID, old.LegacyID
+	u.PrepareUpdate(old, time.Now())
+
+	const upd = "UPDATE users SET name = $2, email = $3, role = $4, updated_at = $5 WHERE id = $1"
+	args := []any{u.ID, u.Name, u.Email, u.Role, u.UpdatedAt}
+	if st := p.primary.inTx(ctx, tx, upd); st != nil {
+		_, err = st.ExecContext(ctx, args...)
+	} else {
+		_, err = tx.ExecContext(ctx, upd, args...)
+	}
+	if err != nil {
+		return models.User{}, p.writeError(ctx, err, u)
+	}
+	return u, tx.Commit()
+}
+
+func (p *Postgres) DeleteUser(ctx context.Context, id string) error {
+	cond, arg := idCond(id)
+	res, err := p.primary.ExecContext(ctx, "DELETE FROM users WHERE "+cond, arg)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteUsers(ctx context.Context, f Filter, dryRun bool) ([]string, error) {
+	q := newQuery("DELETE FROM users").where(f).raw(" RETURNING id")
+	if dryRun {
+		// on the primary too: a dry run should report what a real run would do right now
+		q = newQuery("SELECT id FROM users").where(f)
+	}
+	rows, err := p.primary.QueryContext(ctx, q.String(), q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matched []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		matched = append(matched, id)
+	}
+	sort.Strings(matched)
+	return matched, rows.Err()
+}
+
+// pgAppendRevision numbers the revision in the insert; two replicas racing
+// for a user's next number collide on the primary key, and the loser retries.
+const pgAppendRevision = `INSERT INTO user_revisions (user_id, rev, op, at, body)
+SELECT $1, COALESCE(MAX(rev), 0) + 1, $2, $3, $4 FROM user_revisions WHERE user_id = $1
+RETURNING rev`
+
+func (p *Postgres) AppendRevision(ctx context.Context, op string, u models.User, keep int) (Revision, error) {
+	body, err := json.Marshal(u)
+	if err != nil {
+		return Revision{}, err
+	}
+	rev := Revision{Op: op, At: time.Now().UTC(), User: u}
+	for attempt := 1; ; attempt++ {
+		err = p.primary.QueryRowContext(ctx, pgAppendRevision, u.ID, op, rev.At, string(body)).Scan(&rev.Rev)
+		var pgErr *pgconn.PgError
+		if err == nil || attempt == 3 || !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+			break
+		}
+	}
+	if err != nil {
+		return Revision{}, fmt.Errorf("revision of %s: %w", u.ID, err)
+	}
+	if rev.Rev > keep {
+		if _, err := p.primary.ExecContext(ctx, "DELETE FROM user_revisions WHERE user_id = $1 AND rev <= $2", u.ID, rev.Rev-keep); err != nil {
+			return rev, fmt.Errorf("revisions of %s: %w", u.ID, err)
+		}
+	}
+	return rev, nil
+}
+
+func (p *Postgres) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	rows, err := p.reader(ctx).QueryContext(ctx, "SELECT rev, op, at, body FROM user_revisions WHERE user_id = $1 ORDER BY rev", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revs []Revision
+	for rows.Next() {
+		var (
+			rev  Revision
+			body []byte
+		)
+		if err := rows.Scan(&rev.Rev, &rev.Op, &rev.At, &body); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(body, &rev.User); err != nil {
+			return nil, fmt.Errorf("revision %d of %s: %w", rev.Rev, id, err)
+		}
+		rev.At = rev.At.UTC()
+		rev.User.Compute()
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
+
+const pgPruneRevisions = `DELETE FROM user_revisions r WHERE r.at < $1 AND (r.op = $2
+	OR EXISTS (SELECT 1 FROM user_revisions n WHERE n.user_id = r.user_id AND n.rev > r.rev))`
+
+func (p *Postgres) PruneRevisions(ctx context.Context, cutoff time.Time) (int, error) {
+	res, err := p.primary.ExecContext(ctx, pgPruneRevisions, cutoff, OpDeleted)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// writeError turns unique violations into the errors Storage promises.
+func (p *Postgres) writeError(ctx context.Context, err error, u models.User) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	field, query, arg := "email", "SELECT id FROM users WHERE email = $1", any(u.Email)
+	switch pgErr.ConstraintName {
+	case "users_pkey":
+		return &DuplicateError{Field: "id", ExistingID: u.ID} // only a restore can hit it
+	case "users_legacy_id_key":
+		field, query, arg = "legacy_id", "SELECT id FROM users WHERE legacy_id = $1", u.LegacyID
+	}
+	var owner string
+	if qerr := p.primary.QueryRowContext(ctx, query, arg).Scan(&owner); qerr != nil {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+	return &DuplicateError{Field: field, ExistingID: owner}
+}
+
+func nullLegacy(id int64) sql.NullInt64 { return sql.NullInt64{Int64: id, Valid: id != 0} }
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// OpRestored is a revision written by RestoreUser (the feed calls it a create).
+const OpRestored = "restored"
+
+// Revision is a user as it was after one change; for a delete, as it was
+// when it went.
+type Revision struct {
+	Rev  int         `json:"rev"` // 1, 2, ... per user, never reused
+	Op   string      `json:"op"`
+	At   time.Time   `json:"at"`
+	User models.User `json:"user"`
+}
+
+// RevisionLog is where revisions are kept. the backends that persist users
+// keep their revisions next to them - Bolt in a bucket, Postgres in a table,
+// Mongo in a collection - so history survives restarts and every replica
+// numbers it the same. Memory's users live in the process, and so does its
+// log (Revisions).
+type RevisionLog interface {
+	// AppendRevision records u as it is after op, numbered after u's newest
+	// revision, and drops all but u's newest keep.
+	AppendRevision(ctx context.Context, op string, u models.User, keep int) (Revision, error)
+	// Revisions returns what's kept for id (a ulid), oldest first.
+	Revisions(ctx context.Context, id string) ([]Revision, error)
+	// PruneRevisions drops the revisions from before cutoff and returns how
+	// many went. a live user's newest one stays, so its numbers carry on.
+	PruneRevisions(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// Revisions is a RevisionLog in memory, for the memory backend.
+type Revisions struct {
+	mu sync.Mutex
+	m  map[string][]Revision // ulid -> oldest first
+}
+
+func NewRevisions() *Revisions {
+	return &Revisions{m: map[string][]Revision{}}
+}
+
+func (r *Revisions) AppendRevision(ctx context.Context, op string, u models.User, keep int) (Revision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	revs := r.m[u.ID]
+	next := 1
+	if len(revs) > 0 {
+		next = revs[len(revs)-1].Rev + 1
+	}
+	rev := Revision{Rev: next, Op: op, At: time.Now().UTC(), User: u}
+	revs = append(revs, rev)
+	if len(revs) > keep {
+		revs = slices.Clone(revs[len(revs)-keep:]) // let the dropped ones go
+	}
+	r.m[u.ID] = revs
+	return rev, nil
+}
+
+func (r *Revisions) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.m[id]), nil
+}
+
+func (r *Revisions) PruneRevisions(ctx context.Context, cutoff time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for id, revs := range r.m {
+		kept := slices.DeleteFunc(slices.Clone(revs), func(rev Revision) bool {
+			return rev.At.Before(cutoff) && !keepNewest(rev, revs[len(revs)-1])
+		})
+		n += len(revs) - len(kept)
+		if len(kept) == 0 {
+			delete(r.m, id)
+		} else {
+			r.m[id] = kept
+		}
+	}
+	return n, nil
+}
+
+// keepNewest says whether pruning must spare rev, newest being its user's
+// newest revision: the one that numbers the next, unless the user is gone.
+func keepNewest(rev, newest Revision) bool {
+	return rev.Rev == newest.Rev && newest.Op != OpDeleted
+}
+
+// WithRevisions records every successful mutation on st into log, keeping
+// the newest keep of each user. a delete keeps only the last state: once a
+// user is gone its history goes too, bar what it was when it went.
+func WithRevisions(st Storage, log RevisionLog, keep int) Storage {
+	return &revisionStore{Storage: st, log: log, keep: keep}
+}
+
+type revisionStore struct {
+	Storage
+	log  RevisionLog
+	keep int
+}
+
+// record logs op on u. the write it follows has happened, so a failure here
+// is logged rather than failing it.
+func (s *revisionStore) record(ctx context.Context, op string, u models.User) {
+	keep := s.keep
+	if op == OpDeleted {
+		keep = 1
+	}
+	if _, err := s.log.AppendRevision(context.WithoutCancel(ctx), op, u, keep); err != nil {
+		slog.Error("store: recording revision failed", "user", u.ID, "op", op, "err", err)
+	}
+}
+
+func (s *revisionStore) CreateUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.CreateUser(ctx, u)
+	if err == nil {
+		s.record(ctx, OpCreated, u)
+	}
+	return u, err
+}
+
+func (s *revisionStore) UpdateUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.UpdateUser(ctx, u)
+	if err == nil {
+		s.record(ctx, OpUpdated, u)
+	}
+	return u, err
+}
+
+func (s *revisionStore) RestoreUser(ctx context.Context, u models.User) (models.User, error) {
+	u, err := s.Storage.RestoreUser(ctx, u)
+	if err == nil {
+		s.record(ctx, OpRestored, u)
+	}
+	return u, err
+}
+
+func (s *revisionStore) DeleteUser(ctx context.Context, id string) error {
+	u, err := s.Storage.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = s.Storage.DeleteUser(ctx, u.ID)
+	if err == nil {
+		s.record(ctx, OpDeleted, u)
+	}
+	return err
+}
+
+// DeleteUsers reads the matching users first so their last state makes it
+// into the history; one that only starts matching in between is removed
+// without a final revision.
+func (s *revisionStore) DeleteUsers(ctx context.Context, f Filter, dryRun bool) ([]string, error) {
+	if dryRun {
+		return s.Storage.DeleteUsers(ctx, f, dryRun)
+	}
+	before, err := s.Storage.ListUsers(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.Storage.DeleteUsers(ctx, f, dryRun)
+	if err != nil {
+		return ids, err
+	}
+	gone := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		gone[id] = true
+	}
+	for _, u := range before {
+		if gone[u.ID] {
+			s.record(ctx, OpDeleted, u)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,21 @@
+package store
+
+import (
+	"context"
+
+	"github.com/iamskyy666/simple-api/reqctx"
+)
+
+var primaryKey = reqctx.NewKey[bool]("read from primary")
+
+// ReadFromPrimary marks ctx so backends with read replicas serve its reads
+// from the primary - for a client that just wrote and must see its own write
+// before replication catches up. backends without replicas ignore it.
+func ReadFromPrimary(ctx context.Context) context.Context {
+	return primaryKey.Set(ctx, true)
+}
+
+func readsFromPrimary(ctx context.Context) bool {
+	v, _ := primaryKey.Get(ctx)
+	return v
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// snapshots let the memory backend survive restarts in dev/demo mode: the
+// whole table goes to a json file (periodically and on shutdown, see main)
+// and is read back on start. it's a convenience, not durability - whatever
+// changed since the last snapshot is lost on a crash.
+
+const snapshotFormat = 1
+
+type snapshot struct {
+	Format  int           `json:"format"`
+	SavedAt time.Time     `json:"saved_at"`
+	Users   []models.User `json:"users"`
+}
+
+// SaveSnapshot writes the table to path atomically (temp file + rename), so a
+// crash mid-write leaves the previous snapshot intact. it's skipped when
+// nothing changed since the last save.
+func (m *Memory) SaveSnapshot(ctx context.Context, path string) error {
+	m.mu.RLock()
+	rev := m.rev
+	if rev == m.savedRev {
+		m.mu.RUnlock()
+		return nil
+	}
+	snap := snapshot{Format: snapshotFormat, SavedAt: time.Now().UTC(), Users: make([]models.User, 0, len(m.users))}
+	for _, u := range m.users {
+		snap.Users = append(snap.Users, u)
+	}
+	m.mu.RUnlock()
+	sort.Slice(snap.Users, func(i, j int) bool { return snap.Users[i].ID < snap.Users[j].ID })
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(snap); err != nil {
+		tmp.Close()
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+
+	m.mu.Lock()
+	m.savedRev = max(m.savedRev, rev)
+	m.mu.Unlock()
+	return nil
+}
+
+// LoadSnapshot replaces the table with the one saved at path. a missing file
+// is not an error (first start), it just loads nothing.
+func (m *Memory) LoadSnapshot(path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("snapshot: %w", err)
+	}
+	defer f.Close()
+
+	var snap snapshot
+	if err := json.NewDecoder(f).Decode(&snap); err != nil {
+		return 0, fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	if snap.Format != snapshotFormat {
+		return 0, fmt.Errorf("snapshot %s: unknown format %d", path, snap.Format)
+	}
+
+	users := make(map[string]models.User, len(snap.Users))
+	byEmail := make(map[string]string, len(snap.Users))
+	byLegacy := map[int64]string{}
+	for _, u := range snap.Users {
+		if _, dup := byEmail[u.Email]; dup {
+			return 0, fmt.Errorf("snapshot %s: email of user %s appears twice", path, u.ID)
+		}
+		u.Compute()
+		users[u.ID] = u
+		byEmail[u.Email] = u.ID
+		if u.LegacyID != 0 {
+			byLegacy[u.LegacyID] = u.ID
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users, m.byEmail, m.byLegacy = users, byEmail, byLegacy
+	m.rev++
+	m.savedRev = m.rev // what's in memory is what's on disk
+	return len(users), nil
+}
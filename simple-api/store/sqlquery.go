@@ -0,0 +1,109 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamskyy666/simple-api/ids"
+	"golang.org/x/text/language"
+)
+
+// sqlQuery builds parameterised sql for the dynamic parts (filters, sort).
+// values only ever go in through arg, so the text depends on the shape of a
+// Filter and never on its values - which is also what makes the text a good
+// key for the prepared statement cache.
+type sqlQuery struct {
+	sb   strings.Builder
+	args []any
+}
+
+func newQuery(sql string) *sqlQuery {
+	q := &sqlQuery{}
+	q.sb.WriteString(sql)
+	return q
+}
+
+func (q *sqlQuery) String() string { return q.sb.String() }
+func (q *sqlQuery) Args() []any    { return q.args }
+
+func (q *sqlQuery) raw(sql string) *sqlQuery {
+	q.sb.WriteString(sql)
+	return q
+}
+
+// arg binds v and returns its placeholder.
+func (q *sqlQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// where appends f's conditions, with the same semantics as Filter.Match.
+func (q *sqlQuery) where(f Filter) *sqlQuery {
+	for i, c := range f.Conds {
+		if i == 0 {
+			q.sb.WriteString(" WHERE ")
+		} else {
+			q.sb.WriteString(" AND ")
+		}
+		col := c.Field // validated by ParseFilter, safe as an identifier
+		var val any = c.Value
+		if c.Field == "id" {
+			// legacy ids keep working here too while clients migrate
+			if legacy, ok := ids.Legacy(c.Value); ok {
+				col, val = "legacy_id", legacy
+			}
+		}
+		switch c.Op {
+		case "eq":
+			q.sb.WriteString(col + " = " + q.arg(val))
+		case "ne":
+			q.sb.WriteString(col + " IS DISTINCT FROM " + q.arg(val))
+		case "contains":
+			q.sb.WriteString("lower(" + col + ") LIKE " + q.arg("%"+likeEscape(c.Value)+"%"))
+		case "prefix":
+			q.sb.WriteString("lower(" + col + ") LIKE " + q.arg(likeEscape(c.Value)+"%"))
+		case "suffix":
+			q.sb.WriteString("lower(" + col + ") LIKE " + q.arg("%"+likeEscape(c.Value)))
+		}
+	}
+	return q
+}
+
+// orderBy appends f.Sort, ending on id so the order is total. text columns
+// sort bytewise (COLLATE "C") to agree with Filter.Less, or for a name with
+// f.Collation by the matching ICU collation.
+func (q *sqlQuery) orderBy(f Filter) *sqlQuery {
+	q.sb.WriteString(" ORDER BY ")
+	for _, k := range f.Sort {
+		q.sb.WriteString(k.Field) // validated by ParseSort
+		switch {
+		case k.Field == "name" && f.Collation != "":
+			q.sb.WriteString(` COLLATE "` + icuCollation(f.Collation) + `"`)
+		case k.Field == "name" || k.Field == "email":
+			q.sb.WriteString(` COLLATE "C"`)
+		}
+		if k.Desc {
+			q.sb.WriteString(" DESC")
+		}
+		if k.Field == "id" {
+			return q // unique, nothing after it matters
+		}
+		q.sb.WriteString(", ")
+	}
+	q.sb.WriteString("id")
+	return q
+}
+
+// icuCollation names the collation postgres creates at initdb for a
+// language when built with ICU (the default for packaged builds): "de-x-icu",
+// or "und-x-icu" for the root order. only the base language is used - those
+// always exist, region variants don't.
+func icuCollation(tag string) string {
+	base, _ := language.Make(tag).Base()
+	return base.String() + "-x-icu"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likeEscape lower-cases v and escapes LIKE wildcards (backslash is the default escape).
+func likeEscape(v string) string { return likeEscaper.Replace(strings.ToLower(v)) }
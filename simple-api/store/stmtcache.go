@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// stmtCache keeps prepared statements by sql text for one pool. a *sql.Stmt is
+// prepared lazily on each connection it runs on and re-prepared if that
+// connection is replaced, so caching the Stmt is caching per connection.
+//
+// the text comes from constants or sqlQuery, so the set of keys is bounded by
+// the filter/sort shapes clients use; past max it stops preparing new ones
+// and runs them unprepared rather than evicting.
+type stmtCache struct {
+	db  *sql.DB
+	max int
+
+	mu sync.Mutex
+	m  map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB, max int) *stmtCache {
+	return &stmtCache{db: db, max: max, m: map[string]*sql.Stmt{}}
+}
+
+// stmt returns the cached statement for query, preparing it on first use.
+// nil (with no error) means the cache is full - run it unprepared.
+func (c *stmtCache) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	st, ok := c.m[query]
+	full := len(c.m) >= c.max
+	c.mu.Unlock()
+	if ok || full {
+		return st, nil
+	}
+
+	// prepared outside the lock, it's a round trip
+	st, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.m[query]; ok {
+		st.Close() // lost a race, keep the first one
+		return prev, nil
+	}
+	c.m[query] = st
+	return st, nil
+}
+
+func (c *stmtCache) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	st, err := c.stmt(ctx, query)
+	if err != nil || st == nil {
+		return c.db.QueryContext(ctx, query, args...)
+	}
+	return st.QueryContext(ctx, args...)
+}
+
+func (c *stmtCache) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	st, err := c.stmt(ctx, query)
+	if err != nil || st == nil {
+		return c.db.QueryRowContext(ctx, query, args...)
+	}
+	return st.QueryRowContext(ctx, args...)
+}
+
+func (c *stmtCache) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	st, err := c.stmt(ctx, query)
+	if err != nil || st == nil {
+		return c.db.ExecContext(ctx, query, args...)
+	}
+	return st.ExecContext(ctx, args...)
+}
+
+// inTx returns the cached statement bound to tx, or nil to run it unprepared.
+func (c *stmtCache) inTx(ctx context.Context, tx *sql.Tx, query string) *sql.Stmt {
+	st, err := c.stmt(ctx, query)
+	if err != nil || st == nil {
+		return nil
+	}
+	return tx.StmtContext(ctx, st)
+}
+
+func (c *stmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for q, st := range c.m {
+		st.Close()
+		delete(c.m, q)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Package store is the persistence boundary - handlers only ever talk to Storage.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/iamskyy666/simple-api/errs"
+	"github.com/iamskyy666/simple-api/models"
+)
+
+// the errors every backend returns, of errs.NotFound and errs.Conflict
+var (
+	ErrNotFound  = errs.New(errs.NotFound, "user not found")
+	ErrDuplicate = errs.New(errs.Conflict, "duplicate value")
+)
+
+// DuplicateError is returned when a write would break a unique constraint.
+// it carries the id of the record that already owns the value, and matches
+// ErrDuplicate (so errs.Conflict) with errors.Is.
+type DuplicateError struct {
+	Field      string // email, legacy_id, or id for a restore of a user that's back already
+	ExistingID string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s already in use by user %s", e.Field, e.ExistingID)
+}
+
+func (e *DuplicateError) Unwrap() error { return ErrDuplicate }
+
+// Storage implementations must keep emails unique (see DuplicateError).
+type Storage interface {
+	ListUsers(ctx context.Context, f Filter) ([]models.User, error)
+	// ListUsersIter is ListUsers for big results (exports): same order, streamed
+	ListUsersIter(ctx context.Context, f Filter) (Iterator[models.User], error)
+	// GetUser accepts a ULID or a legacy integer id (see models.User.LegacyID)
+	GetUser(ctx context.Context, id string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error) // email as normalized by models.User
+	CreateUser(ctx context.Context, u models.User) (models.User, error)    // assigns the ID (ids.New)
+	UpdateUser(ctx context.Context, u models.User) (models.User, error)
+	DeleteUser(ctx context.Context, id string) error
+	// RestoreUser puts a deleted user back exactly as it was - id, legacy id
+	// and timestamps included (undo). DuplicateError if the email was taken since.
+	RestoreUser(ctx context.Context, u models.User) (models.User, error)
+	// DeleteUsers removes everything matching f in one operation and returns the ids.
+	// with dryRun it only reports what would have been removed.
+	DeleteUsers(ctx context.Context, f Filter, dryRun bool) ([]string, error)
+}
+
+// Pools is implemented by backends that sit on database/sql pools, so the
+// server can report (and gate readiness on) their health.
+type Pools interface {
+	Pools() map[string]*sql.DB
+}
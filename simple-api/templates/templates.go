@@ -0,0 +1,184 @@
+// Package templates renders the emails the service sends. each message is
+// two files: <name>.txt, a text/template defining "subject" and "text", and
+// <name>.html, an html/template defining "content" for layout.html.
+//
+// the defaults are embedded (email/). a directory (EMAIL_TEMPLATES_DIR) can
+// override any of those files, one at a time - whatever it doesn't have
+// falls back to the default, so restyling the layout doesn't mean copying
+// every message. Load parses and test-renders everything up front, so a
+// broken override fails at startup (and in --check), not on the first send.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+//go:embed email/*
+var defaults embed.FS
+
+// the messages
+const (
+	Verification  = "verification"
+	PasswordReset = "password_reset"
+	Welcome       = "welcome"
+)
+
+var names = []string{Verification, PasswordReset, Welcome}
+
+// Data is what every template is rendered with.
+type Data struct {
+	App     string // product name, for subjects and sign-offs
+	User    models.User
+	Link    string        // to verify or reset with; empty for welcome
+	Expires time.Duration // how long Link works
+}
+
+// Message is a rendered email.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Set is the parsed templates.
+type Set struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+var funcs = map[string]any{"duration": humanDuration}
+
+// sample is what Load test-renders with, so a template naming a field Data
+// doesn't have fails there.
+var sample = Data{
+	App:     "simple-api",
+	User:    models.User{ID: "01HV4ZK2Q3M5N6P7R8S9T0VWXY", Name: "Sample", Email: "sample@example.com", Role: models.RoleMember},
+	Link:    "https://example.com/verify?token=sample",
+	Expires: 24 * time.Hour,
+}
+
+// Load reads the templates: the defaults, with any file in dir taking the
+// place of its default. dir "" is the defaults alone. a file in dir that
+// isn't one of them is an error - most likely a typo'd name.
+func Load(dir string) (*Set, error) {
+	files := []string{"layout.html"}
+	for _, n := range names {
+		files = append(files, n+".txt", n+".html")
+	}
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("templates: %w", err)
+		}
+		for _, e := range entries {
+			if ext := filepath.Ext(e.Name()); (ext == ".txt" || ext == ".html") && !slices.Contains(files, e.Name()) {
+				return nil, fmt.Errorf("templates: %s is not one of %s", filepath.Join(dir, e.Name()), strings.Join(files, ", "))
+			}
+		}
+	}
+	read := func(file string) (string, error) {
+		if dir != "" {
+			b, err := os.ReadFile(filepath.Join(dir, file))
+			if err == nil {
+				return string(b), nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", fmt.Errorf("templates: %w", err)
+			}
+		}
+		b, err := defaults.ReadFile("email/" + file)
+		return string(b), err
+	}
+
+	layout, err := read("layout.html")
+	if err != nil {
+		return nil, err
+	}
+	s := &Set{text: map[string]*texttemplate.Template{}, html: map[string]*htmltemplate.Template{}}
+	for _, n := range names {
+		src, err := read(n + ".txt")
+		if err != nil {
+			return nil, err
+		}
+		t, err := texttemplate.New(n + ".txt").Funcs(funcs).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("templates: %w", err)
+		}
+		if t.Lookup("subject") == nil || t.Lookup("text") == nil {
+			return nil, fmt.Errorf("templates: %s.txt must define \"subject\" and \"text\"", n)
+		}
+		if src, err = read(n + ".html"); err != nil {
+			return nil, err
+		}
+		h, err := htmltemplate.New("layout.html").Funcs(funcs).Parse(layout)
+		if err == nil {
+			h, err = h.New(n + ".html").Parse(src)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("templates: %w", err)
+		}
+		if h.Lookup("content") == nil {
+			return nil, fmt.Errorf("templates: %s.html must define \"content\"", n)
+		}
+		s.text[n], s.html[n] = t, h
+		if _, err := s.Render(n, sample); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Render renders message name (Welcome, ...) for d.
+func (s *Set) Render(name string, d Data) (Message, error) {
+	t, h := s.text[name], s.html[name]
+	if t == nil {
+		return Message{}, fmt.Errorf("templates: no message %q", name)
+	}
+	var subject, text, html bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", d); err != nil {
+		return Message{}, fmt.Errorf("templates: %w", err)
+	}
+	if err := t.ExecuteTemplate(&text, "text", d); err != nil {
+		return Message{}, fmt.Errorf("templates: %w", err)
+	}
+	if err := h.ExecuteTemplate(&html, "layout.html", d); err != nil {
+		return Message{}, fmt.Errorf("templates: %w", err)
+	}
+	m := Message{Subject: strings.TrimSpace(subject.String()), Text: strings.TrimSpace(text.String()) + "\n", HTML: html.String()}
+	// it ends up in a header, where a line break starts a new one
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return Message{}, fmt.Errorf("templates: %s: subject spans lines", name)
+	}
+	return m, nil
+}
+
+// humanDuration is "24 hours", "30 minutes" - what an email says, where
+// Duration.String would say 24h0m0s.
+func humanDuration(d time.Duration) string {
+	unit := func(n int, name string) string {
+		if n == 1 {
+			return "1 " + name
+		}
+		return fmt.Sprintf("%d %ss", n, name)
+	}
+	switch {
+	case d >= 48*time.Hour && d%(24*time.Hour) == 0:
+		return unit(int(d/(24*time.Hour)), "day")
+	case d >= time.Hour && d%time.Hour == 0:
+		return unit(int(d/time.Hour), "hour")
+	}
+	return unit(int(d.Round(time.Minute)/time.Minute), "minute")
+}
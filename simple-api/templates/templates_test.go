@@ -0,0 +1,94 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamskyy666/simple-api/models"
+)
+
+func TestDefaults(t *testing.T) {
+	s, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Data{
+		App:     "simple-api",
+		User:    models.User{Name: "<Zoë>", Email: "zoe@example.com"},
+		Link:    "https://example.com/verify?token=abc&x=1",
+		Expires: 48 * time.Hour,
+	}
+	for _, n := range names {
+		m, err := s.Render(n, d)
+		if err != nil {
+			t.Fatalf("%s: %v", n, err)
+		}
+		if m.Subject == "" || !strings.Contains(m.Text, "<Zoë>") || !strings.Contains(m.HTML, "&lt;Zoë&gt;") {
+			t.Errorf("%s: %+v", n, m)
+		}
+		if n != Welcome && (!strings.Contains(m.Text, "2 days") || !strings.Contains(m.HTML, `href="https://example.com/verify?token=abc&amp;x=1"`)) {
+			t.Errorf("%s: link or expiry missing: %+v", n, m)
+		}
+	}
+	if _, err := s.Render("nope", d); err == nil {
+		t.Error("rendered an unknown message")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("layout.html", `{{define "layout.html"}}<main>{{template "content" .}}</main>{{end}}`)
+	write("welcome.txt", `{{define "subject"}}Hello from {{.App}}{{end}}{{define "text"}}hi {{.User.Name}}{{end}}`)
+	write("README.md", "not a template, left alone")
+
+	s, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.Render(Welcome, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the text is overridden, the html is the default in the new layout
+	if m.Subject != "Hello from simple-api" || m.Text != "hi Sample\n" ||
+		!strings.HasPrefix(m.HTML, "<main>") || !strings.Contains(m.HTML, "is ready") {
+		t.Errorf("%+v", m)
+	}
+
+	for name, src := range map[string]string{
+		"welcome.txt":      `{{define "subject"}}x{{end}}`,                                      // no "text"
+		"verification.txt": `{{define "subject"}}x{{end}}{{define "text"}}{{.Usr.Name}}{{end}}`, // no such field
+		"welcome.html":     `{{define "content"}}{{.User.Name}{{end}}`,                          // doesn't parse
+		"password_reset.txt": `{{define "subject"}}to {{.User.Name}}
+bcc: everyone@example.com{{end}}{{define "text"}}x{{end}}`, // header injection
+		"welcme.txt": ``, // typo
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(dir); err == nil {
+			t.Errorf("%s: loaded %q", name, src)
+		}
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		time.Minute: "1 minute", 30 * time.Minute: "30 minutes", 90 * time.Minute: "90 minutes",
+		time.Hour: "1 hour", 24 * time.Hour: "24 hours", 72 * time.Hour: "3 days",
+	} {
+		if got := humanDuration(d); got != want {
+			t.Errorf("%v: got %q, want %q", d, got, want)
+		}
+	}
+}
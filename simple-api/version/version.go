@@ -0,0 +1,58 @@
+// Package version reports what build is running. the values are stamped at
+// link time, eg
+//
+//	go build -ldflags "-X github.com/iamskyy666/simple-api/version.Version=v1.2.0 \
+//	  -X github.com/iamskyy666/simple-api/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/iamskyy666/simple-api/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/api
+//
+// a plain `go build` inside the repo still gets the commit from the vcs info go embeds.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// set via -ldflags -X (must stay plain string vars for that to work)
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"` // built from a dirty tree
+}
+
+// Get merges the ldflags values with whatever the go toolchain recorded.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
@@ -0,0 +1,3 @@
+// placeholder build - replace web/dist with the real frontend output
+document.getElementById("app").innerHTML =
+  "<h1>simple-api ✅</h1><p>route: <code>" + location.pathname + "</code></p>";
@@ -0,0 +1,22 @@
+// Package web embeds the built frontend so the api ships as a single binary.
+// drop the output of `npm run build` into web/dist and rebuild.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Dist is the frontend build rooted at dist/ (index.html at the top).
+var Dist fs.FS
+
+func init() {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err) // only fails if the embed pattern above is wrong
+	}
+	Dist = sub
+}
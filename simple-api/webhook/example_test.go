@@ -0,0 +1,40 @@
+package webhook_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/iamskyy666/simple-api/webhook"
+)
+
+// a consumer's handler for our deliveries: read the body as sent, check
+// the signature, and only then look at what it says.
+func Example() {
+	secret := []byte("the ANOMALY_WEBHOOK_SECRET value")
+
+	receive := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := webhook.VerifySignature(body, r.Header.Get(webhook.Header), secret); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		fmt.Printf("verified: %s\n", body) // decode and act on it here
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	// what a delivery looks like on the wire
+	body := `{"route":"GET /users/{id}","kind":"latency_p95","state":"firing"}`
+	req := httptest.NewRequest(http.MethodPost, "/hooks/simple-api", strings.NewReader(body))
+	req.Header.Set(webhook.Header, webhook.Sign([]byte(body), secret, time.Now()))
+	receive(httptest.NewRecorder(), req)
+
+	// Output: verified: {"route":"GET /users/{id}","kind":"latency_p95","state":"firing"}
+}
@@ -0,0 +1,94 @@
+// Package webhook signs the deliveries this service sends (anomaly alerts,
+// see ANOMALY_WEBHOOK) and lets whoever receives them check they're ours.
+// it only needs the standard library, so a consumer can import it on its
+// own; see the package example for a receiving handler.
+//
+// a delivery carries
+//
+//	X-Webhook-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+//
+// keyed with the secret both sides share (ANOMALY_WEBHOOK_SECRET). one
+// signed more than Tolerance ago is rejected, so a captured delivery can't
+// be replayed later. several v1 values mean the sender is rotating secrets;
+// any one matching is enough.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is where the signature goes.
+const Header = "X-Webhook-Signature"
+
+// Tolerance is how far a delivery's timestamp may be from the receiver's
+// clock, either way.
+const Tolerance = 5 * time.Minute
+
+var (
+	ErrNoSignature = errors.New("webhook: no signature")
+	ErrMalformed   = errors.New("webhook: malformed signature header")
+	ErrExpired     = errors.New("webhook: signature timestamp outside tolerance")
+	ErrMismatch    = errors.New("webhook: signature mismatch")
+)
+
+// Sign returns the Header value for payload, signed with secret at t.
+func Sign(payload, secret []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(ts, payload, secret)
+}
+
+// VerifySignature checks header, the Header value a delivery came with,
+// against its body and the shared secret. payload must be the body exactly
+// as received - not re-encoded.
+func VerifySignature(payload []byte, header string, secret []byte) error {
+	return verify(payload, header, secret, time.Now())
+}
+
+func verify(payload []byte, header string, secret []byte, now time.Time) error {
+	if header == "" {
+		return ErrNoSignature
+	}
+	var ts string
+	var sigs []string
+	for part := range strings.SplitSeq(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformed
+		}
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+		// other schemes are for other versions of the signer; skip them
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrMalformed
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > Tolerance || d < -Tolerance {
+		return ErrExpired
+	}
+	want := mac(ts, payload, secret)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrMismatch
+}
+
+func mac(ts string, payload, secret []byte) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(ts))
+	m.Write([]byte{'.'})
+	m.Write(payload)
+	return hex.EncodeToString(m.Sum(nil))
+}
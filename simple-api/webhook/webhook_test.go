@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret, body := []byte("s3cret"), []byte(`{"state":"firing"}`)
+	at := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	header := Sign(body, secret, at)
+	for _, c := range []struct {
+		name   string
+		body   []byte
+		header string
+		secret []byte
+		now    time.Time
+		want   error
+	}{
+		{"valid", body, header, secret, at, nil},
+		{"clock skew", body, header, secret, at.Add(-Tolerance), nil},
+		{"rotating", body, header + ",v1=00ff", secret, at, nil},
+		{"unknown scheme", body, header + ",v0=abc", secret, at, nil},
+		{"no header", body, "", secret, at, ErrNoSignature},
+		{"garbage", body, "nope", secret, at, ErrMalformed},
+		{"no v1", body, "t=1", secret, at, ErrMalformed},
+		{"replayed", body, header, secret, at.Add(Tolerance + time.Second), ErrExpired},
+		{"tampered", []byte(`{"state":"resolved"}`), header, secret, at, ErrMismatch},
+		{"other secret", body, header, []byte("guess"), at, ErrMismatch},
+		{"re-timestamped", body, "t=1773500967" + header[len("t=1773500966"):], secret, at, ErrMismatch},
+	} {
+		if err := verify(c.body, c.header, c.secret, c.now); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}